@@ -0,0 +1,77 @@
+package hashfs
+
+import (
+	"io/fs"
+	"strings"
+	"sync/atomic"
+)
+
+// WithCaseInsensitive returns an option that resolves names that do not exist
+// as-is by matching them case-insensitively against the files & directories
+// of the file system, such as "Logo.PNG" for "logo.png". This applies to hash
+// names as well, which allows FileServer to serve assets referenced from
+// externally authored HTML. If multiple names differ only by case then the
+// all-lowercase name is preferred, followed by the first in lexical order. The
+// index of names is built on first use & rebuilt after files are invalidated
+// or the cache is reset, including in development mode.
+func WithCaseInsensitive(enabled bool) Option {
+	return func(fsys *FS) {
+		fsys.foldCase = enabled
+	}
+}
+
+// fold returns the path within the underlying file system that matches name
+// case-insensitively. Returns name if case-insensitive lookups are disabled,
+// name exists as-is, or no match is found.
+func (fsys *FS) fold(name string) string {
+	if !fsys.foldCase {
+		return name
+	}
+
+	// The index also contains lowercase forms so a name may map to another
+	// path, such as "logo.png" to "Logo.PNG".
+	index := fsys.foldIndex()
+	if other, ok := index[name]; ok {
+		return other
+	} else if other, ok := index[strings.ToLower(name)]; ok {
+		return other
+	}
+	return name
+}
+
+// foldIndex returns a map of every path, & its lowercase form, to the path.
+// The index is cached until the cache generation changes.
+func (fsys *FS) foldIndex() map[string]string {
+	fsys.cache.mu.RLock()
+	index := fsys.cache.fold
+	fsys.cache.mu.RUnlock()
+	if index != nil {
+		return index
+	}
+	gen := atomic.LoadInt64(&fsys.cache.gen)
+
+	// Walk in lexical order so the first of several names differing by case
+	// is used. Exact names always take precedence over lowercase forms so an
+	// all-lowercase name is preferred.
+	index = make(map[string]string)
+	_ = fs.WalkDir(fsys.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		index[name] = name
+		if lower := strings.ToLower(name); lower != name {
+			if _, ok := index[lower]; !ok {
+				index[lower] = name
+			}
+		}
+		return nil
+	})
+
+	// Only cache the index if no files were invalidated during the walk.
+	fsys.cache.mu.Lock()
+	if atomic.LoadInt64(&fsys.cache.gen) == gen {
+		fsys.cache.fold = index
+	}
+	fsys.cache.mu.Unlock()
+	return index
+}
@@ -0,0 +1,136 @@
+package hashfs_test
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestFS_WithCaseInsensitive(t *testing.T) {
+	fsys := fstest.MapFS{
+		"images/logo.png": {Data: []byte(`foo`)},
+		"Same.txt":        {Data: []byte(`bar`)},
+		"same.txt":        {Data: []byte(`baz`)},
+	}
+
+	t.Run("Open", func(t *testing.T) {
+		f := hashfs.NewFS(fsys, hashfs.WithCaseInsensitive(true), hashfs.WithHashLength(8))
+		for _, name := range []string{
+			"images/logo.png",
+			"Images/Logo.PNG",
+			"IMAGES/LOGO-2c26b46b.PNG",
+			"images/logo-2c26b46b.png",
+		} {
+			if buf, err := fs.ReadFile(f, name); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			} else if got, want := string(buf), "foo"; got != want {
+				t.Fatalf("%s: ReadFile()=%q, want %q", name, got, want)
+			}
+		}
+
+		if _, err := fs.ReadFile(f, "images/missing.png"); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// Names that exist as-is are never folded.
+	t.Run("ExactMatch", func(t *testing.T) {
+		f := hashfs.NewFS(fsys, hashfs.WithCaseInsensitive(true))
+		for _, tt := range []struct {
+			name string
+			want string
+		}{
+			{"Same.txt", "bar"},
+			{"same.txt", "baz"},
+			{"SAME.TXT", "baz"},
+			{"SAME.txt", "baz"},
+		} {
+			if buf, err := fs.ReadFile(f, tt.name); err != nil {
+				t.Fatal(err)
+			} else if got := string(buf); got != tt.want {
+				t.Fatalf("%s: ReadFile()=%q, want %q", tt.name, got, tt.want)
+			}
+		}
+	})
+
+	// Lowercase names resolve to files with mixed-case names.
+	t.Run("Lowercase", func(t *testing.T) {
+		f := hashfs.NewFS(fstest.MapFS{"Logo.PNG": {Data: []byte(`foo`)}}, hashfs.WithCaseInsensitive(true), hashfs.WithHashLength(8))
+		if buf, err := fs.ReadFile(f, "logo.png"); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), "foo"; got != want {
+			t.Fatalf("ReadFile()=%q, want %q", got, want)
+		} else if got, want := f.HashName("logo.png"), "Logo-2c26b46b.PNG"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		}
+
+		h := hashfs.FileServer(f)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/logo.png", nil))
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		f := hashfs.NewFS(fsys)
+		if _, err := fs.ReadFile(f, "Images/Logo.PNG"); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// Files added after the index is built are found once invalidated.
+	t.Run("Reset", func(t *testing.T) {
+		m := fstest.MapFS{"a.txt": {Data: []byte(`foo`)}}
+		f := hashfs.NewFS(m, hashfs.WithCaseInsensitive(true))
+		if _, err := fs.ReadFile(f, "A.TXT"); err != nil {
+			t.Fatal(err)
+		}
+
+		m["b.txt"] = &fstest.MapFile{Data: []byte(`bar`)}
+		f.Reset()
+		if _, err := fs.ReadFile(f, "B.TXT"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// The index is reused in development mode until files are invalidated.
+	t.Run("Dev", func(t *testing.T) {
+		m := fstest.MapFS{"a.txt": {Data: []byte(`foo`)}}
+		f := hashfs.NewFS(m, hashfs.WithCaseInsensitive(true), hashfs.WithDev(true))
+		if _, err := fs.ReadFile(f, "A.TXT"); err != nil {
+			t.Fatal(err)
+		}
+
+		m["b.txt"] = &fstest.MapFile{Data: []byte(`bar`)}
+		if _, err := fs.ReadFile(f, "B.TXT"); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		f.Invalidate("b.txt")
+		if buf, err := fs.ReadFile(f, "B.TXT"); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), "bar"; got != want {
+			t.Fatalf("ReadFile()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("FileServer", func(t *testing.T) {
+		h := hashfs.FileServer(hashfs.NewFS(fsys, hashfs.WithCaseInsensitive(true), hashfs.WithHashLength(8)))
+		r := httptest.NewRequest("GET", "/Images/Logo-2c26b46b.PNG", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Header().Get("Cache-Control"), hashfs.DefaultCacheControl; got != want {
+			t.Fatalf("Cache-Control=%q, want %q", got, want)
+		} else if got, want := w.Header().Get("Content-Type"), "image/png"; got != want {
+			t.Fatalf("Content-Type=%q, want %q", got, want)
+		}
+	})
+}
@@ -0,0 +1,29 @@
+// Package chihashfs provides helpers for serving a hashfs.FS with chi.
+package chihashfs
+
+import (
+	"html/template"
+	"strings"
+
+	"github.com/benbjohnson/hashfs"
+	"github.com/go-chi/chi/v5"
+)
+
+// Mount attaches a hashfs.FileServer for fsys to r under the URL prefix set
+// by hashfs.WithURLPrefix. The file server strips the prefix itself so the
+// router does not need to.
+func Mount(r chi.Router, fsys *hashfs.FS, opts ...hashfs.ServerOption) {
+	h := hashfs.FileServer(fsys, opts...)
+	if prefix := fsys.URLPrefix(); prefix == "/" {
+		r.Handle("/*", h)
+	} else {
+		r.Handle(strings.TrimSuffix(prefix, "/"), h)
+		r.Handle(prefix+"*", h)
+	}
+}
+
+// FuncMap returns template functions for referencing files in fsys by their
+// hash names. See hashfs.FS.FuncMap.
+func FuncMap(fsys *hashfs.FS) template.FuncMap {
+	return fsys.FuncMap()
+}
@@ -0,0 +1,29 @@
+package chihashfs_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benbjohnson/hashfs"
+	"github.com/benbjohnson/hashfs/chihashfs"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestMount(t *testing.T) {
+	fsys := hashfs.NewFS(fstest.MapFS{"app.js": {Data: []byte(`foo`)}}, hashfs.WithURLPrefix("/static/"))
+	r := chi.NewRouter()
+	chihashfs.Mount(r, fsys)
+
+	req, _ := http.NewRequest("GET", fsys.URL("app.js"), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Fatalf("code=%v, want %v", got, want)
+	} else if got, want := w.Body.String(), `foo`; got != want {
+		t.Fatalf("body=%q, want %q", got, want)
+	} else if got, want := w.Result().Header.Get("Cache-Control"), hashfs.DefaultCacheControl; got != want {
+		t.Fatalf("cache-control=%v, want %v", got, want)
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/benbjohnson/hashfs/chihashfs
+
+go 1.23
+
+require (
+	github.com/benbjohnson/hashfs v0.0.0-00010101000000-000000000000
+	github.com/go-chi/chi/v5 v5.3.2
+)
+
+require golang.org/x/text v0.16.0 // indirect
+
+replace github.com/benbjohnson/hashfs => ../
@@ -0,0 +1,135 @@
+// Command hashfs copies a directory of assets to an output directory using
+// the same hash names that hashfs.FS reports at runtime.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func main() {
+	m := NewMain()
+	if err := m.Run(context.Background(), os.Args[1:]); err == flag.ErrHelp {
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Main represents the program.
+type Main struct {
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// NewMain returns a new instance of Main.
+func NewMain() *Main {
+	return &Main{
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+}
+
+// Run executes the program.
+func (m *Main) Run(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("hashfs", flag.ContinueOnError)
+	fs.SetOutput(m.Stderr)
+	manifestPath := fs.String("manifest", "", "write JSON manifest to path")
+	length := fs.Int("length", 0, "number of hash characters in filenames")
+	sep := fs.String("sep", "-", "separator between hash & filename")
+	verbose := fs.Bool("v", false, "verbose logging")
+	fs.Usage = func() {
+		fmt.Fprintln(m.Stderr, `
+Usage:
+
+	hashfs [arguments] SRC DST
+
+Copies every file within the SRC directory into the DST directory using its
+hash name. A JSON manifest of the mapping can optionally be written.
+
+Arguments:
+`[1:])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() == 0 {
+		return errors.New("source directory required")
+	} else if fs.NArg() == 1 {
+		return errors.New("destination directory required")
+	} else if fs.NArg() > 2 {
+		return errors.New("too many arguments")
+	}
+	src, dst := fs.Arg(0), fs.Arg(1)
+
+	fsys := hashfs.NewFS(os.DirFS(src), hashfs.WithHashLength(*length), hashfs.WithSeparator(*sep))
+	if err := fsys.Warm(ctx); err != nil {
+		return err
+	}
+
+	// Copy each file to its hash name within the destination directory.
+	for name, hashName := range fsys.Manifest() {
+		if err := copyFile(filepath.Join(dst, filepath.FromSlash(hashName)), filepath.Join(src, filepath.FromSlash(name))); err != nil {
+			return err
+		}
+		if *verbose {
+			fmt.Fprintf(m.Stdout, "%s -> %s\n", name, hashName)
+		}
+	}
+
+	// Write manifest, if requested.
+	if *manifestPath != "" {
+		if err := writeManifest(*manifestPath, fsys); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyFile copies the contents of the src file to dst, creating parent
+// directories as needed.
+func copyFile(dst, src string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// writeManifest writes the JSON manifest for fsys to filename.
+func writeManifest(filename string, fsys *hashfs.FS) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := fsys.WriteManifest(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,60 @@
+package main_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/benbjohnson/hashfs"
+	main "github.com/benbjohnson/hashfs/cmd/hashfs"
+)
+
+func TestMain_Run(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		dst := t.TempDir()
+		manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+
+		m := main.NewMain()
+		m.Stdout, m.Stderr = io.Discard, io.Discard
+		if err := m.Run(context.Background(), []string{"-length", "8", "-manifest", manifestPath, "../../testdata", dst}); err != nil {
+			t.Fatal(err)
+		}
+
+		if buf, err := os.ReadFile(filepath.Join(dst, "baz-b633a587.html")); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `<html></html>`; got != want {
+			t.Fatalf("content=%q, want %q", got, want)
+		}
+		if buf, err := os.ReadFile(filepath.Join(dst, "a", "foo-9f86d081.txt")); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `test`; got != want {
+			t.Fatalf("content=%q, want %q", got, want)
+		}
+
+		var manifest map[string]hashfs.ManifestEntry
+		if buf, err := os.ReadFile(manifestPath); err != nil {
+			t.Fatal(err)
+		} else if err := json.Unmarshal(buf, &manifest); err != nil {
+			t.Fatal(err)
+		} else if got, want := manifest["x.y/z.txt"].HashName, "x.y/z-94ee0593.txt"; got != want {
+			t.Fatalf("HashName=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("ErrSourceRequired", func(t *testing.T) {
+		m := main.NewMain()
+		if err := m.Run(context.Background(), nil); err == nil || err.Error() != `source directory required` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrDestinationRequired", func(t *testing.T) {
+		m := main.NewMain()
+		if err := m.Run(context.Background(), []string{"src"}); err == nil || err.Error() != `destination directory required` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,182 @@
+// Command hashfsgen generates a Go file containing the precomputed hashes of a
+// directory of assets along with a typed constant for each asset path. It is
+// intended to be run with go:generate next to an embed.FS:
+//
+//	//go:generate hashfsgen -o assets_gen.go static
+//
+//	//go:embed static
+//	var static embed.FS
+//
+//	var fsys = hashfs.NewFS(static, hashfs.WithHashes(Hashes))
+//
+// Files are not hashed at runtime and references to renamed or removed assets
+// fail to compile.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func main() {
+	m := NewMain()
+	if err := m.Run(context.Background(), os.Args[1:]); err == flag.ErrHelp {
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Main represents the program.
+type Main struct {
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// NewMain returns a new instance of Main.
+func NewMain() *Main {
+	return &Main{
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+}
+
+// Run executes the program.
+func (m *Main) Run(ctx context.Context, args []string) error {
+	flagSet := flag.NewFlagSet("hashfsgen", flag.ContinueOnError)
+	flagSet.SetOutput(m.Stderr)
+	output := flagSet.String("o", "hashfs_gen.go", "output file")
+	pkg := flagSet.String("pkg", os.Getenv("GOPACKAGE"), "package name, defaults to $GOPACKAGE")
+	varName := flagSet.String("var", "Hashes", "name of the generated hash map")
+	typeName := flagSet.String("type", "Asset", "name of the generated asset path type")
+	trim := flagSet.Bool("trim", false, "report paths relative to DIR instead of the current directory")
+	flagSet.Usage = func() {
+		fmt.Fprintln(m.Stderr, `
+Usage:
+
+	hashfsgen [arguments] DIR
+
+Hashes every file within DIR and writes a Go file containing a map of each
+path to its hex-encoded SHA-256 digest, for use with hashfs.WithHashes, and a
+constant for each path. Paths include DIR, as with go:embed, unless -trim is
+set.
+
+Arguments:
+`[1:])
+		flagSet.PrintDefaults()
+	}
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	} else if flagSet.NArg() == 0 {
+		return errors.New("directory required")
+	} else if flagSet.NArg() > 1 {
+		return errors.New("too many arguments")
+	} else if *pkg == "" {
+		return errors.New("package name required")
+	} else if !token.IsIdentifier(*pkg) || !token.IsIdentifier(*varName) || !token.IsIdentifier(*typeName) {
+		return errors.New("package, variable & type names must be valid identifiers")
+	}
+	dir := flagSet.Arg(0)
+
+	// Build paths as they are seen by the embedding file system.
+	prefix := ""
+	if !*trim {
+		if prefix = path.Clean(filepath.ToSlash(dir)); !fs.ValidPath(prefix) {
+			return fmt.Errorf("directory must be within the current directory unless -trim is set: %s", dir)
+		}
+	}
+
+	fsys := hashfs.NewFS(os.DirFS(dir))
+	if err := fsys.Warm(ctx); err != nil {
+		return err
+	}
+
+	hashes := make(map[string]string)
+	for name, e := range fsys.ManifestEntries() {
+		hashes[path.Join(prefix, name)] = e.Hash
+	}
+
+	buf, err := generate(*pkg, *varName, *typeName, hashes)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*output, buf, 0o666)
+}
+
+// generate returns the formatted source of the generated file.
+func generate(pkg, varName, typeName string, hashes map[string]string) ([]byte, error) {
+	names := make([]string, 0, len(hashes))
+	for name := range hashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Ensure every path maps to a distinct identifier.
+	idents := make(map[string]string)
+	for _, name := range names {
+		ident := typeName + identifier(name)
+		if other, ok := idents[ident]; ok {
+			return nil, fmt.Errorf("paths %q & %q both map to constant %s", other, name, ident)
+		}
+		idents[ident] = name
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "// Code generated by hashfsgen. DO NOT EDIT.")
+	fmt.Fprintln(&b)
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+
+	fmt.Fprintf(&b, "// %s is the path of an asset.\n", typeName)
+	fmt.Fprintf(&b, "type %s string\n\n", typeName)
+	fmt.Fprintln(&b, "// Asset paths.")
+	fmt.Fprintln(&b, "const (")
+	for _, name := range names {
+		fmt.Fprintf(&b, "\t%s %s = %q\n", typeName+identifier(name), typeName, name)
+	}
+	fmt.Fprintln(&b, ")")
+	fmt.Fprintln(&b)
+
+	fmt.Fprintf(&b, "// %s maps asset paths to their hex-encoded SHA-256 digests. Pass it to\n", varName)
+	fmt.Fprintln(&b, "// hashfs.WithHashes so that assets are not hashed at runtime.")
+	fmt.Fprintf(&b, "var %s = map[string]string{\n", varName)
+	for _, name := range names {
+		fmt.Fprintf(&b, "\t%q: %q,\n", name, hashes[name])
+	}
+	fmt.Fprintln(&b, "}")
+
+	return format.Source(b.Bytes())
+}
+
+// identifier returns an exported identifier for a path by capitalizing each
+// run of letters & digits (e.g. "css/site.min.css" becomes "CssSiteMinCss").
+func identifier(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		} else if upper {
+			r = unicode.ToUpper(r)
+		}
+		b.WriteRune(r)
+		upper = false
+	}
+	return b.String()
+}
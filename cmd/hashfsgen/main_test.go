@@ -0,0 +1,101 @@
+package main_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/hashfs/cmd/hashfsgen"
+)
+
+func TestMain_Run(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "assets_gen.go")
+
+		// Paths are relative to the current directory, as with go:embed.
+		wd, err := os.Getwd()
+		if err != nil {
+			t.Fatal(err)
+		} else if err := os.Chdir("../.."); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chdir(wd)
+
+		m := main.NewMain()
+		m.Stdout, m.Stderr = io.Discard, io.Discard
+		if err := m.Run(context.Background(), []string{"-o", output, "-pkg", "assets", "testdata"}); err != nil {
+			t.Fatal(err)
+		}
+
+		buf, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(buf), "// Code generated by hashfsgen. DO NOT EDIT.\n") {
+			t.Fatalf("missing generated code header:\n%s", buf)
+		}
+
+		// Compare without alignment whitespace added by gofmt.
+		out := strings.Join(strings.Fields(string(buf)), " ")
+		for _, want := range []string{
+			`package assets`,
+			`type Asset string`,
+			`AssetTestdataBazHtml Asset = "testdata/baz.html"`,
+			`AssetTestdataXYZTxt Asset = "testdata/x.y/z.txt"`,
+			`var Hashes = map[string]string{`,
+			`"testdata/baz.html": "b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628",`,
+		} {
+			if !strings.Contains(out, want) {
+				t.Fatalf("missing %q in output:\n%s", want, buf)
+			}
+		}
+	})
+
+	t.Run("Trim", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "assets_gen.go")
+
+		m := main.NewMain()
+		m.Stdout, m.Stderr = io.Discard, io.Discard
+		if err := m.Run(context.Background(), []string{"-o", output, "-pkg", "assets", "-trim", "-type", "Path", "-var", "AssetHashes", "../../testdata"}); err != nil {
+			t.Fatal(err)
+		}
+
+		buf, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := strings.Join(strings.Fields(string(buf)), " ")
+		for _, want := range []string{
+			`PathBazHtml Path = "baz.html"`,
+			`var AssetHashes = map[string]string{`,
+		} {
+			if !strings.Contains(out, want) {
+				t.Fatalf("missing %q in output:\n%s", want, buf)
+			}
+		}
+	})
+
+	t.Run("ErrDirectoryRequired", func(t *testing.T) {
+		m := main.NewMain()
+		if err := m.Run(context.Background(), nil); err == nil || err.Error() != `directory required` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrDirectoryOutside", func(t *testing.T) {
+		m := main.NewMain()
+		if err := m.Run(context.Background(), []string{"-pkg", "assets", "../../testdata"}); err == nil || !strings.Contains(err.Error(), "-trim") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrPackageRequired", func(t *testing.T) {
+		m := main.NewMain()
+		if err := m.Run(context.Background(), []string{"-pkg", "", "../../testdata"}); err == nil || err.Error() != `package name required` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
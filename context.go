@@ -0,0 +1,48 @@
+package hashfs
+
+import (
+	"context"
+)
+
+// ResolvedName describes the file that a FileServer request resolved to.
+type ResolvedName struct {
+	Name   string // original name, relative to the file system
+	Hash   string // hex-encoded digest of the served content
+	Hashed bool   // true if requested by hash name
+	Hit    bool   // true if the hash was cached before the request
+}
+
+// resolvedNameContextKey is the context key for a *ResolvedName.
+type resolvedNameContextKey struct{}
+
+// NewResolvedNameContext returns a copy of ctx that a FileServer records the
+// resolved name of a request into. Middleware that wraps a FileServer can use
+// it to read the resolved name after the request has been served:
+//
+//	r = r.WithContext(hashfs.NewResolvedNameContext(r.Context()))
+//	next.ServeHTTP(w, r)
+//	if rn, ok := hashfs.ResolvedNameFromContext(r.Context()); ok {
+//		log.Printf("served %s", rn.Name)
+//	}
+//
+// Handlers & hooks called by the FileServer, such as the observer, receive a
+// request context with a resolved name without any setup.
+func NewResolvedNameContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, resolvedNameContextKey{}, &ResolvedName{})
+}
+
+// ResolvedNameFromContext returns the resolved name recorded within ctx.
+// Returns false if the request was not resolved to a file.
+func ResolvedNameFromContext(ctx context.Context) (ResolvedName, bool) {
+	rn, _ := ctx.Value(resolvedNameContextKey{}).(*ResolvedName)
+	if rn == nil || rn.Name == "" {
+		return ResolvedName{}, false
+	}
+	return *rn, true
+}
+
+// resolvedName returns the resolved name recorded within ctx, if any.
+func resolvedName(ctx context.Context) *ResolvedName {
+	rn, _ := ctx.Value(resolvedNameContextKey{}).(*ResolvedName)
+	return rn
+}
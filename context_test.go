@@ -0,0 +1,60 @@
+package hashfs_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestResolvedNameFromContext(t *testing.T) {
+	fsys := hashfs.NewFS(fstest.MapFS{"css/main.css": {Data: []byte(`foo`)}}, hashfs.WithHashLength(8))
+	h := hashfs.FileServer(fsys)
+
+	serve := func(path string) (hashfs.ResolvedName, bool) {
+		t.Helper()
+		r, _ := http.NewRequest("GET", path, nil)
+		r = r.WithContext(hashfs.NewResolvedNameContext(r.Context()))
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		return hashfs.ResolvedNameFromContext(r.Context())
+	}
+
+	t.Run("Miss", func(t *testing.T) {
+		rn, ok := serve("css/main.css")
+		if !ok {
+			t.Fatal("expected resolved name")
+		} else if got, want := rn, (hashfs.ResolvedName{Name: "css/main.css", Hash: hashHex([]byte(`foo`))}); got != want {
+			t.Fatalf("ResolvedName=%+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("Hit", func(t *testing.T) {
+		rn, ok := serve("css/main-2c26b46b.css")
+		if !ok {
+			t.Fatal("expected resolved name")
+		} else if got, want := rn, (hashfs.ResolvedName{Name: "css/main.css", Hash: hashHex([]byte(`foo`)), Hashed: true, Hit: true}); got != want {
+			t.Fatalf("ResolvedName=%+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		if _, ok := serve("missing.css"); ok {
+			t.Fatal("expected no resolved name")
+		}
+	})
+
+	t.Run("Observer", func(t *testing.T) {
+		var got hashfs.ResolvedName
+		h := hashfs.FileServer(fsys, hashfs.WithObserver(func(r *http.Request, name string, status int, bytes int64, d time.Duration) {
+			got, _ = hashfs.ResolvedNameFromContext(r.Context())
+		}))
+		r, _ := http.NewRequest("GET", "css/main-2c26b46b.css", nil)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if want := (hashfs.ResolvedName{Name: "css/main.css", Hash: hashHex([]byte(`foo`)), Hashed: true, Hit: true}); got != want {
+			t.Fatalf("ResolvedName=%+v, want %+v", got, want)
+		}
+	})
+}
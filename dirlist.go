@@ -0,0 +1,112 @@
+package hashfs
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// WithDirListing returns an option that renders the contents of directories
+// that do not have an index file, with links to the hash names of files. This
+// is useful for internal artifact & download servers. Listings are rendered
+// as a simple HTML page unless a renderer is set with WithDirListRenderer.
+func WithDirListing(enabled bool) ServerOption {
+	return func(h *fsHandler) {
+		h.dirListing = enabled
+	}
+}
+
+// WithDirListRenderer returns an option that sets the function used to write
+// directory listings. It has no effect unless WithDirListing is enabled.
+func WithDirListRenderer(fn DirListRenderer) ServerOption {
+	return func(h *fsHandler) {
+		h.dirListRenderer = fn
+	}
+}
+
+// DirListRenderer writes a listing of the entries within dir, relative to the
+// root of the file system, to w. Headers such as Cache-Control are set before
+// the renderer is called.
+type DirListRenderer func(w http.ResponseWriter, r *http.Request, dir string, entries []DirListEntry)
+
+// DirListEntry represents a file or subdirectory within a directory listing.
+type DirListEntry struct {
+	Name    string // original name
+	URL     string // link relative to the listing, using the hash name of files
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// serveDirList writes a listing of the directory at name, a path within the
+// underlying file system. Files that are denied or that the request is not
+// authorized to access are omitted.
+func (h *fsHandler) serveDirList(w http.ResponseWriter, r *http.Request, name string) {
+	dirents, err := fs.ReadDir(h.fsys.fsys, name)
+	if err != nil {
+		h.serveError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Links are relative so they must include the directory name if the
+	// request path does not end in a slash.
+	var prefix string
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		prefix = path.Base(r.URL.Path) + "/"
+	}
+
+	dir := h.fsys.rel(name)
+	entries := make([]DirListEntry, 0, len(dirents))
+	for _, dirent := range dirents {
+		rel := path.Join(dir, dirent.Name())
+		if h.denied(rel) || (h.authorize != nil && !h.authorize(r, rel)) {
+			continue
+		} else if !dirent.IsDir() && h.fsys.excluded(path.Join(name, dirent.Name())) {
+			continue
+		}
+
+		fi, err := dirent.Info()
+		if err != nil {
+			continue
+		}
+
+		entry := DirListEntry{Name: dirent.Name(), IsDir: dirent.IsDir(), Size: fi.Size(), ModTime: fi.ModTime()}
+		if entry.IsDir {
+			entry.URL = (&url.URL{Path: prefix + dirent.Name()}).EscapedPath() + "/"
+		} else {
+			entry.URL = (&url.URL{Path: prefix + path.Base(h.fsys.HashName(rel))}).EscapedPath()
+		}
+		entries = append(entries, entry)
+	}
+
+	// Listings change whenever a file is added so they must be revalidated.
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if h.dirListRenderer != nil {
+		h.dirListRenderer(w, r, dir, entries)
+		return
+	}
+	renderDirList(w, r, dir, entries)
+}
+
+// renderDirList writes entries as a simple HTML page, similar to the
+// listings of http.FileServer.
+func renderDirList(w http.ResponseWriter, r *http.Request, dir string, entries []DirListEntry) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!doctype html>\n")
+	fmt.Fprintf(w, "<meta name=\"viewport\" content=\"width=device-width\">\n")
+	fmt.Fprintf(w, "<pre>\n")
+	for _, entry := range entries {
+		name := entry.Name
+		if entry.IsDir {
+			name += "/"
+		}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", template.HTMLEscapeString(entry.URL), template.HTMLEscapeString(name))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
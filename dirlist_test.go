@@ -0,0 +1,87 @@
+package hashfs_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestFileServer_WithDirListing(t *testing.T) {
+	fsys := hashfs.NewFS(fstest.MapFS{
+		"dist/app.js":         {Data: []byte(`foo`)},
+		"dist/a b.txt":        {Data: []byte(`bar`)},
+		"dist/private.key":    {Data: []byte(`baz`)},
+		"dist/sub/index.html": {Data: []byte(`<html></html>`)},
+	}, hashfs.WithHashLength(8))
+	authorize := hashfs.WithAuthorize(func(r *http.Request, name string) bool { return !strings.HasSuffix(name, ".key") })
+
+	t.Run("Default", func(t *testing.T) {
+		h := hashfs.FileServer(fsys, hashfs.WithDirListing(true), authorize)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/dist/", nil))
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Header().Get("Content-Type"), "text/html; charset=utf-8"; got != want {
+			t.Fatalf("Content-Type=%q, want %q", got, want)
+		} else if got, want := w.Header().Get("Cache-Control"), "no-cache"; got != want {
+			t.Fatalf("Cache-Control=%q, want %q", got, want)
+		} else if got, want := w.Body.String(), "<!doctype html>\n"+
+			"<meta name=\"viewport\" content=\"width=device-width\">\n"+
+			"<pre>\n"+
+			"<a href=\"a%20b-fcde2b2e.txt\">a b.txt</a>\n"+
+			"<a href=\"app-2c26b46b.js\">app.js</a>\n"+
+			"<a href=\"sub/\">sub/</a>\n"+
+			"</pre>\n"; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+
+		// Links include the directory name without a trailing slash.
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/dist", nil))
+		if got, want := w.Body.String(), `<a href="dist/app-2c26b46b.js">app.js</a>`; !strings.Contains(got, want) {
+			t.Fatalf("body=%q, want to contain %q", got, want)
+		}
+	})
+
+	t.Run("WithDirListRenderer", func(t *testing.T) {
+		h := hashfs.FileServer(fsys,
+			hashfs.WithDirListing(true),
+			hashfs.WithDirListRenderer(func(w http.ResponseWriter, r *http.Request, dir string, entries []hashfs.DirListEntry) {
+				fmt.Fprintf(w, "%s:", dir)
+				for _, e := range entries {
+					fmt.Fprintf(w, " %s=%s(%d,%v)", e.Name, e.URL, e.Size, e.IsDir)
+				}
+			}),
+		)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/dist/", nil))
+		if got, want := w.Body.String(), "dist: a b.txt=a%20b-fcde2b2e.txt(3,false) app.js=app-2c26b46b.js(3,false) private.key=private-baa5a096.key(3,false) sub=sub/(0,true)"; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+	})
+
+	// Directories with an index file serve the index instead of a listing.
+	t.Run("IndexFile", func(t *testing.T) {
+		h := hashfs.FileServer(fsys, hashfs.WithDirListing(true), hashfs.WithIndexFiles("index.html"))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/dist/sub/", nil))
+		if got, want := w.Body.String(), `<html></html>`; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		hashfs.FileServer(fsys).ServeHTTP(w, httptest.NewRequest("GET", "/dist/", nil))
+		if got, want := w.Code, http.StatusForbidden; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,8 @@
+//go:build go1.19
+// +build go1.19
+
+package hashfs
+
+// earlyHintsSupported is true if net/http sends informational responses
+// written before the final response.
+const earlyHintsSupported = true
@@ -0,0 +1,9 @@
+//go:build !go1.19
+// +build !go1.19
+
+package hashfs
+
+// earlyHintsSupported is false since net/http before Go 1.19 sends the first
+// status written, including a 1xx status, as the final response. Preload
+// links are only sent with the final response.
+const earlyHintsSupported = false
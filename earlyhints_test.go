@@ -0,0 +1,76 @@
+//go:build go1.19
+// +build go1.19
+
+package hashfs_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestFileServer_WithEarlyHints(t *testing.T) {
+	fsys := hashfs.NewFS(fstest.MapFS{
+		"index.html": {Data: []byte(`<html></html>`)},
+		"app.css":    {Data: []byte(`foo`)},
+	}, hashfs.WithHashLength(8), hashfs.WithURLPrefix("/"))
+	s := httptest.NewServer(hashfs.FileServer(fsys, hashfs.WithPreload("app.css"), hashfs.WithEarlyHints(true)))
+	defer s.Close()
+
+	hints, resp := getWithEarlyHints(t, s.URL+"/index.html")
+	if got, want := hints, []string{"</app-2c26b46b.css>; rel=preload; as=style"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("hints=%v, want %v", got, want)
+	} else if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("code=%v, want %v", got, want)
+	} else if got, want := resp.Header.Values("Link"), hints; !reflect.DeepEqual(got, want) {
+		t.Fatalf("link=%v, want %v", got, want)
+	}
+}
+
+func TestEarlyHints(t *testing.T) {
+	fsys := hashfs.NewFS(fstest.MapFS{"app.js": {Data: []byte(`foo`)}}, hashfs.WithHashLength(8), hashfs.WithURLPrefix("/static/"))
+	s := httptest.NewServer(hashfs.EarlyHints(fsys, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html></html>`))
+	}), "app.js"))
+	defer s.Close()
+
+	hints, resp := getWithEarlyHints(t, s.URL)
+	if got, want := hints, []string{"</static/app-2c26b46b.js>; rel=preload; as=script"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("hints=%v, want %v", got, want)
+	} else if got, want := resp.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("code=%v, want %v", got, want)
+	}
+}
+
+// getWithEarlyHints performs a GET request and returns the Link headers of
+// any 103 responses received before the final response.
+func getWithEarlyHints(tb testing.TB, url string) ([]string, *http.Response) {
+	tb.Helper()
+
+	var hints []string
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code == http.StatusEarlyHints {
+				hints = append(hints, header.Values("Link")...)
+			}
+			return nil
+		},
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	resp.Body.Close()
+	return hints, resp
+}
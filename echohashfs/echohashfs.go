@@ -0,0 +1,24 @@
+// Package echohashfs provides helpers for serving a hashfs.FS with Echo.
+package echohashfs
+
+import (
+	"html/template"
+
+	"github.com/benbjohnson/hashfs"
+	"github.com/labstack/echo/v4"
+)
+
+// Register attaches a hashfs.FileServer for fsys to e under the URL prefix
+// set by hashfs.WithURLPrefix. The file server strips the prefix itself.
+func Register(e *echo.Echo, fsys *hashfs.FS, opts ...hashfs.ServerOption) {
+	h := echo.WrapHandler(hashfs.FileServer(fsys, opts...))
+	e.GET(fsys.URLPrefix()+"*", h)
+	e.HEAD(fsys.URLPrefix()+"*", h)
+}
+
+// FuncMap returns template functions for referencing files in fsys by their
+// hash names. These can be added to the templates used by an echo.Renderer.
+// See hashfs.FS.FuncMap.
+func FuncMap(fsys *hashfs.FS) template.FuncMap {
+	return fsys.FuncMap()
+}
@@ -0,0 +1,26 @@
+// Package fiberhashfs provides helpers for serving a hashfs.FS with Fiber.
+package fiberhashfs
+
+import (
+	"github.com/benbjohnson/hashfs"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+)
+
+// Register attaches a hashfs.FileServer for fsys to r under the URL prefix
+// set by hashfs.WithURLPrefix. The file server strips the prefix itself.
+// Fiber registers HEAD routes along with GET routes.
+func Register(r fiber.Router, fsys *hashfs.FS, opts ...hashfs.ServerOption) {
+	r.Get(fsys.URLPrefix()+"*", adaptor.HTTPHandler(hashfs.FileServer(fsys, opts...)))
+}
+
+// FuncMap returns template functions for referencing files in fsys by their
+// hash names, suitable for the AddFuncMap method of Fiber's template engines.
+// See hashfs.FS.FuncMap.
+func FuncMap(fsys *hashfs.FS) map[string]interface{} {
+	m := make(map[string]interface{})
+	for k, v := range fsys.FuncMap() {
+		m[k] = v
+	}
+	return m
+}
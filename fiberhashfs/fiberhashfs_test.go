@@ -0,0 +1,44 @@
+package fiberhashfs_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benbjohnson/hashfs"
+	"github.com/benbjohnson/hashfs/fiberhashfs"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRegister(t *testing.T) {
+	fsys := hashfs.NewFS(fstest.MapFS{"app.js": {Data: []byte(`foo`)}}, hashfs.WithURLPrefix("/static/"))
+	app := fiber.New()
+	fiberhashfs.Register(app, fsys)
+
+	resp, err := app.Test(httptest.NewRequest("GET", fsys.URL("app.js"), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	} else if got, want := resp.StatusCode, 200; got != want {
+		t.Fatalf("code=%v, want %v", got, want)
+	} else if got, want := string(body), `foo`; got != want {
+		t.Fatalf("body=%q, want %q", got, want)
+	} else if got, want := resp.Header.Get("Cache-Control"), hashfs.DefaultCacheControl; got != want {
+		t.Fatalf("cache-control=%v, want %v", got, want)
+	}
+}
+
+func TestFuncMap(t *testing.T) {
+	fsys := hashfs.NewFS(fstest.MapFS{"app.js": {Data: []byte(`foo`)}}, hashfs.WithHashLength(8))
+	if fn, ok := fiberhashfs.FuncMap(fsys)["hashName"].(func(string) string); !ok {
+		t.Fatal("expected hashName function")
+	} else if got, want := fn("app.js"), "app-2c26b46b.js"; got != want {
+		t.Fatalf("hashName()=%q, want %q", got, want)
+	}
+}
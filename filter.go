@@ -0,0 +1,73 @@
+package hashfs
+
+import (
+	"path"
+	"strings"
+)
+
+// WithInclude returns an option that only gives hash names to files matching
+// at least one of the given glob patterns. Files that do not match are never
+// hashed & are not served by FileServer, although they can still be read by
+// their original names from the file system, such as for parsing templates.
+// Patterns are matched as with WithExclude, which takes precedence.
+func WithInclude(patterns ...string) Option {
+	return func(fsys *FS) {
+		fsys.include = append(fsys.include, patterns...)
+	}
+}
+
+// WithExclude returns an option that never gives hash names to files matching
+// any of the given glob patterns, such as "*.html", "*.map" or ".*" for
+// dotfiles. Excluded files are not served by FileServer but can still be read
+// by their original names from the file system.
+//
+// Patterns use path.Match syntax against paths relative to the wrapped file
+// system. A pattern without a slash matches the base name of a file or of any
+// of its parent directories. Otherwise the pattern must match the whole path,
+// ignoring a leading slash, and a "**" element matches any number of
+// directories (e.g. "drafts/**").
+func WithExclude(patterns ...string) Option {
+	return func(fsys *FS) {
+		fsys.exclude = append(fsys.exclude, patterns...)
+	}
+}
+
+// excluded returns true if the file at name, a path within the underlying
+// file system, is excluded from hashing & serving by WithInclude or
+// WithExclude.
+func (fsys *FS) excluded(name string) bool {
+	if len(fsys.include) == 0 && len(fsys.exclude) == 0 {
+		return false
+	}
+
+	for _, pattern := range fsys.exclude {
+		if matchFilter(pattern, name) {
+			return true
+		}
+	}
+	if len(fsys.include) == 0 {
+		return false
+	}
+	for _, pattern := range fsys.include {
+		if matchFilter(pattern, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchFilter reports whether name matches an include or exclude pattern.
+func matchFilter(pattern, name string) bool {
+	if name == "." {
+		return false
+	} else if strings.Contains(pattern, "/") {
+		return matchGlob(strings.TrimPrefix(pattern, "/"), name)
+	}
+
+	for _, elem := range strings.Split(name, "/") {
+		if ok, _ := path.Match(pattern, elem); ok {
+			return true
+		}
+	}
+	return false
+}
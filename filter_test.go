@@ -0,0 +1,93 @@
+package hashfs_test
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestFS_WithExclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":        {Data: []byte(`<html>`)},
+		"css/main.css":      {Data: []byte(`foo`)},
+		"css/main.css.map":  {Data: []byte(`{}`)},
+		".env":              {Data: []byte(`SECRET=1`)},
+		".git/config":       {Data: []byte(`[core]`)},
+		"drafts/a/post.txt": {Data: []byte(`bar`)},
+	}
+	f := hashfs.NewFS(fsys, hashfs.WithHashLength(8), hashfs.WithExclude("*.html", "*.map", ".*", "/drafts/**"))
+
+	t.Run("HashName", func(t *testing.T) {
+		if got, want := f.HashName("css/main.css"), "css/main-2c26b46b.css"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		}
+		for _, name := range []string{"index.html", "css/main.css.map", ".env", ".git/config", "drafts/a/post.txt"} {
+			if got, want := f.HashName(name), name; got != want {
+				t.Fatalf("HashName(%q)=%q, want %q", name, got, want)
+			} else if _, err := f.HashNameE(name); !errors.Is(err, hashfs.ErrNotHashed) {
+				t.Fatalf("HashNameE(%q): unexpected error: %v", name, err)
+			}
+		}
+	})
+
+	t.Run("Open", func(t *testing.T) {
+		if buf, err := fs.ReadFile(f, "index.html"); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `<html>`; got != want {
+			t.Fatalf("ReadFile()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Names", func(t *testing.T) {
+		if got, want := f.Names(), []string{"css/main.css"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Names()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("FileServer", func(t *testing.T) {
+		h := hashfs.FileServer(f)
+		for _, urlpath := range []string{"/index.html", "/css/main.css.map", "/.env", "/.git/config", "/drafts/a/post.txt"} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", urlpath, nil))
+			if got, want := w.Code, http.StatusNotFound; got != want {
+				t.Fatalf("%s: code=%d, want %d", urlpath, got, want)
+			}
+		}
+
+		// Excluded index files are not used for directories.
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if got, want := w.Code, http.StatusForbidden; got != want {
+			t.Fatalf("code=%d, want %d", got, want)
+		}
+
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/css/main-2c26b46b.css", nil))
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("code=%d, want %d", got, want)
+		}
+	})
+}
+
+func TestFS_WithInclude(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"css/main.css":  {Data: []byte(`foo`)},
+		"css/.hidden":   {Data: []byte(`baz`)},
+		"js/main.js":    {Data: []byte(`bar`)},
+		"templates/a.t": {Data: []byte(`tmpl`)},
+	}, hashfs.WithHashLength(8), hashfs.WithInclude("css", "*.js"), hashfs.WithExclude(".*"))
+
+	if got, want := f.HashedNames(), []string{"css/main-2c26b46b.css", "js/main-fcde2b2e.js"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("HashedNames()=%q, want %q", got, want)
+	} else if got, want := f.HashName("templates/a.t"), "templates/a.t"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	} else if got, want := f.HashName("css/.hidden"), "css/.hidden"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	}
+}
@@ -0,0 +1,25 @@
+// Package ginhashfs provides helpers for serving a hashfs.FS with Gin.
+package ginhashfs
+
+import (
+	"html/template"
+
+	"github.com/benbjohnson/hashfs"
+	"github.com/gin-gonic/gin"
+)
+
+// Register attaches a hashfs.FileServer for fsys to r under the URL prefix
+// set by hashfs.WithURLPrefix. The file server strips the prefix itself.
+// Gin does not allow a catch-all route alongside other routes at the same
+// level so a URL prefix other than "/" should be set.
+func Register(r gin.IRoutes, fsys *hashfs.FS, opts ...hashfs.ServerOption) {
+	h := gin.WrapH(hashfs.FileServer(fsys, opts...))
+	r.GET(fsys.URLPrefix()+"*filepath", h)
+	r.HEAD(fsys.URLPrefix()+"*filepath", h)
+}
+
+// FuncMap returns template functions for referencing files in fsys by their
+// hash names, suitable for gin.Engine.SetFuncMap. See hashfs.FS.FuncMap.
+func FuncMap(fsys *hashfs.FS) template.FuncMap {
+	return fsys.FuncMap()
+}
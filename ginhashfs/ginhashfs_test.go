@@ -0,0 +1,38 @@
+package ginhashfs_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benbjohnson/hashfs"
+	"github.com/benbjohnson/hashfs/ginhashfs"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRegister(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fsys := hashfs.NewFS(fstest.MapFS{"app.js": {Data: []byte(`foo`)}}, hashfs.WithURLPrefix("/static/"))
+	r := gin.New()
+	ginhashfs.Register(r, fsys)
+
+	for _, method := range []string{"GET", "HEAD"} {
+		req, _ := http.NewRequest(method, fsys.URL("app.js"), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("%s: code=%v, want %v", method, got, want)
+		} else if got, want := w.Result().Header.Get("Cache-Control"), hashfs.DefaultCacheControl; got != want {
+			t.Fatalf("%s: cache-control=%v, want %v", method, got, want)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", fsys.URL("app.js"), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if got, want := w.Body.String(), `foo`; got != want {
+		t.Fatalf("body=%q, want %q", got, want)
+	}
+}
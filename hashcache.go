@@ -0,0 +1,130 @@
+package hashfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// WithHashCacheFile returns an option that persists computed hashes to the
+// file at path so that unchanged files are not read & hashed again after a
+// restart. Hashes are loaded when the file system is created and are only
+// used if the size & modification time of the file are unchanged. Hashes are
+// saved when SaveHashCache is called & after Warm completes if any hashes
+// were computed. Errors saving after Warm are passed to the function set by
+// WithOnHashCacheError rather than returned.
+//
+// Files without a modification time, such as those within an embed.FS, and
+// transformed files are always hashed. A missing or unreadable cache file is
+// ignored.
+func WithHashCacheFile(path string) Option {
+	return func(fsys *FS) {
+		fsys.hashCacheFile = path
+	}
+}
+
+// WithOnHashCacheError returns an option that calls fn when Warm cannot save
+// hashes to the file set by WithHashCacheFile, such as to log the error. By
+// default these errors are ignored since they only slow the next startup.
+func WithOnHashCacheError(fn func(err error)) Option {
+	return func(fsys *FS) {
+		fsys.onCacheError = fn
+	}
+}
+
+// hashRecord is the persisted hash of a file within a hash cache file.
+type hashRecord struct {
+	Hash    string    `json:"hash"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// loadHashCache reads the hashes persisted to the hash cache file. Must be
+// called before the file system is used.
+func (fsys *FS) loadHashCache() {
+	buf, err := os.ReadFile(fsys.hashCacheFile)
+	if err != nil {
+		return
+	}
+
+	var m map[string]hashRecord
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return
+	}
+	fsys.cache.stored = m
+}
+
+// storedEntry returns an entry for name from the hash cache file if the file
+// described by fi has not changed since it was hashed. Returns nil otherwise.
+func (fsys *FS) storedEntry(name string, fi fs.FileInfo) *entry {
+	rec, ok := fsys.cache.stored[name]
+	if !ok || fi.ModTime().IsZero() || rec.Size != fi.Size() || !rec.ModTime.Equal(fi.ModTime()) {
+		return nil
+	}
+
+	hash, err := hex.DecodeString(rec.Hash)
+	if err != nil || len(hash) != sha256.Size {
+		return nil
+	}
+	return &entry{name: name, hash: hash, size: rec.Size, modTime: rec.ModTime}
+}
+
+// persisted returns true if e matches the hash loaded from the hash cache file.
+func (fsys *FS) persisted(e *entry) bool {
+	rec, ok := fsys.cache.stored[e.name]
+	return ok && rec.Hash == e.hashHex && rec.Size == e.size && rec.ModTime.Equal(e.modTime)
+}
+
+// SaveHashCache writes the hashes of all cached files to the file set with
+// WithHashCacheFile. Persisted hashes of files that are not currently cached
+// are kept. The file is replaced atomically. This is a no-op if no hash cache
+// file is set.
+func (fsys *FS) SaveHashCache() error {
+	if fsys.hashCacheFile == "" {
+		return nil
+	}
+
+	changes := atomic.LoadInt64(&fsys.cache.changes)
+	m := make(map[string]hashRecord, len(fsys.cache.stored))
+	for name, rec := range fsys.cache.stored {
+		m[name] = rec
+	}
+	fsys.cache.mu.RLock()
+	for name, e := range fsys.cache.m {
+		if !e.modTime.IsZero() {
+			m[name] = hashRecord{Hash: e.hashHex, Size: e.size, ModTime: e.modTime}
+		} else {
+			delete(m, name)
+		}
+	}
+	fsys.cache.mu.RUnlock()
+
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a partially written cache is never read.
+	f, err := os.CreateTemp(filepath.Dir(fsys.hashCacheFile), filepath.Base(fsys.hashCacheFile)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), fsys.hashCacheFile); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&fsys.cache.saved, changes)
+	return nil
+}
@@ -0,0 +1,156 @@
+package hashfs_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestFS_WithHashCacheFile(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		dir, cacheFile := t.TempDir(), filepath.Join(t.TempDir(), "hashes.json")
+		if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte(`foo`), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		f := hashfs.NewFS(os.DirFS(dir), hashfs.WithHashLength(8), hashfs.WithHashCacheFile(cacheFile))
+		if err := f.Warm(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if _, err := os.Stat(cacheFile); err != nil {
+			t.Fatal(err)
+		}
+
+		// Hashes are loaded from the cache file after a restart.
+		f = hashfs.NewFS(os.DirFS(dir), hashfs.WithHashLength(8), hashfs.WithHashCacheFile(cacheFile))
+		if got, want := f.HashName("a.txt"), "a-2c26b46b.txt"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		} else if got, want := f.Stats().BytesHashed, int64(0); got != want {
+			t.Fatalf("BytesHashed=%d, want %d", got, want)
+		}
+
+		// Changed files are hashed again.
+		if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte(`baz`), 0666); err != nil {
+			t.Fatal(err)
+		} else if err := os.Chtimes(filepath.Join(dir, "a.txt"), time.Now(), time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		f = hashfs.NewFS(os.DirFS(dir), hashfs.WithHashLength(8), hashfs.WithHashCacheFile(cacheFile))
+		if got, want := f.HashName("a.txt"), "a-baa5a096.txt"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		} else if got, want := f.Stats().BytesHashed, int64(3); got != want {
+			t.Fatalf("BytesHashed=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("WarmUnchanged", func(t *testing.T) {
+		dir, cacheFile := t.TempDir(), filepath.Join(t.TempDir(), "hashes.json")
+		if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte(`foo`), 0666); err != nil {
+			t.Fatal(err)
+		} else if err := hashfs.NewFS(os.DirFS(dir), hashfs.WithHashCacheFile(cacheFile)).Warm(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Warming with only persisted hashes does not rewrite the file.
+		f := hashfs.NewFS(os.DirFS(dir), hashfs.WithHashCacheFile(cacheFile))
+		if err := os.Remove(cacheFile); err != nil {
+			t.Fatal(err)
+		} else if err := f.Warm(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if _, err := os.Stat(cacheFile); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// New hashes are saved.
+		if err := os.WriteFile(filepath.Join(dir, "b.txt"), []byte(`bar`), 0666); err != nil {
+			t.Fatal(err)
+		} else if err := f.Warm(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if _, err := os.Stat(cacheFile); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("WarmSaveError", func(t *testing.T) {
+		cacheFile := filepath.Join(t.TempDir(), "no", "such", "dir", "hashes.json")
+		mfs := fstest.MapFS{"a.txt": {Data: []byte(`foo`), ModTime: time.Now()}}
+
+		// Failing to persist hashes does not fail warming.
+		var errs []error
+		f := hashfs.NewFS(mfs, hashfs.WithHashCacheFile(cacheFile), hashfs.WithOnHashCacheError(func(err error) {
+			errs = append(errs, err)
+		}))
+		if err := f.Warm(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(errs), 1; got != want {
+			t.Fatalf("len(errs)=%d, want %d", got, want)
+		} else if err := f.SaveHashCache(); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("SaveHashCache", func(t *testing.T) {
+		cacheFile := filepath.Join(t.TempDir(), "hashes.json")
+		modTime := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		mfs := fstest.MapFS{
+			"a.txt": {Data: []byte(`foo`), ModTime: modTime},
+			"b.txt": {Data: []byte(`bar`), ModTime: modTime},
+		}
+
+		f := hashfs.NewFS(mfs, hashfs.WithHashCacheFile(cacheFile))
+		f.HashName("a.txt")
+		if err := f.SaveHashCache(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Persisted hashes of files that were not used are kept.
+		f = hashfs.NewFS(mfs, hashfs.WithHashCacheFile(cacheFile))
+		f.HashName("b.txt")
+		if err := f.SaveHashCache(); err != nil {
+			t.Fatal(err)
+		}
+
+		f = hashfs.NewFS(mfs, hashfs.WithHashCacheFile(cacheFile))
+		f.HashName("a.txt")
+		f.HashName("b.txt")
+		if got, want := f.Stats().BytesHashed, int64(0); got != want {
+			t.Fatalf("BytesHashed=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("NoModTime", func(t *testing.T) {
+		cacheFile := filepath.Join(t.TempDir(), "hashes.json")
+		mfs := fstest.MapFS{"a.txt": {Data: []byte(`foo`)}}
+
+		f := hashfs.NewFS(mfs, hashfs.WithHashCacheFile(cacheFile))
+		if err := f.Warm(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Files without a modification time cannot be validated.
+		f = hashfs.NewFS(mfs, hashfs.WithHashCacheFile(cacheFile))
+		f.HashName("a.txt")
+		if got, want := f.Stats().BytesHashed, int64(3); got != want {
+			t.Fatalf("BytesHashed=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("Corrupt", func(t *testing.T) {
+		cacheFile := filepath.Join(t.TempDir(), "hashes.json")
+		if err := os.WriteFile(cacheFile, []byte(`{`), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		mfs := fstest.MapFS{"a.txt": {Data: []byte(`foo`), ModTime: time.Now()}}
+		f := hashfs.NewFS(mfs, hashfs.WithHashLength(8), hashfs.WithHashCacheFile(cacheFile))
+		if got, want := f.HashName("a.txt"), "a-2c26b46b.txt"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		} else if err := f.SaveHashCache(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
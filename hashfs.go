@@ -1,215 +1,2209 @@
 package hashfs
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
-	"net/http"
+	"math/big"
+	"net/url"
 	"path"
-	"regexp"
-	"strconv"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Ensure file system implements interface.
-var _ fs.FS = (*FS)(nil)
+var (
+	_ Resolver      = (*FS)(nil)
+	_ fs.FS         = (*FS)(nil)
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+	_ fs.StatFS     = (*FS)(nil)
+	_ fs.SubFS      = (*FS)(nil)
+)
+
+// Errors returned when a name cannot be resolved to a file. ErrHashMismatch &
+// ErrNotHashed wrap fs.ErrNotExist so they can be handled as missing files by
+// callers that do not distinguish them. They are reported by ResolveName &
+// passed to FileServer error handlers. Open, ReadFile & Stat report these
+// names as fs.ErrNotExist itself so that os.IsNotExist continues to match.
+var (
+	// ErrHashMismatch is returned when opening a hash name whose hash does
+	// not match the current contents of its original file, such as a
+	// request for an asset from a previous deploy.
+	ErrHashMismatch error = &notExistError{"hash mismatch"}
+
+	// ErrNotHashed is returned when opening a hash name whose original file
+	// exists but is not given a hash name.
+	ErrNotHashed error = &notExistError{"file not hashed"}
+
+	// ErrIsDirectory is returned when computing the hash of a directory.
+	ErrIsDirectory = errors.New("is a directory")
+)
+
+// notExistError is an error that wraps fs.ErrNotExist.
+type notExistError struct {
+	msg string
+}
+
+func (e *notExistError) Error() string { return e.msg }
+func (e *notExistError) Unwrap() error { return fs.ErrNotExist }
 
 // FS represents an fs.FS file system that can optionally use content addressable
 // hashes in the filename. This allows the caller to aggressively cache the
 // data since the filename will change if the data changes.
 type FS struct {
-	fsys fs.FS
+	fsys   fs.FS
+	dir    string // subdirectory within fsys, if created by Sub()
+	format nameFormat
+	cache  *cache
+	names  *sync.Map // hash names by name passed to HashName, see lookupName
+
+	listHashNames bool              // if true, report hash names from ReadDir() & Glob()
+	urlPrefix     string            // path prefix that the file system is served under
+	baseURL       string            // absolute URL prefix used by URL(), if set
+	dev           bool              // if true, hashes are recomputed on every lookup
+	rewriteCSS    bool              // if true, CSS references are rewritten to hash names
+	sourceMaps    bool              // if true, sourceMappingURL comments are rewritten
+	verify        bool              // if true, content read by hash name is verified
+	foldCase      bool              // if true, names are matched case-insensitively
+	eagerWalk     bool              // if true, Walk hashes every file before visiting
+	charset       string            // charset of text content types, if charsetSet
+	hashCacheFile string            // path hashes are persisted to, if set
+	precomputed   map[string]string // hex-encoded digests by path, see WithHashes
+	charsetSet    bool
+	signingKey    []byte // key for signed names, if any
+	contentCache  int64  // max bytes of file contents held in memory
+	maxHashSize   int64  // max size of hashed files, if positive
+	maxDataURI    int64  // max size of files inlined by DataURI, if positive
+	mmapSize      int64  // min size of memory mapped files, if positive
+	maxEntries    int    // max number of cached hashes, if positive
+	warmWorkers   int    // number of files hashed concurrently by Warm
+
+	onChange      func(name, oldHash, newHash string)
+	onHash        func(name, hashName, hash string, data []byte)
+	onCacheError  func(err error)
+	contentTypeFn func(name string) string
+	warmProgress  func(done, total int)
+	transforms    []transform
+	include       []string // patterns of files to hash, if any
+	exclude       []string // patterns of files never hashed
+}
+
+// cache holds the computed hashes for a file system. It is shared between a
+// file system & any sub file systems created from it. All paths are relative
+// to the root of the underlying file system.
+type cache struct {
+	clock       int64 // logical clock for access times; accessed atomically
+	gen         int64 // incremented when entries are removed or files invalidated; accessed atomically
+	slow        int64 // lookups that fell back to the locked maps; accessed atomically
+	dirty       int32 // 1 if m & r contain entries not in snap; accessed atomically
+	evictions   int64 // number of evicted entries; accessed atomically
+	hits        int64 // number of lookups served from cache; accessed atomically
+	misses      int64 // number of hashes computed; accessed atomically
+	bytesHashed int64 // number of bytes hashed; accessed atomically
+	changes     int64 // number of hashes not in the hash cache file when added; accessed atomically
+	saved       int64 // value of changes when the hash cache file was last saved; accessed atomically
+
+	mu     sync.RWMutex
+	snap   atomic.Value                 // *snapshot of m & r, read without locking
+	m      map[string]*entry            // lookup (path to entry)
+	r      map[string]*entry            // reverse lookup (hash path to entry)
+	hashes map[string]map[string]*entry // entries by full & hash name digest, then path
+	prev   map[string]string            // digests of invalidated entries, for change notification
+	dirs   map[string]string            // encoded digests of hashed directories
+	stored map[string]hashRecord        // hashes loaded from the hash cache file; read-only
+	fold   map[string]string            // paths by exact & lowercase path, if built
+
+	calls map[string]*call // in-flight hash computations
+
+	mapsMu sync.Mutex
+	maps   map[string]*mapping // memory mapped files, by path
+
+	requests [1000]int64 // FileServer response counts, by status code; accessed atomically
+
+	dataSize int64 // total size of cached contents, excluding transformed files
+	pending  int   // number of entries added to m & r since snap was published
+}
+
+// snapshot is an immutable copy of the cache's lookup maps. Snapshots are
+// replaced rather than modified so that lookups never lock the cache once
+// every entry has been published. Removing an entry publishes a snapshot
+// immediately. Added entries are published in batches, either once their
+// number exceeds the size of the snapshot or once enough lookups have missed
+// the snapshot, so that the cost of copying the maps is amortized.
+type snapshot struct {
+	m map[string]*entry
+	r map[string]*entry
+}
+
+// entry represents the computed hash for a single file.
+type entry struct {
+	atime    int64       // last access time, by cache clock; accessed atomically
+	name     string      // original path
+	hashName string      // formatted hash path
+	hash     []byte      // raw digest
+	hashHex  string      // hex-encoded digest
+	size     int64       // file size, in bytes
+	data     []byte      // cached or transformed contents, if any
+	info     fs.FileInfo // file info, if contents are held in memory
+	modTime  time.Time   // mod time of the file when hashed, if persisted
+	deps     []string
+}
+
+// NewFS returns a new instance of FS that wraps fsys. Options can be passed
+// to configure the file system.
+func NewFS(fsys fs.FS, opts ...Option) *FS {
+	f := &FS{
+		fsys:   fsys,
+		format: newNameFormat(),
+		names:  new(sync.Map),
+		cache: &cache{
+			m:      make(map[string]*entry),
+			r:      make(map[string]*entry),
+			hashes: make(map[string]map[string]*entry),
+			prev:   make(map[string]string),
+			dirs:   make(map[string]string),
+			calls:  make(map[string]*call),
+		},
+	}
+	f.cache.snap.Store(&snapshot{})
+	for _, opt := range opts {
+		opt(f)
+	}
+	f.format.compile()
+	if f.hashCacheFile != "" {
+		f.loadHashCache()
+	}
+	if f.precomputed != nil {
+		f.loadHashes()
+	}
+	return f
+}
+
+// NewFSFromManifest returns a new instance of FS that wraps fsys and is
+// populated with precomputed hashes from a JSON manifest, as written by
+// WriteManifest. Files within the manifest are not re-hashed.
+func NewFSFromManifest(fsys fs.FS, r io.Reader, opts ...Option) (*FS, error) {
+	var m map[string]ManifestEntry
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+
+	f := NewFS(fsys, opts...)
+	for name, me := range m {
+		hash, err := hex.DecodeString(me.Hash)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid manifest hash for %q: %q", name, me.Hash)
+		} else if me.HashName == "" {
+			return nil, fmt.Errorf("missing manifest hash name for %q", name)
+		}
 
-	mu sync.RWMutex
-	m  map[string]string    // lookup (path to hash path)
-	r  map[string][2]string // reverse lookup (hash path to path)
+		e := &entry{name: name, hashName: me.HashName, hash: hash, hashHex: me.Hash, size: me.Size}
+		f.cache.m[e.name] = e
+		f.cache.r[e.hashName] = e
+		f.indexLocked(e)
+	}
+	f.publishLocked()
+	return f, nil
+}
+
+// WithHashes returns an option that populates the cache with precomputed,
+// hex-encoded SHA-256 digests by path, such as those generated by the
+// hashfsgen command, so that files are not hashed at runtime. Hash names are
+// built using the file system's options. Invalid digests & digests of files
+// that do not exist or are transformed are ignored.
+func WithHashes(hashes map[string]string) Option {
+	return func(fsys *FS) {
+		fsys.precomputed = hashes
+	}
 }
 
-func NewFS(fsys fs.FS) *FS {
-	return &FS{
-		fsys: fsys,
-		m:    make(map[string]string),
-		r:    make(map[string][2]string),
+// loadHashes adds the precomputed hashes to the cache.
+func (fsys *FS) loadHashes() {
+	for name, hashHex := range fsys.precomputed {
+		hash, err := hex.DecodeString(hashHex)
+		if err != nil || len(hash) != sha256.Size || !fs.ValidPath(name) || fsys.transformed(name) {
+			continue
+		}
+		fi, err := fs.Stat(fsys.fsys, name)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+
+		e := &entry{name: name, hash: hash, hashHex: hex.EncodeToString(hash), size: fi.Size()}
+		e.hashName = fsys.format.format(name, fsys.format.encoding.encode(hash)[:fsys.format.length])
+		fsys.cache.m[e.name] = e
+		fsys.cache.r[e.hashName] = e
+		fsys.indexLocked(e)
 	}
+	fsys.publishLocked()
 }
 
+// Option represents a configuration option passed to NewFS.
+type Option func(*FS)
+
 // Open returns a reference to the named file.
 // If name is a hash name then the underlying file is used.
 func (fsys *FS) Open(name string) (fs.File, error) {
-	f, _, err := fsys.open(name)
-	return f, err
+	f, _, _, err := fsys.open(context.Background(), name)
+	return f, notExist(err)
 }
 
-func (fsys *FS) open(name string) (_ fs.File, hash string, err error) {
-	// Parse filename to see if it contains a hash.
-	// If so, check if hash name matches.
-	base, hash := fsys.ParseName(name)
-	if hash != "" && fsys.HashName(base) == name {
-		name = base
+// OpenContext is like Open but stops waiting for hashes to be computed once
+// ctx is done, in which case an error wrapping ctx.Err() is returned. Hashes
+// that are still being computed are cached for later lookups. The underlying
+// file system is not passed ctx so opening the file itself is not interrupted.
+func (fsys *FS) OpenContext(ctx context.Context, name string) (fs.File, error) {
+	f, _, _, err := fsys.open(ctx, name)
+	return f, notExist(err)
+}
+
+// open opens the named file and returns its path within the underlying
+// file system as well as the full digest if name is a hash name.
+func (fsys *FS) open(ctx context.Context, name string) (_ fs.File, path, hash string, err error) {
+	if !fs.ValidPath(name) {
+		return nil, "", "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	path, hash = fsys.resolve(ctx, fsys.path(name))
+	if err := ctx.Err(); err != nil {
+		return nil, path, hash, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	f, err := fsys.openPath(ctx, path)
+	if err != nil {
+		return nil, path, hash, fsys.resolveError("open", name, path, err)
+	} else if fsys.verify && hash != "" {
+		f, err = newVerifyFile(f, name, hash)
+	}
+	return f, path, hash, err
+}
+
+// ResolveName returns the path of the original file for name, which may be a
+// hash name. Unlike Open, the error matches ErrHashMismatch if name is a hash
+// name whose original file now has a different hash, such as a request for an
+// asset from a previous deploy, or ErrNotHashed if the original file is not
+// given a hash name. This allows handlers built on FS to distinguish stale
+// names from missing files.
+func (fsys *FS) ResolveName(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "resolve", Path: name, Err: fs.ErrInvalid}
+	}
+	p, _ := fsys.resolve(context.Background(), fsys.path(name))
+	if _, err := fs.Stat(fsys.fsys, p); err != nil {
+		return "", fsys.resolveError("resolve", name, p, err)
+	}
+	return fsys.rel(p), nil
+}
+
+// notExist returns err with ErrHashMismatch & ErrNotHashed replaced by
+// fs.ErrNotExist since os.IsNotExist only matches fs.ErrNotExist itself.
+func notExist(err error) error {
+	if pe, ok := err.(*fs.PathError); ok && (pe.Err == ErrHashMismatch || pe.Err == ErrNotHashed) {
+		return &fs.PathError{Op: pe.Op, Path: pe.Path, Err: fs.ErrNotExist}
+	}
+	return err
+}
+
+// resolveError returns an error explaining why a hash name could not be
+// resolved if err reports that its path does not exist. The error wraps
+// ErrHashMismatch if the original file has a different hash or ErrNotHashed
+// if the original file exists but could not be hashed. Otherwise returns err.
+func (fsys *FS) resolveError(op, name, path string, err error) error {
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// Only hash names that did not resolve to their original file are checked.
+	if path != fsys.path(name) {
+		return err
+	}
+	base, hash := fsys.parse(path)
+	if hash == "" {
+		return err
+	}
+
+	e, herr := fsys.hash(fsys.fold(base))
+	if errors.Is(herr, fs.ErrNotExist) {
+		return err
+	} else if herr != nil {
+		return &fs.PathError{Op: op, Path: name, Err: ErrNotHashed}
+	} else if e.hashName != path {
+		return &fs.PathError{Op: op, Path: name, Err: ErrHashMismatch}
+	}
+	return err
+}
+
+// openPath opens a path within the underlying file system. Files with
+// cached or transformed contents are served from memory. Other files are
+// returned unwrapped so that *os.File values reach io.Copy & sendfile, unless
+// they are memory mapped.
+func (fsys *FS) openPath(ctx context.Context, name string) (fs.File, error) {
+	if e := fsys.cachedContent(name); e != nil {
+		return &memFile{Reader: bytes.NewReader(e.data), fi: e.info}, nil
+	}
+
+	mmap := fsys.mmapEnabled() && !fsys.transformed(name)
+	if mmap {
+		if f := fsys.openMapped(name); f != nil {
+			return f, nil
+		}
 	}
 
 	f, err := fsys.fsys.Open(name)
-	return f, hash, err
+	if err != nil {
+		return nil, err
+	} else if mmap {
+		return fsys.mapFile(name, f), nil
+	} else if !fsys.transformed(name) {
+		return f, nil
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	} else if fi.IsDir() {
+		return f, nil
+	}
+	f.Close()
+
+	e, err := fsys.hashContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &memFile{Reader: bytes.NewReader(e.data), fi: fi}, nil
 }
 
-// HashName returns the hash name for a path, if exists.
-// Otherwise returns the original path.
-func (fsys *FS) HashName(name string) string {
-	// Lookup cached formatted name, if exists.
-	fsys.mu.RLock()
-	if s := fsys.m[name]; s != "" {
-		fsys.mu.RUnlock()
-		return s
+// ReadFile reads the named file and returns its contents. If name is a hash
+// name then the contents of the underlying file are returned.
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	p, hash := fsys.resolve(context.Background(), fsys.path(name))
+	if e := fsys.cachedContent(p); e != nil {
+		return append([]byte(nil), e.data...), nil
+	} else if !fsys.transformed(p) {
+		buf, err := fs.ReadFile(fsys.fsys, p)
+		if err != nil {
+			return nil, notExist(fsys.resolveError("readfile", name, p, err))
+		} else if fsys.verify && hash != "" {
+			if sum := sha256.Sum256(buf); hex.EncodeToString(sum[:]) != hash {
+				return nil, &fs.PathError{Op: "readfile", Path: name, Err: ErrIntegrity}
+			}
+		}
+		return buf, nil
 	}
-	fsys.mu.RUnlock()
 
-	// Read file contents. Return original filename if we receive an error.
-	buf, err := fs.ReadFile(fsys.fsys, name)
+	e, err := fsys.hash(p)
 	if err != nil {
-		return name
+		return nil, notExist(fsys.resolveError("readfile", name, p, err))
 	}
+	return append([]byte(nil), e.data...), nil
+}
 
-	// Compute hash and build filename.
-	hash := sha256.Sum256(buf)
-	hashhex := hex.EncodeToString(hash[:])
-	hashname := FormatName(name, hashhex)
+// Stat returns file info for the named file. If name is a hash name then the
+// info for the underlying file is returned, reported under the hash name.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	p, hash := fsys.resolve(context.Background(), fsys.path(name))
+	fi, err := fs.Stat(fsys.fsys, p)
+	if err != nil {
+		return nil, notExist(fsys.resolveError("stat", name, p, err))
+	} else if fsys.transformed(p) && !fi.IsDir() {
+		e, err := fsys.hash(p)
+		if err != nil {
+			return nil, err
+		}
+		fi = &memFileInfo{FileInfo: fi, size: e.size}
+	}
+
+	if hash != "" {
+		return &hashFileInfo{FileInfo: fi, name: path.Base(name)}, nil
+	}
+	return fi, nil
+}
 
-	// Store in lookups.
-	fsys.mu.Lock()
-	fsys.m[name] = hashname
-	fsys.r[hashname] = [2]string{name, hashhex}
-	fsys.mu.Unlock()
+// resolve returns the underlying path & full digest for a hash name. If name
+// is not a hash name or the hash does not match then name is returned as-is.
+func (fsys *FS) resolve(ctx context.Context, name string) (_, hash string) {
+	// Parse filename to see if it contains a hash.
+	// If so, check if hash name matches.
+	base, hash := fsys.parse(name)
+	if hash == "" {
+		return fsys.fold(name), ""
+	} else if e, err := fsys.hashContext(ctx, fsys.fold(base)); err == nil && (e.hashName == name || (fsys.foldCase && strings.EqualFold(e.hashName, name))) {
+		// Use the full digest since the name may only contain a truncated hash.
+		return e.name, e.hashHex
+	}
+	return name, hash
+}
 
-	return hashname
+// WithListHashNames returns an option that causes ReadDir & Glob to report
+// hash names for files instead of their original names. Directories are always
+// reported by their original names.
+func WithListHashNames(enabled bool) Option {
+	return func(fsys *FS) {
+		fsys.listHashNames = enabled
+	}
 }
 
-// FormatName returns a hash name that inserts hash before the filename's
-// extension. If no extension exists on filename then the hash is appended.
-// Returns blank string the original filename if hash is blank. Returns a blank
-// string if the filename is blank.
-func FormatName(filename, hash string) string {
-	if filename == "" {
-		return ""
-	} else if hash == "" {
-		return filename
+// ReadDir reads the named directory and returns a list of directory entries
+// sorted by filename. If WithListHashNames is enabled then file entries are
+// reported by their hash names.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	dir := fsys.path(name)
+	entries, err := fs.ReadDir(fsys.fsys, dir)
+	if err != nil || !fsys.listHashNames {
+		return entries, err
 	}
 
-	dir, base := path.Split(filename)
-	if i := strings.Index(base, "."); i != -1 {
-		return path.Join(dir, fmt.Sprintf("%s-%s%s", base[:i], hash, base[i:]))
+	for i, ent := range entries {
+		if ent.IsDir() {
+			continue
+		}
+
+		e, err := fsys.hash(path.Join(dir, ent.Name()))
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = &hashDirEntry{DirEntry: ent, name: path.Base(e.hashName)}
 	}
-	return path.Join(dir, fmt.Sprintf("%s-%s", base, hash))
+
+	// Hash names may change the ordering so the entries must be re-sorted.
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries, nil
 }
 
-// ParseName splits formatted hash filename into its base & hash components.
-func (fsys *FS) ParseName(filename string) (base, hash string) {
-	fsys.mu.RLock()
-	defer fsys.mu.RUnlock()
+// Glob returns the names of all files matching pattern. Patterns are matched
+// against original names. If WithListHashNames is enabled then matching files
+// are reported by their hash names.
+func (fsys *FS) Glob(pattern string) ([]string, error) {
+	if fsys.dir != "" {
+		pattern = path.Join(fsys.dir, pattern)
+	}
 
-	if hashed, ok := fsys.r[filename]; ok {
-		return hashed[0], hashed[1]
+	matches, err := fs.Glob(fsys.fsys, pattern)
+	if err != nil {
+		return nil, err
 	}
 
-	return ParseName(filename)
+	for i, name := range matches {
+		if fsys.listHashNames {
+			if e, err := fsys.hash(name); err == nil {
+				name = e.hashName
+			}
+		}
+		matches[i] = fsys.rel(name)
+	}
+	return matches, nil
 }
 
-// ParseName splits formatted hash filename into its base & hash components.
-func ParseName(filename string) (base, hash string) {
-	if filename == "" {
-		return "", ""
+// hashDirEntry wraps a directory entry to report its hash name.
+type hashDirEntry struct {
+	fs.DirEntry
+	name string
+}
+
+func (e *hashDirEntry) Name() string { return e.name }
+
+func (e *hashDirEntry) Info() (fs.FileInfo, error) {
+	fi, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
 	}
+	return &hashFileInfo{FileInfo: fi, name: e.name}, nil
+}
 
-	dir, base := path.Split(filename)
+// hashFileInfo wraps file info to report its hash name.
+type hashFileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (fi *hashFileInfo) Name() string { return fi.name }
+
+// memFile is an in-memory file with the file info of the file it replaces.
+type memFile struct {
+	*bytes.Reader
+	fi fs.FileInfo
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	return &memFileInfo{FileInfo: f.fi, size: f.Size()}, nil
+}
+func (f *memFile) Close() error { return nil }
+
+// memFileInfo reports the size of in-memory content in place of the original.
+type memFileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (fi *memFileInfo) Size() int64 { return fi.size }
 
-	// Extract pre-hash & extension.
-	pre, ext := base, ""
-	if i := strings.Index(base, "."); i != -1 {
-		pre = base[:i]
-		ext = base[i:]
+// Sub returns a file system rooted at dir. The returned file system is an
+// *FS which shares its hash cache with the parent file system.
+func (fsys *FS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	} else if dir == "." {
+		return fsys, nil
 	}
 
-	// If prehash doesn't contain the hash, then exit.
-	if !hashSuffixRegex.MatchString(pre) {
-		return filename, ""
+	other := *fsys
+	other.dir = fsys.path(dir)
+	other.names = new(sync.Map)
+	return &other, nil
+}
+
+// path returns the path of name within the underlying file system.
+func (fsys *FS) path(name string) string {
+	if fsys.dir == "" || name == "" {
+		return name
+	}
+	return path.Join(fsys.dir, name)
+}
+
+// rel returns the path of name relative to the file system's directory.
+// This is the inverse of path().
+func (fsys *FS) rel(name string) string {
+	if fsys.dir == "" || name == "" {
+		return name
+	} else if name == fsys.dir {
+		return "."
+	}
+	return strings.TrimPrefix(name, fsys.dir+"/")
+}
+
+// HashName returns the hash name for a path, if exists.
+// Otherwise returns the original path. Windows path separators are accepted
+// (e.g. "css\site.css") and the hash name always uses forward slashes.
+func (fsys *FS) HashName(name string) string {
+	hashName, err := fsys.hashName(context.Background(), name)
+	if err != nil {
+		return name
+	}
+	return hashName
+}
+
+// HashNameE returns the hash name for a path. Unlike HashName, an error is
+// returned if the file cannot be read.
+func (fsys *FS) HashNameE(name string) (string, error) {
+	return fsys.hashName(context.Background(), name)
+}
+
+// HashNameContext is like HashNameE but stops waiting for the hash to be
+// computed once ctx is done, in which case ctx.Err() is returned. The hash
+// continues to be computed & is cached for later lookups so that slow file
+// systems, such as network or object storage, do not block requests past
+// their deadline.
+func (fsys *FS) HashNameContext(ctx context.Context, name string) (string, error) {
+	return fsys.hashName(ctx, name)
+}
+
+// hashName returns the hash name for a path relative to the file system.
+// Paths containing backslashes that cannot be read as-is are retried with
+// forward slashes since they are typically built with filepath on Windows.
+// Missing paths are matched case-insensitively, if enabled.
+func (fsys *FS) hashName(ctx context.Context, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "hash", Path: name, Err: fs.ErrInvalid}
+	}
+
+	// Read the generation before hashing so that the result is not indexed
+	// if entries are removed in the meantime.
+	gen := atomic.LoadInt64(&fsys.cache.gen)
+	if hashName, ok := fsys.lookupName(name, gen); ok {
+		return hashName, nil
+	}
+
+	e, err := fsys.hashContext(ctx, fsys.path(name))
+	if err != nil && ctx.Err() == nil && strings.Contains(name, `\`) && fs.ValidPath(toSlash(name)) {
+		if other, oerr := fsys.hashContext(ctx, fsys.path(toSlash(name))); oerr == nil {
+			e, err = other, nil
+		}
+	}
+	if errors.Is(err, fs.ErrNotExist) && fsys.foldCase {
+		if p := fsys.fold(fsys.path(name)); p != fsys.path(name) {
+			e, err = fsys.hashContext(ctx, p)
+		}
+	}
+	if err != nil {
+		return "", err
 	}
 
-	return path.Join(dir, pre[:len(pre)-65]+ext), pre[len(pre)-64:]
+	hashName := fsys.rel(e.hashName)
+	fsys.indexName(name, hashName, gen)
+	return hashName, nil
 }
 
-var hashSuffixRegex = regexp.MustCompile(`-[0-9a-f]{64}`)
+// nameEntry is the hash name of a file within the name index.
+type nameEntry struct {
+	hashName string // relative to the file system
+	gen      int64  // cache generation when indexed
+}
 
-// FileServer returns an http.Handler for serving FS files. It provides a
-// simplified implementation of http.FileServer which is used to aggressively
-// cache files on the client since the file hash is in the filename.
+// lookupName returns the hash name for a path relative to the file system
+// from the name index. The index is keyed by the names passed to HashName so
+// repeated lookups, such as from templates, neither build the full path nor
+// lock the cache. Returns false if the name is not indexed or if entries have
+// been removed from the cache since it was indexed.
 //
-// Because FileServer is focused on small known path files, several features
-// of http.FileServer have been removed including canonicalizing directories,
-// defaulting index.html pages, precondition checks, & content range headers.
-func FileServer(fsys fs.FS) http.Handler {
-	hfsys, ok := fsys.(*FS)
+// The index is not used in development mode, since hashes are recomputed, or
+// when the number of cached names is limited, since entries are evicted.
+func (fsys *FS) lookupName(name string, gen int64) (string, bool) {
+	if fsys.dev || fsys.maxEntries > 0 {
+		return "", false
+	}
+
+	v, ok := fsys.names.Load(name)
 	if !ok {
-		hfsys = NewFS(fsys)
+		return "", false
+	} else if ne := v.(nameEntry); ne.gen == gen {
+		atomic.AddInt64(&fsys.cache.hits, 1)
+		return ne.hashName, true
 	}
-	return &fsHandler{fsys: hfsys}
+	return "", false
 }
 
-type fsHandler struct {
-	fsys *FS
+// indexName adds the hash name for a path to the name index.
+func (fsys *FS) indexName(name, hashName string, gen int64) {
+	if fsys.dev || fsys.maxEntries > 0 {
+		return
+	}
+	fsys.names.Store(name, nameEntry{hashName: hashName, gen: gen})
+}
+
+// toSlash returns name with Windows path separators replaced by forward
+// slashes. Unlike filepath.ToSlash, the conversion applies on all platforms.
+func toSlash(name string) string {
+	return strings.ReplaceAll(name, `\`, "/")
 }
 
-func (h *fsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Clean up filename based on URL path.
-	filename := r.URL.Path
-	if filename == "/" {
-		filename = "."
-	} else {
-		filename = strings.TrimPrefix(filename, "/")
+// MustHashName returns the hash name for a path. Panics if the file cannot be
+// read. This is useful for failing fast on references to missing assets.
+func (fsys *FS) MustHashName(name string) string {
+	s, err := fsys.HashNameE(name)
+	if err != nil {
+		panic(err)
 	}
-	filename = path.Clean(filename)
+	return s
+}
 
-	// Read file from attached file system.
-	f, hash, err := h.fsys.open(filename)
-	if errors.Is(err, fs.ErrNotExist) {
-		http.Error(w, "404 page not found", http.StatusNotFound)
-		return
-	} else if err != nil {
-		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
-		return
+// HashDirName returns the hash name for a directory so that a family of files
+// that reference each other by relative paths, such as a JavaScript bundle &
+// its chunks, can be versioned together. The hash covers the names & contents
+// of all files within the directory and is appended to the directory name
+// with the separator (e.g. "assets/app-HASH/"). A trailing slash is kept.
+// FileServer resolves paths within hashed directories to their original
+// files. Returns the original name if the directory cannot be read.
+func (fsys *FS) HashDirName(name string) string {
+	dir := strings.TrimSuffix(name, "/")
+	if dir == "" || dir == "." || !fs.ValidPath(dir) {
+		return name
 	}
-	defer f.Close()
 
-	// Fetch file info. Disallow directories from being displayed.
-	fi, err := f.Stat()
+	hash, err := fsys.hashDir(fsys.path(dir))
 	if err != nil {
-		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
-		return
-	} else if fi.IsDir() {
-		http.Error(w, "403 Forbidden", http.StatusForbidden)
-		return
+		return name
 	}
+	return dir + fsys.format.sep + hash[:fsys.format.length] + name[len(dir):]
+}
 
-	// Cache the file aggressively if the file contains a hash.
-	if hash != "" {
-		w.Header().Set("Cache-Control", `public, max-age=31536000`)
-		w.Header().Set("ETag", "\""+hash+"\"")
+// BuildHash returns a digest of the names & contents of every file within the
+// file system. It changes whenever any file is added, removed, or modified so
+// it can be used as an application-wide cache key or build identifier, such
+// as a version query parameter for assets served outside of the file system.
+// The digest uses the configured hash encoding.
+func (fsys *FS) BuildHash() (string, error) {
+	return fsys.hashDir(fsys.path("."))
+}
+
+// hashDir returns the encoded digest of the directory at a path within
+// the underlying file system. The digest is computed from the relative path
+// & content hash of every file within the directory.
+func (fsys *FS) hashDir(name string) (string, error) {
+	if !fsys.dev {
+		fsys.cache.mu.RLock()
+		hash, ok := fsys.cache.dirs[name]
+		fsys.cache.mu.RUnlock()
+		if ok {
+			return hash, nil
+		}
 	}
 
-	// Flush header and write content.
-	switch f := f.(type) {
-	case io.ReadSeeker:
-		http.ServeContent(w, r, filename, fi.ModTime(), f.(io.ReadSeeker))
-	default:
-		// Set content length.
-		w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	if fi, err := fs.Stat(fsys.fsys, name); err != nil {
+		return "", err
+	} else if !fi.IsDir() {
+		return "", &fs.PathError{Op: "hash", Path: name, Err: errors.New("not a directory")}
+	}
+
+	h := sha256.New()
+	if err := fs.WalkDir(fsys.fsys, name, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || fsys.excluded(p) {
+			return err
+		}
+		// Files over the maximum size are identified by their size &
+		// modification time instead of their contents.
+		e, err := fsys.hash(p)
+		if errors.Is(err, ErrNotHashed) {
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s\x00%d %d\n", strings.TrimPrefix(p, name+"/"), fi.Size(), fi.ModTime().UnixNano())
+			return nil
+		} else if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%s\n", strings.TrimPrefix(p, name+"/"), e.hashHex)
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	hash := fsys.format.encoding.encode(h.Sum(nil))
+
+	if !fsys.dev {
+		fsys.cache.mu.Lock()
+		fsys.cache.dirs[name] = hash
+		fsys.cache.mu.Unlock()
+	}
+	return hash, nil
+}
+
+// resolveDir returns the original path of a path within a hashed directory.
+// Returns false if name is not within a hashed directory or if the hash does
+// not match the directory's current contents.
+func (fsys *FS) resolveDir(name string) (string, bool) {
+	elems := strings.Split(name, "/")
+	for i := len(elems) - 2; i >= 0; i-- {
+		base, dirHash, ok := fsys.format.matchDir(elems[i])
+		if !ok {
+			continue
+		}
+
+		dir := path.Join(append(elems[:i:i], base)...)
+		if hash, err := fsys.hashDir(dir); err != nil || hash[:len(dirHash)] != dirHash {
+			continue
+		}
+		return path.Join(dir, path.Join(elems[i+1:]...)), true
+	}
+	return name, false
+}
+
+// WithDev returns an option that enables development mode. In development
+// mode, hashes are recomputed on every lookup so that changes to files are
+// reflected immediately and FileServer responds with "Cache-Control: no-cache"
+// for all files. This should not be used in production.
+func WithDev(enabled bool) Option {
+	return func(fsys *FS) {
+		fsys.dev = enabled
+	}
+}
+
+// WithChangeNotifier returns an option that calls fn whenever a file is
+// rehashed and its content has changed, such as after Invalidate or in
+// development mode. The name is relative to the root of the wrapped file
+// system and hashes are hex-encoded digests. This can be used to drive
+// live-reload systems.
+func WithChangeNotifier(fn func(name, oldHash, newHash string)) Option {
+	return func(fsys *FS) {
+		fsys.onChange = fn
+	}
+}
+
+// WithOnHash returns an option that calls fn when a file is first hashed and
+// whenever its content changes. The data is the hashed content, after any
+// transforms, and must not be modified. This can be used to push assets to
+// edge caches or to record checksums. Names are relative to the root of the
+// wrapped file system. Evicted files may be reported again when they are
+// rehashed so fn should be idempotent.
+func WithOnHash(fn func(name, hashName, hash string, data []byte)) Option {
+	return func(fsys *FS) {
+		fsys.onHash = fn
+	}
+}
+
+// WithURLPrefix returns an option that sets the URL path prefix that the file
+// system is served under (e.g. "/static/"). The prefix is prepended to names
+// returned from URL and is automatically stripped by FileServer so the handler
+// does not need to be wrapped with http.StripPrefix.
+func WithURLPrefix(prefix string) Option {
+	return func(fsys *FS) {
+		if prefix != "" {
+			prefix = "/" + strings.Trim(prefix, "/") + "/"
+			if prefix == "//" {
+				prefix = "/"
+			}
+		}
+		fsys.urlPrefix = prefix
+	}
+}
+
+// WithBaseURL returns an option that sets an absolute base URL, such as a CDN
+// location, that is prepended to names returned from URL. This takes
+// precedence over the prefix set by WithURLPrefix for URL but does not affect
+// the paths served by FileServer.
+func WithBaseURL(base string) Option {
+	return func(fsys *FS) {
+		if base != "" && !strings.HasSuffix(base, "/") {
+			base += "/"
+		}
+		fsys.baseURL = base
+	}
+}
+
+// URLPrefix returns the URL path prefix set by WithURLPrefix. Returns "/" if
+// no prefix is set.
+func (fsys *FS) URLPrefix() string {
+	if fsys.urlPrefix == "" {
+		return "/"
+	}
+	return fsys.urlPrefix
+}
+
+// URL returns the URL for the hash name of name, including the base URL set
+// by WithBaseURL or the prefix set by WithURLPrefix. If the file cannot be
+// read then the original name is used instead of the hash name.
+func (fsys *FS) URL(name string) string {
+	return fsys.url(fsys.HashName(name))
+}
+
+// url returns the URL for a hash name relative to the file system's root.
+// Characters that are not allowed in a URL path, such as spaces & non-ASCII
+// characters, are percent-encoded.
+func (fsys *FS) url(hashName string) string {
+	var query string
+	if fsys.format.location == HashLocationQuery {
+		if i := strings.LastIndex(hashName, "?v="); i != -1 {
+			hashName, query = hashName[:i], hashName[i:]
+		}
+	}
+	hashName = (&url.URL{Path: hashName}).EscapedPath() + query
+
+	if fsys.baseURL != "" {
+		return fsys.baseURL + hashName
+	}
+	return fsys.urlPrefix + hashName
+}
+
+// ContentType returns the MIME type for name based on its original extension.
+// Hash names are parsed first so the hash never affects the result. Returns
+// "application/octet-stream" if the type is unknown.
+func (fsys *FS) ContentType(name string) string {
+	base, _ := fsys.ParseName(name)
+	if ctype := fsys.contentType(fsys.path(base)); ctype != "" {
+		return ctype
+	}
+	return "application/octet-stream"
+}
+
+// WithContentType returns an option that sets a function to determine the
+// content type of a file from its original name, relative to the root of the
+// wrapped file system. If fn returns a blank string then the type is
+// determined from the file's extension. This can be used to force types for
+// unusual or proprietary file extensions.
+func WithContentType(fn func(name string) string) Option {
+	return func(fsys *FS) {
+		fsys.contentTypeFn = fn
+	}
+}
 
-		// Flush header and write content.
-		w.WriteHeader(http.StatusOK)
-		if r.Method != "HEAD" {
-			io.Copy(w, f)
+// contentType returns the content type for a path within the underlying file
+// system. Returns a blank string if the type is unknown.
+func (fsys *FS) contentType(name string) string {
+	if fsys.contentTypeFn != nil {
+		if ctype := fsys.contentTypeFn(name); ctype != "" {
+			return ctype
 		}
 	}
+
+	ctype := typeByExtension(path.Ext(name))
+	if fsys.charsetSet {
+		ctype = withCharset(ctype, fsys.charset)
+	}
+	return ctype
+}
+
+// HashOf returns the raw SHA256 digest of the named file.
+func (fsys *FS) HashOf(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "hash", Path: name, Err: fs.ErrInvalid}
+	}
+	e, err := fsys.hash(fsys.path(name))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), e.hash...), nil
+}
+
+// Integrity returns the Subresource Integrity value for the named file.
+// This can be used as the "integrity" attribute on script & link elements.
+func (fsys *FS) Integrity(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "hash", Path: name, Err: fs.ErrInvalid}
+	}
+	e, err := fsys.hash(fsys.path(name))
+	if err != nil {
+		return "", err
+	}
+	return "sha256-" + base64.StdEncoding.EncodeToString(e.hash), nil
+}
+
+// WithWarmConcurrency returns an option that sets the number of files that
+// Warm hashes concurrently. Defaults to GOMAXPROCS.
+func WithWarmConcurrency(n int) Option {
+	return func(fsys *FS) {
+		fsys.warmWorkers = n
+	}
+}
+
+// WithWarmProgress returns an option that calls fn after each file is hashed
+// by Warm with the number of files hashed so far & the total number of files.
+// Calls are serialized so fn does not need to be safe for concurrent use.
+func WithWarmProgress(fn func(done, total int)) Option {
+	return func(fsys *FS) {
+		fsys.warmProgress = fn
+	}
+}
+
+// Warm walks the file system and computes the hash of every file so that
+// later calls to HashName are served from the cache. This is typically called
+// once at startup to avoid hashing files within the request path. Files are
+// hashed concurrently, as set by WithWarmConcurrency, so callbacks such as
+// WithOnHash may be called concurrently. Hashing stops at the first error or
+// when ctx is canceled.
+func (fsys *FS) Warm(ctx context.Context) error {
+	root := fsys.dir
+	if root == "" {
+		root = "."
+	}
+
+	// Collect files first so progress can be reported against the total.
+	var names []string
+	if err := fs.WalkDir(fsys.fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		} else if err := ctx.Err(); err != nil {
+			return err
+		} else if d.IsDir() || fsys.excluded(name) {
+			return nil
+		}
+		names = append(names, name)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	n := fsys.warmWorkers
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	if n > len(names) {
+		n = len(names)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		done     int
+		firstErr error
+	)
+	ch := make(chan string)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range ch {
+				// Files over the maximum size are never hashed.
+				_, err := fsys.hash(name)
+				if errors.Is(err, ErrNotHashed) {
+					err = nil
+				}
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				} else if err == nil {
+					done++
+					if fsys.warmProgress != nil {
+						fsys.warmProgress(done, len(names))
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// Queue files until all are hashed or hashing is stopped.
+	for _, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case ch <- name:
+		case <-ctx.Done():
+		}
+	}
+	close(ch)
+	wg.Wait()
+
+	// Publish every hashed file so later lookups never lock the cache.
+	fsys.cache.mu.Lock()
+	if fsys.cache.pending > 0 {
+		fsys.publishLocked()
+	}
+	fsys.cache.mu.Unlock()
+
+	if firstErr != nil {
+		return firstErr
+	} else if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Persist new hashes. Failing to save only slows the next startup so the
+	// error is reported to the handler, if any, rather than returned.
+	if fsys.hashCacheFile != "" && atomic.LoadInt64(&fsys.cache.changes) != atomic.LoadInt64(&fsys.cache.saved) {
+		if err := fsys.SaveHashCache(); err != nil && fsys.onCacheError != nil {
+			fsys.onCacheError(err)
+		}
+	}
+	return nil
+}
+
+// OpenHash opens the file whose content has the given digest. The digest may
+// be the full hex-encoded SHA-256 digest or the hash as it appears in hash
+// names. Only files whose hashes have already been computed are matched so
+// Warm is typically called at startup. If multiple files have the same content
+// then the first by name is opened. Returns an error matching fs.ErrNotExist
+// if no file matches.
+func (fsys *FS) OpenHash(hash string) (fs.File, error) {
+	f, _, err := fsys.openHash(hash)
+	return f, err
+}
+
+// openHash opens the file whose content matches hash and returns its entry.
+func (fsys *FS) openHash(hash string) (fs.File, *entry, error) {
+	e := fsys.lookupHash(hash)
+	if e == nil {
+		return nil, nil, &fs.PathError{Op: "openhash", Path: hash, Err: fs.ErrNotExist}
+	}
+
+	f, err := fsys.openPath(context.Background(), e.name)
+	if err == nil && fsys.verify {
+		f, err = newVerifyFile(f, fsys.rel(e.name), e.hashHex)
+	}
+	return f, e, err
+}
+
+// PathForHash returns the original name of the file whose content has the
+// given digest, such as a digest reported by an error tracker or seen in a
+// CDN log. The digest may be the full hex-encoded SHA-256 digest or the hash
+// as it appears in hash names. Only files whose hashes have already been
+// computed, such as by Warm, are matched. Returns false if no file matches.
+func (fsys *FS) PathForHash(hash string) (string, bool) {
+	e := fsys.lookupHash(hash)
+	if e == nil {
+		return "", false
+	}
+	return fsys.rel(e.name), true
+}
+
+// lookupHash returns the first cached entry, by name, whose full digest or
+// hash name matches hash. Returns nil if no entry matches.
+func (fsys *FS) lookupHash(hash string) *entry {
+	if hash == "" {
+		return nil
+	}
+
+	fsys.cache.mu.RLock()
+	defer fsys.cache.mu.RUnlock()
+
+	var found *entry
+	for name, e := range fsys.cache.hashes[hash] {
+		if fsys.dir != "" && !strings.HasPrefix(name, fsys.dir+"/") {
+			continue
+		} else if found == nil || name < found.name {
+			found = e
+		}
+	}
+	return found
+}
+
+// Invalidate removes the cached hash for name so that it is recomputed on the
+// next lookup. This allows changed files to be picked up by long-running
+// processes serving from a mutable file system such as os.DirFS.
+// Invalid paths are ignored.
+func (fsys *FS) Invalidate(name string) {
+	if !fs.ValidPath(name) {
+		return
+	}
+	fsys.invalidate(fsys.path(name))
+}
+
+// invalidate removes the cached hash for a path within the underlying file system.
+func (fsys *FS) invalidate(name string) {
+	fsys.cache.mu.Lock()
+	defer fsys.cache.mu.Unlock()
+
+	fsys.invalidateLocked(name)
+}
+
+// invalidateLocked removes the cached hash for name as well as the hashes of
+// any transformed files that reference it. Must be called under write lock.
+func (fsys *FS) invalidateLocked(name string) {
+	if fsys.mmapSize > 0 {
+		fsys.unmap(func(s string) bool { return s == name })
+	}
+	if f, ok := fsys.fsys.(forgetFS); ok {
+		f.forget(func(s string) bool { return s == name })
+	}
+
+	// Remove the hashes of directories containing the file, even if the file
+	// has not been hashed since it may be new.
+	for dir := range fsys.cache.dirs {
+		if dir == "." || name == dir || strings.HasPrefix(name, dir+"/") {
+			delete(fsys.cache.dirs, dir)
+		}
+	}
+	fsys.cache.fold = nil
+	atomic.AddInt64(&fsys.cache.gen, 1)
+
+	e := fsys.cache.m[name]
+	if e == nil {
+		return
+	}
+	delete(fsys.cache.m, name)
+	delete(fsys.cache.r, e.hashName)
+	fsys.unindexLocked(e)
+	fsys.publishLocked()
+	fsys.cache.dataSize -= fsys.contentSize(e)
+	if fsys.onChange != nil || fsys.onHash != nil {
+		fsys.cache.prev[name] = e.hashHex
+	}
+
+	for _, other := range fsys.cache.m {
+		for _, dep := range other.deps {
+			if dep == name {
+				fsys.invalidateLocked(other.name)
+				break
+			}
+		}
+	}
+}
+
+// Reset removes all cached hashes. Because the cache is shared with sub file
+// systems created by Sub, their hashes are removed as well.
+func (fsys *FS) Reset() {
+	fsys.cache.mu.Lock()
+	defer fsys.cache.mu.Unlock()
+
+	if fsys.onChange != nil || fsys.onHash != nil {
+		for name, e := range fsys.cache.m {
+			fsys.cache.prev[name] = e.hashHex
+		}
+	}
+	fsys.cache.m = make(map[string]*entry)
+	fsys.cache.r = make(map[string]*entry)
+	fsys.cache.hashes = make(map[string]map[string]*entry)
+	fsys.cache.dirs = make(map[string]string)
+	fsys.cache.fold = nil
+	fsys.cache.dataSize = 0
+	atomic.AddInt64(&fsys.cache.gen, 1)
+	fsys.publishLocked()
+	fsys.unmap(func(string) bool { return true })
+	if f, ok := fsys.fsys.(forgetFS); ok {
+		f.forget(func(string) bool { return true })
+	}
+}
+
+// contentSize returns the number of bytes that e counts against the content
+// cache limit. Transformed contents are always held and are not counted.
+func (fsys *FS) contentSize(e *entry) int64 {
+	if e.info == nil || fsys.transformed(e.name) {
+		return 0
+	}
+	return int64(len(e.data))
+}
+
+// Names returns the original names of every file in the file system, sorted.
+// The file system is walked on every call so new files are included.
+// Directories that cannot be read are skipped.
+func (fsys *FS) Names() []string {
+	root := fsys.dir
+	if root == "" {
+		root = "."
+	}
+
+	var a []string
+	_ = fs.WalkDir(fsys.fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || fsys.excluded(name) {
+			return nil
+		}
+		a = append(a, fsys.rel(name))
+		return nil
+	})
+	sort.Strings(a)
+	return a
+}
+
+// HashedNames returns the hash names of every file in the file system, in the
+// same order as Names. Files that are not already hashed are hashed first.
+// Files that cannot be read are reported by their original names.
+func (fsys *FS) HashedNames() []string {
+	a := fsys.Names()
+	for i, name := range a {
+		a[i] = fsys.HashName(name)
+	}
+	return a
+}
+
+// WithEagerWalk returns an option that causes Walk to hash every file before
+// calling fn for the first time, as with Warm, so that an unreadable file is
+// reported before any file is visited. By default, each file is hashed when
+// it is visited.
+func WithEagerWalk(enabled bool) Option {
+	return func(fsys *FS) {
+		fsys.eagerWalk = enabled
+	}
+}
+
+// Walk walks the file system in lexical order, calling fn for each file &
+// directory with its name and hash name. Directories are reported with their
+// original name as their hash name, as are files over the size set by
+// WithMaxHashedFileSize. As with fs.WalkDir, fn may return fs.SkipDir to skip
+// a directory. Walk stops at the first file that cannot be hashed and returns
+// its error.
+func (fsys *FS) Walk(fn func(name, hashedName string, d fs.DirEntry) error) error {
+	if fsys.eagerWalk {
+		if err := fsys.Warm(context.Background()); err != nil {
+			return err
+		}
+	}
+
+	root := fsys.dir
+	if root == "" {
+		root = "."
+	}
+
+	return fs.WalkDir(fsys.fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		} else if d.IsDir() {
+			return fn(fsys.rel(name), fsys.rel(name), d)
+		} else if fsys.excluded(name) {
+			return nil
+		}
+
+		e, err := fsys.hash(name)
+		if errors.Is(err, ErrNotHashed) {
+			return fn(fsys.rel(name), fsys.rel(name), d)
+		} else if err != nil {
+			return err
+		}
+		return fn(fsys.rel(name), fsys.rel(e.hashName), d)
+	})
+}
+
+// Manifest returns a mapping of original paths to hash names for all files
+// that have been hashed so far. Call Warm first to include every file.
+func (fsys *FS) Manifest() map[string]string {
+	m := make(map[string]string)
+	for name, e := range fsys.manifest() {
+		m[name] = e.HashName
+	}
+	return m
+}
+
+// ManifestEntries returns the manifest entry of every file that has been
+// hashed so far, keyed by original path. Call Warm first to include every file.
+func (fsys *FS) ManifestEntries() map[string]ManifestEntry {
+	return fsys.manifest()
+}
+
+// ManifestEntry represents a single file within a JSON manifest.
+type ManifestEntry struct {
+	HashName    string `json:"hashName"`
+	Hash        string `json:"hash"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// WriteManifest hashes every file in the file system and writes a JSON object
+// to w mapping each original path to its ManifestEntry.
+func (fsys *FS) WriteManifest(w io.Writer) error {
+	if err := fsys.Warm(context.Background()); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(fsys.manifest())
+}
+
+// manifest returns manifest entries for all cached files within the
+// file system's directory.
+func (fsys *FS) manifest() map[string]ManifestEntry {
+	fsys.cache.mu.RLock()
+	defer fsys.cache.mu.RUnlock()
+
+	m := make(map[string]ManifestEntry, len(fsys.cache.m))
+	for _, e := range fsys.cache.m {
+		if fsys.dir != "" && !strings.HasPrefix(e.name, fsys.dir+"/") {
+			continue
+		}
+
+		m[fsys.rel(e.name)] = ManifestEntry{
+			HashName:    fsys.rel(e.hashName),
+			Hash:        e.hashHex,
+			Size:        e.size,
+			ContentType: fsys.contentType(e.name),
+		}
+	}
+	return m
+}
+
+// hash returns the cached entry for name. If no entry exists then the file
+// is read & its hash is computed and cached. The name must be a path within
+// the underlying file system.
+func (fsys *FS) hash(name string) (*entry, error) {
+	return fsys.hashVisiting(context.Background(), name, nil)
+}
+
+// hashContext is like hash but stops waiting for the hash to be computed once
+// ctx is done.
+func (fsys *FS) hashContext(ctx context.Context, name string) (*entry, error) {
+	return fsys.hashVisiting(ctx, name, nil)
+}
+
+// cached returns the cached entry for a path within the underlying file
+// system. Returns nil if the file has not been hashed.
+func (fsys *FS) cached(name string) *entry {
+	e := fsys.lookup(name, false)
+	if e != nil {
+		fsys.touch(e)
+	}
+	return e
+}
+
+// lookup returns the entry for a path, or for a hash path if reverse is true.
+// The snapshot is used if possible so that the cache is not locked. Returns
+// nil if no entry exists.
+func (fsys *FS) lookup(key string, reverse bool) *entry {
+	// Development mode replaces entries on every lookup so snapshots are not
+	// published. Otherwise a miss is only definitive if every entry has
+	// been published, which must be checked before the snapshot is loaded.
+	if !fsys.dev {
+		clean := atomic.LoadInt32(&fsys.cache.dirty) == 0
+		snap := fsys.cache.snap.Load().(*snapshot)
+		m := snap.m
+		if reverse {
+			m = snap.r
+		}
+		if e := m[key]; e != nil || clean {
+			return e
+		}
+	}
+
+	fsys.cache.mu.RLock()
+	m := fsys.cache.m
+	if reverse {
+		m = fsys.cache.r
+	}
+	e, n := m[key], len(fsys.cache.m)
+	fsys.cache.mu.RUnlock()
+
+	// Publish the pending entries once enough lookups have missed the
+	// snapshot to amortize the cost of copying the maps.
+	if e != nil && !fsys.dev && atomic.AddInt64(&fsys.cache.slow, 1) >= int64(n) {
+		fsys.cache.mu.Lock()
+		if fsys.cache.pending > 0 {
+			fsys.publishLocked()
+		}
+		fsys.cache.mu.Unlock()
+	}
+	return e
+}
+
+// storeLocked adds e to the lookup maps. The snapshot is published if e
+// replaces an existing entry or once the number of pending entries exceeds the
+// size of the snapshot. Must be called under write lock.
+func (fsys *FS) storeLocked(e *entry) {
+	prev, replaced := fsys.cache.m[e.name]
+	if replaced {
+		fsys.unindexLocked(prev)
+	}
+	fsys.cache.m[e.name] = e
+	fsys.cache.r[e.hashName] = e
+	fsys.indexLocked(e)
+	if fsys.dev {
+		return
+	}
+
+	fsys.cache.pending++
+	if replaced || fsys.cache.pending > len(fsys.cache.snap.Load().(*snapshot).m) {
+		fsys.publishLocked()
+		return
+	}
+	atomic.StoreInt32(&fsys.cache.dirty, 1)
+}
+
+// indexLocked adds e to the digest index under both its full digest & the
+// digest within its hash name. Must be called under write lock.
+func (fsys *FS) indexLocked(e *entry) {
+	for _, key := range fsys.hashKeys(e) {
+		m := fsys.cache.hashes[key]
+		if m == nil {
+			m = make(map[string]*entry)
+			fsys.cache.hashes[key] = m
+		}
+		m[e.name] = e
+	}
+}
+
+// unindexLocked removes e from the digest index. Must be called under write
+// lock.
+func (fsys *FS) unindexLocked(e *entry) {
+	for _, key := range fsys.hashKeys(e) {
+		if m := fsys.cache.hashes[key]; m[e.name] == e {
+			delete(m, e.name)
+			if len(m) == 0 {
+				delete(fsys.cache.hashes, key)
+			}
+		}
+	}
+}
+
+// hashKeys returns the digests that e is indexed under.
+func (fsys *FS) hashKeys(e *entry) []string {
+	if _, h := fsys.format.parse(e.hashName); h != "" && h != e.hashHex {
+		return []string{e.hashHex, h}
+	}
+	return []string{e.hashHex}
+}
+
+// publishLocked replaces the snapshot with a copy of the lookup maps. Must be
+// called under write lock.
+func (fsys *FS) publishLocked() {
+	if fsys.dev {
+		return
+	}
+
+	snap := &snapshot{
+		m: make(map[string]*entry, len(fsys.cache.m)),
+		r: make(map[string]*entry, len(fsys.cache.r)),
+	}
+	for k, e := range fsys.cache.m {
+		snap.m[k] = e
+	}
+	for k, e := range fsys.cache.r {
+		snap.r[k] = e
+	}
+	fsys.cache.snap.Store(snap)
+
+	fsys.cache.pending = 0
+	atomic.StoreInt64(&fsys.cache.slow, 0)
+	atomic.StoreInt32(&fsys.cache.dirty, 0)
+}
+
+// touch marks e as recently used. Access times are only tracked if the
+// number of cached hashes is limited.
+func (fsys *FS) touch(e *entry) {
+	if fsys.maxEntries > 0 {
+		atomic.StoreInt64(&e.atime, atomic.AddInt64(&fsys.cache.clock, 1))
+	}
+}
+
+// WithMaxCachedNames returns an option that limits the number of cached
+// hashes to n. Once the limit is reached, the least recently used hashes are
+// evicted and recomputed on their next lookup. This bounds memory usage for
+// very large file systems or when names are influenced by users.
+func WithMaxCachedNames(n int) Option {
+	return func(fsys *FS) {
+		fsys.maxEntries = n
+	}
+}
+
+// evict removes the least recently used entries until the number of cached
+// hashes is within the limit. To amortize the cost of finding the oldest
+// entries, an additional tenth of the limit is evicted at the same time.
+// Must be called under write lock.
+func (fsys *FS) evict() {
+	if fsys.maxEntries <= 0 || len(fsys.cache.m) <= fsys.maxEntries {
+		return
+	}
+
+	entries := make([]*entry, 0, len(fsys.cache.m))
+	for _, e := range fsys.cache.m {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return atomic.LoadInt64(&entries[i].atime) < atomic.LoadInt64(&entries[j].atime)
+	})
+
+	n := len(entries) - fsys.maxEntries + fsys.maxEntries/10
+	if n > len(entries)-1 {
+		n = len(entries) - 1 // always keep the most recent entry
+	}
+	for _, e := range entries[:n] {
+		delete(fsys.cache.m, e.name)
+		delete(fsys.cache.r, e.hashName)
+		fsys.unindexLocked(e)
+		fsys.cache.dataSize -= fsys.contentSize(e)
+	}
+	atomic.AddInt64(&fsys.cache.gen, 1)
+	fsys.publishLocked()
+	atomic.AddInt64(&fsys.cache.evictions, int64(n))
+}
+
+// cachedContent returns the cached entry for name if its contents are held
+// in memory. Returns nil in development mode since files may change.
+func (fsys *FS) cachedContent(name string) *entry {
+	if fsys.dev {
+		return nil
+	} else if e := fsys.cached(name); e != nil && e.info != nil {
+		return e
+	}
+	return nil
+}
+
+// WithContentCache returns an option that holds the contents of files in
+// memory after they are hashed, up to a total of maxBytes. Files are cached in
+// the order they are first hashed and later opens are served from memory.
+// This avoids repeatedly reading from slow file systems such as zip archives
+// or network file systems.
+func WithContentCache(maxBytes int64) Option {
+	return func(fsys *FS) {
+		fsys.contentCache = maxBytes
+	}
+}
+
+// WithMaxHashedFileSize returns an option that skips hashing files larger than
+// n bytes so that large assets, such as videos, are never read into memory.
+// These files are not given hash names and are served by FileServer with the
+// unhashed Cache-Control value. HashNameE returns an error wrapping
+// ErrNotHashed for these files.
+func WithMaxHashedFileSize(n int64) Option {
+	return func(fsys *FS) {
+		fsys.maxHashSize = n
+	}
+}
+
+// hashVisiting computes the hash of name while tracking the set of paths that
+// are currently being transformed so that reference cycles are broken.
+func (fsys *FS) hashVisiting(ctx context.Context, name string, visiting map[string]bool) (*entry, error) {
+	if visiting[name] {
+		return nil, fmt.Errorf("reference cycle: %q", name)
+	}
+
+	// Lookup cached entry, if exists. Development mode always recomputes.
+	if !fsys.dev {
+		if e := fsys.cached(name); e != nil {
+			atomic.AddInt64(&fsys.cache.hits, 1)
+			return e, nil
+		}
+	}
+
+	// Excluded files are never cached so they are only checked on a miss.
+	if fsys.excluded(name) {
+		return nil, &fs.PathError{Op: "hash", Path: name, Err: ErrNotHashed}
+	}
+
+	// Nested lookups from transforms are computed directly to avoid
+	// deadlocks between files that reference each other.
+	if len(visiting) > 0 {
+		return fsys.compute(name, visiting)
+	} else if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Wait for an in-flight computation of the same file, if one exists, so
+	// that concurrent lookups only read & hash the file once.
+	fsys.cache.mu.Lock()
+	if e := fsys.cache.m[name]; e != nil && !fsys.dev {
+		fsys.cache.mu.Unlock()
+		return e, nil
+	} else if c := fsys.cache.calls[name]; c != nil {
+		fsys.cache.mu.Unlock()
+		return c.wait(ctx)
+	}
+	c := &call{done: make(chan struct{})}
+	fsys.cache.calls[name] = c
+	fsys.cache.mu.Unlock()
+
+	// The computation is not canceled with ctx since other lookups may be
+	// waiting on it, so it runs in the background if ctx can be canceled.
+	if ctx.Done() == nil {
+		fsys.run(name, c)
+		return c.e, c.err
+	}
+	go fsys.run(name, c)
+	return c.wait(ctx)
+}
+
+// run computes the hash of name for c & removes c from the in-flight
+// computations once it completes.
+func (fsys *FS) run(name string, c *call) {
+	defer func() {
+		fsys.cache.mu.Lock()
+		delete(fsys.cache.calls, name)
+		fsys.cache.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.e, c.err = fsys.compute(name, nil)
+}
+
+// call represents an in-flight hash computation.
+type call struct {
+	done chan struct{} // closed when the computation completes
+	e    *entry
+	err  error
+}
+
+// wait returns the result of the computation once it completes. Returns
+// ctx.Err() if ctx is done first.
+func (c *call) wait(ctx context.Context) (*entry, error) {
+	select {
+	case <-c.done:
+		return c.e, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// compute reads name & computes its hash, storing the entry in the cache.
+func (fsys *FS) compute(name string, visiting map[string]bool) (*entry, error) {
+	// Read file info if contents may be held in memory.
+	var fi fs.FileInfo
+	if !fsys.dev && (fsys.contentCache > 0 || fsys.transformed(name)) {
+		var err error
+		if fi, err = fs.Stat(fsys.fsys, name); err != nil {
+			return nil, err
+		}
+	}
+
+	// Skip files that are too large to read into memory.
+	if fsys.maxHashSize > 0 {
+		info := fi
+		if info == nil {
+			info, _ = fs.Stat(fsys.fsys, name)
+		}
+		if info != nil && !info.IsDir() && info.Size() > fsys.maxHashSize {
+			if fsys.dev {
+				fsys.invalidate(name)
+			}
+			return nil, &fs.PathError{Op: "hash", Path: name, Err: ErrNotHashed}
+		}
+	}
+
+	// Use the hash from the hash cache file if the file is unchanged. The file
+	// info is read before the contents so that a change made while the file is
+	// read causes it to be hashed again after a restart.
+	var modTime time.Time
+	if fsys.hashCacheFile != "" && !fsys.dev && !fsys.transformed(name) {
+		info := fi
+		if info == nil {
+			info, _ = fs.Stat(fsys.fsys, name)
+		}
+		if info != nil && !info.IsDir() {
+			modTime = info.ModTime()
+			if e := fsys.storedEntry(name, info); e != nil && fi == nil && fsys.onHash == nil {
+				atomic.AddInt64(&fsys.cache.misses, 1)
+				return fsys.addEntry(e, nil, nil), nil
+			}
+		}
+	}
+
+	// Use the digest reported by the underlying file system, if any, so that
+	// the file is not read. Contents are read if they are otherwise needed.
+	if d, ok := fsys.fsys.(digestFS); ok && fi == nil && fsys.onHash == nil && !fsys.transformed(name) {
+		if hash, size, ok := d.digest(name); ok {
+			atomic.AddInt64(&fsys.cache.misses, 1)
+			return fsys.addEntry(&entry{name: name, hash: hash, size: size}, nil, nil), nil
+		}
+	}
+
+	// Read file contents.
+	buf, err := fs.ReadFile(fsys.fsys, name)
+	if err != nil {
+		if fsys.dev {
+			fsys.invalidate(name)
+		}
+		if fi, serr := fs.Stat(fsys.fsys, name); serr == nil && fi.IsDir() {
+			return nil, &fs.PathError{Op: "hash", Path: name, Err: ErrIsDirectory}
+		}
+		return nil, err
+	}
+
+	// Transform contents, if enabled, so the hash reflects the served content.
+	var deps []string
+	if fsys.transformed(name) {
+		if visiting == nil {
+			visiting = make(map[string]bool)
+		}
+		visiting[name] = true
+		rw := &rewriter{fsys: fsys, visiting: visiting}
+		buf, err = rw.transform(name, buf)
+		delete(visiting, name)
+		if err != nil {
+			return nil, err
+		}
+		deps = rw.deps
+	}
+
+	// Compute hash and build filename.
+	atomic.AddInt64(&fsys.cache.misses, 1)
+	atomic.AddInt64(&fsys.cache.bytesHashed, int64(len(buf)))
+	hash := sha256.Sum256(buf)
+	e := &entry{name: name, hash: hash[:], size: int64(len(buf)), modTime: modTime, deps: deps}
+	if fsys.transformed(name) {
+		e.data, e.info = buf, fi
+	}
+	return fsys.addEntry(e, buf, fi), nil
+}
+
+// addEntry formats the hash name of e & stores it in the cache in place of any
+// previous entry for the same file. The contents, buf, are held in memory if
+// they fit within the content cache & are passed to the OnHash callback.
+func (fsys *FS) addEntry(e *entry, buf []byte, fi fs.FileInfo) *entry {
+	name := e.name
+	e.hashHex = hex.EncodeToString(e.hash)
+	e.hashName = fsys.format.format(name, fsys.format.encoding.encode(e.hash)[:fsys.format.length])
+
+	// Store in lookups. Remove the reverse lookup for any previous hash so
+	// that it cannot be resolved once the content changes.
+	fsys.cache.mu.Lock()
+	prevHash, ok := fsys.cache.prev[name]
+	delete(fsys.cache.prev, name)
+	if prev := fsys.cache.m[name]; prev != nil {
+		delete(fsys.cache.r, prev.hashName)
+		atomic.AddInt64(&fsys.cache.gen, 1)
+		fsys.cache.dataSize -= fsys.contentSize(prev)
+		prevHash, ok = prev.hashHex, true
+	}
+	if fi != nil && e.data == nil && fsys.cache.dataSize+int64(len(buf)) <= fsys.contentCache {
+		e.data, e.info = buf, fi
+		fsys.cache.dataSize += int64(len(buf))
+	}
+	fsys.touch(e)
+	fsys.storeLocked(e)
+	if fsys.hashCacheFile != "" && !e.modTime.IsZero() && !fsys.persisted(e) {
+		atomic.AddInt64(&fsys.cache.changes, 1)
+	}
+	fsys.evict()
+	fsys.cache.mu.Unlock()
+
+	// Notify listeners if the content is new or has changed since it was
+	// last hashed.
+	if ok && prevHash != e.hashHex && fsys.onChange != nil {
+		fsys.onChange(name, prevHash, e.hashHex)
+	}
+	if (!ok || prevHash != e.hashHex) && fsys.onHash != nil {
+		fsys.onHash(name, e.hashName, e.hashHex, buf)
+	}
+
+	return e
+}
+
+// HashLocation specifies where the hash is placed within a filename.
+type HashLocation int
+
+const (
+	// HashLocationFirstDot inserts the hash before the first period in the
+	// filename (e.g. "jquery-HASH.min.js"). This is the default.
+	HashLocationFirstDot HashLocation = iota
+
+	// HashLocationBeforeExt inserts the hash before the last extension in the
+	// filename (e.g. "jquery-3.6.0.min-HASH.js").
+	HashLocationBeforeExt
+
+	// HashLocationStart prepends the hash to the filename (e.g. "HASH-main.js").
+	HashLocationStart
+
+	// HashLocationEnd appends the hash to the filename (e.g. "main.js-HASH").
+	HashLocationEnd
+
+	// HashLocationQuery appends the hash as a "v" query parameter (e.g.
+	// "main.js?v=HASH") for proxies that mangle long filenames. FileServer
+	// resolves the hash from the request's query string. The separator is
+	// not used.
+	HashLocationQuery
+)
+
+// WithHashLocation returns an option that sets where the hash is placed
+// within hash names. Defaults to HashLocationFirstDot.
+func WithHashLocation(loc HashLocation) Option {
+	return func(fsys *FS) {
+		fsys.format.location = loc
+	}
+}
+
+// WithHashLength returns an option that limits the hash within hash names to
+// the first n characters of the encoded digest. The full digest is still used
+// for ETags. A length of zero or one larger than the encoded digest uses the
+// full digest.
+func WithHashLength(n int) Option {
+	return func(fsys *FS) {
+		if n <= 0 || n > sha256.Size*2 {
+			n = sha256.Size * 2
+		}
+		fsys.format.length = n
+	}
+}
+
+// WithSeparator returns an option that sets the string placed between the
+// hash & the rest of the filename. Defaults to "-".
+func WithSeparator(sep string) Option {
+	return func(fsys *FS) {
+		fsys.format.sep = sep
+	}
+}
+
+// HashEncoding specifies how the digest is encoded within hash names.
+type HashEncoding int
+
+const (
+	// HashEncodingHex encodes the digest as lowercase hexadecimal using 64
+	// characters. This is the default.
+	HashEncodingHex HashEncoding = iota
+
+	// HashEncodingBase32 encodes the digest as unpadded, lowercase base32
+	// using 52 characters.
+	HashEncodingBase32
+
+	// HashEncodingBase64URL encodes the digest as unpadded, URL-safe base64
+	// using 43 characters. Names are case-sensitive so this should not be
+	// used with case-insensitive file systems or object stores.
+	HashEncodingBase64URL
+
+	// HashEncodingBase36 encodes the digest as lowercase base36 using 50
+	// characters.
+	HashEncodingBase36
+)
+
+// WithHashEncoding returns an option that sets how the digest is encoded
+// within hash names. Shorter encodings reduce the length of URLs. Digests
+// reported by HashOf, manifests, & ETags are always hex-encoded.
+// Defaults to HashEncodingHex.
+func WithHashEncoding(enc HashEncoding) Option {
+	return func(fsys *FS) {
+		fsys.format.encoding = enc
+	}
+}
+
+// base32Encoding is the lowercase, unpadded base32 encoding used in names.
+var base32Encoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// size returns the number of characters in an encoded SHA-256 digest.
+func (enc HashEncoding) size() int {
+	switch enc {
+	case HashEncodingBase32:
+		return base32Encoding.EncodedLen(sha256.Size)
+	case HashEncodingBase64URL:
+		return base64.RawURLEncoding.EncodedLen(sha256.Size)
+	case HashEncodingBase36:
+		return 50
+	default:
+		return hex.EncodedLen(sha256.Size)
+	}
+}
+
+// valid returns true if c is a character of an encoded digest.
+func (enc HashEncoding) valid(c byte) bool {
+	switch enc {
+	case HashEncodingBase32:
+		return (c >= 'a' && c <= 'z') || (c >= '2' && c <= '7')
+	case HashEncodingBase64URL:
+		return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_' || c == '-'
+	case HashEncodingBase36:
+		return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z')
+	default:
+		return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f')
+	}
+}
+
+// encode returns the encoded form of a SHA-256 digest.
+func (enc HashEncoding) encode(hash []byte) string {
+	switch enc {
+	case HashEncodingBase32:
+		return base32Encoding.EncodeToString(hash)
+	case HashEncodingBase64URL:
+		return base64.RawURLEncoding.EncodeToString(hash)
+	case HashEncodingBase36:
+		s := new(big.Int).SetBytes(hash).Text(36)
+		return strings.Repeat("0", enc.size()-len(s)) + s
+	default:
+		return hex.EncodeToString(hash)
+	}
+}
+
+// nameFormat describes how a hash is embedded into a filename.
+type nameFormat struct {
+	location HashLocation
+	encoding HashEncoding
+	length   int    // number of hash characters within the filename
+	sep      string // separator between hash & filename
+}
+
+// newNameFormat returns a name format with the default configuration.
+func newNameFormat() nameFormat {
+	return nameFormat{
+		location: HashLocationFirstDot,
+		length:   sha256.Size * 2,
+		sep:      "-",
+	}
+}
+
+// compile validates the configured hash length. This must be called after
+// the format is configured & before it is used.
+func (f *nameFormat) compile() {
+	if f.length <= 0 || f.length > f.encoding.size() {
+		f.length = f.encoding.size()
+	}
+}
+
+// match splits the base name of a hash name into the prefix, hash, & suffix
+// surrounding the hash. Returns false if base is not a hash name. Names are
+// scanned by hand, rather than with a regular expression, since they are
+// parsed on every request. As with a regular expression, the longest prefix
+// is used if multiple hashes match and the prefix & suffix cannot contain
+// newlines, except for a prefix before the first dot.
+func (f nameFormat) match(base string) (prefix, hash, suffix string, ok bool) {
+	switch f.location {
+	case HashLocationStart:
+		if !f.hashAt(base, 0) || !strings.HasPrefix(base[f.length:], f.sep) {
+			return "", "", "", false
+		}
+		suffix = base[f.length+len(f.sep):]
+		return "", base[:f.length], suffix, !hasNewline(suffix)
+
+	case HashLocationEnd:
+		prefix, hash, ok = f.cutHash(base, f.sep)
+		return prefix, hash, "", ok && !hasNewline(prefix)
+
+	case HashLocationQuery:
+		prefix, hash, ok = f.cutHash(base, "?v=")
+		return prefix, hash, "", ok && !hasNewline(prefix)
+
+	case HashLocationBeforeExt:
+		// The hash may end the name or precede an extension after the last dot.
+		if prefix, hash, ok = f.cutHash(base, f.sep); ok && !hasNewline(prefix) {
+			return prefix, hash, "", true
+		} else if i := strings.LastIndexByte(base, '.'); i != -1 {
+			if prefix, hash, ok = f.cutHash(base[:i], f.sep); ok && !hasNewline(prefix) {
+				return prefix, hash, base[i:], true
+			}
+		}
+		return "", "", "", false
+
+	default:
+		// The prefix cannot contain a dot so it ends at the first dot, at the
+		// latest. The hash must end the name or be followed by a dot so each
+		// candidate end is checked, starting with the last.
+		end := strings.IndexByte(base, '.')
+		if end == -1 {
+			end = len(base)
+		}
+		limit := end + len(f.sep) + f.length
+
+		k := len(base)
+		if k > limit {
+			k = strings.LastIndexByte(base[:limit+1], '.')
+		}
+		for ; k >= 0; k = strings.LastIndexByte(base[:k], '.') {
+			i := k - f.length - len(f.sep)
+			if i < 0 || !strings.HasPrefix(base[i:], f.sep) || !f.hashAt(base, i+len(f.sep)) {
+				continue
+			} else if k == len(base) {
+				return base[:i], base[i+len(f.sep):], "", true
+			} else if !hasNewline(base[k:]) {
+				return base[:i], base[i+len(f.sep) : k], base[k:], true
+			}
+		}
+		return "", "", "", false
+	}
+}
+
+// matchDir splits a hashed directory name into its name & hash. Returns false
+// if name is not a hashed directory name.
+func (f nameFormat) matchDir(name string) (base, hash string, ok bool) {
+	base, hash, ok = f.cutHash(name, f.sep)
+	return base, hash, ok && base != "" && !hasNewline(base)
+}
+
+// cutHash splits s into the prefix & hash if s ends with sep followed by a hash.
+func (f nameFormat) cutHash(s, sep string) (prefix, hash string, ok bool) {
+	i := len(s) - f.length
+	if i < len(sep) || !f.hashAt(s, i) || s[i-len(sep):i] != sep {
+		return "", "", false
+	}
+	return s[:i-len(sep)], s[i:], true
+}
+
+// hashAt returns true if s contains a hash of the configured length at index i.
+func (f nameFormat) hashAt(s string, i int) bool {
+	if i < 0 || i+f.length > len(s) {
+		return false
+	}
+
+	chars := &hashChars[HashEncodingHex]
+	if f.encoding >= 0 && int(f.encoding) < len(hashChars) {
+		chars = &hashChars[f.encoding]
+	}
+	for j := i; j < i+f.length; j++ {
+		if !chars[s[j]] {
+			return false
+		}
+	}
+	return true
+}
+
+// hashChars is a lookup table of the valid characters of each encoding.
+var hashChars = func() (a [HashEncodingBase36 + 1][256]bool) {
+	for enc := range a {
+		for c := range a[enc] {
+			a[enc][c] = HashEncoding(enc).valid(byte(c))
+		}
+	}
+	return a
+}()
+
+// hasNewline returns true if s contains a newline character.
+func hasNewline(s string) bool {
+	return strings.IndexByte(s, '\n') != -1
+}
+
+// defaultFormat is the format used by the package-level FormatName & ParseName.
+var defaultFormat = func() nameFormat {
+	f := newNameFormat()
+	f.compile()
+	return f
+}()
+
+// FormatName returns a hash name that inserts hash before the filename's
+// extension. If no extension exists on filename then the hash is appended.
+// Returns blank string the original filename if hash is blank. Returns a blank
+// string if the filename is blank.
+func FormatName(filename, hash string) string {
+	return defaultFormat.format(filename, hash)
+}
+
+// FormatName returns a hash name for filename using the hash location
+// configured on the file system.
+func (fsys *FS) FormatName(filename, hash string) string {
+	return fsys.format.format(filename, hash)
+}
+
+func (f nameFormat) format(filename, hash string) string {
+	if filename == "" {
+		return ""
+	} else if hash == "" {
+		return filename
+	}
+
+	dir, base := path.Split(filename)
+	switch f.location {
+	case HashLocationStart:
+		return path.Join(dir, hash+f.sep+base)
+	case HashLocationEnd:
+		return path.Join(dir, base+f.sep+hash)
+	case HashLocationQuery:
+		return path.Join(dir, base+"?v="+hash)
+	case HashLocationBeforeExt:
+		if i := strings.LastIndex(base, "."); i != -1 {
+			return path.Join(dir, base[:i]+f.sep+hash+base[i:])
+		}
+		return path.Join(dir, base+f.sep+hash)
+	default:
+		if i := strings.Index(base, "."); i != -1 {
+			return path.Join(dir, base[:i]+f.sep+hash+base[i:])
+		}
+		return path.Join(dir, base+f.sep+hash)
+	}
+}
+
+// ParseName splits formatted hash filename into its base & hash components.
+// If the hash name has previously been computed then the full digest is
+// returned as the hash. Windows path separators are converted to forward
+// slashes.
+func (fsys *FS) ParseName(filename string) (base, hash string) {
+	base, hash = fsys.parse(fsys.path(toSlash(filename)))
+	return fsys.rel(base), hash
+}
+
+// parse splits a hash filename within the underlying file system.
+func (fsys *FS) parse(filename string) (base, hash string) {
+	if e := fsys.lookup(filename, true); e != nil {
+		return e.name, e.hashHex
+	}
+	return fsys.format.parse(filename)
+}
+
+// ParseName splits formatted hash filename into its base & hash components.
+// Windows path separators are converted to forward slashes.
+func ParseName(filename string) (base, hash string) {
+	return defaultFormat.parse(toSlash(filename))
+}
+
+func (f nameFormat) parse(filename string) (base, hash string) {
+	if filename == "" {
+		return "", ""
+	}
+
+	// If the base name doesn't contain the hash, then exit.
+	dir, base := path.Split(filename)
+	prefix, hash, suffix, ok := f.match(base)
+	if !ok {
+		return filename, ""
+	}
+
+	return path.Join(dir, prefix+suffix), hash
+}
+
+// Resolver represents the subset of FS used by templates & components to
+// reference assets. It allows components to be passed a small interface
+// instead of the entire file system.
+type Resolver interface {
+	HashName(name string) string
+	Integrity(name string) (string, error)
+	ContentType(name string) string
+}
+
+// resolverContextKey is the context key for a Resolver.
+type resolverContextKey struct{}
+
+// NewContext returns a copy of ctx that carries r. This allows component
+// libraries such as templ, which pass a context to every component, to
+// resolve asset names without threading the resolver through arguments.
+func NewContext(ctx context.Context, r Resolver) context.Context {
+	return context.WithValue(ctx, resolverContextKey{}, r)
+}
+
+// FromContext returns the Resolver attached to ctx, if any.
+func FromContext(ctx context.Context) Resolver {
+	r, _ := ctx.Value(resolverContextKey{}).(Resolver)
+	return r
 }
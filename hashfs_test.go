@@ -1,12 +1,25 @@
 package hashfs_test
 
 import (
+	"bytes"
+	"context"
 	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/fs"
-	"net/http"
-	"net/http/httptest"
 	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/benbjohnson/hashfs"
 )
@@ -14,6 +27,105 @@ import (
 //go:embed testdata
 var fsys embed.FS
 
+func TestNewFS(t *testing.T) {
+	t.Run("Options", func(t *testing.T) {
+		var n int
+		opt := func(*hashfs.FS) { n++ }
+		if f := hashfs.NewFS(fsys, opt, opt); f == nil {
+			t.Fatal("expected file system")
+		} else if got, want := n, 2; got != want {
+			t.Fatalf("n=%d, want %d", got, want)
+		}
+	})
+}
+
+func TestNewFSFromManifest(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		f, err := hashfs.NewFSFromManifest(fsys, strings.NewReader(`{
+			"testdata/baz.html": {
+				"hashName": "testdata/baz-0123.html",
+				"hash": "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+				"size": 13
+			}
+		}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Hash names should be served from the manifest rather than recomputed.
+		if got, want := f.HashName("testdata/baz.html"), "testdata/baz-0123.html"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		} else if buf, err := fs.ReadFile(f, "testdata/baz-0123.html"); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `<html></html>`; got != want {
+			t.Fatalf("ReadFile()=%q, want %q", got, want)
+		}
+
+		// Files outside the manifest should still be computed.
+		if got, want := f.HashName("testdata/a/foo.txt"), "testdata/a/foo-9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08.txt"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := hashfs.NewFS(fsys).WriteManifest(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := hashfs.NewFSFromManifest(fsys, &buf)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := len(f.Manifest()), 4; got != want {
+			t.Fatalf("len(Manifest())=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("ErrInvalidJSON", func(t *testing.T) {
+		if _, err := hashfs.NewFSFromManifest(fsys, strings.NewReader(`{`)); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("ErrInvalidHash", func(t *testing.T) {
+		if _, err := hashfs.NewFSFromManifest(fsys, strings.NewReader(`{"x":{"hashName":"x-00","hash":"00"}}`)); err == nil || err.Error() != `invalid manifest hash for "x": "00"` {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestFS_WithHashes(t *testing.T) {
+	mfs := fstest.MapFS{"a.txt": {Data: []byte(`foo`)}, "b.css": {Data: []byte(`a{}`)}}
+	hashes := map[string]string{
+		"a.txt":       "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+		"b.css":       "0000000000000000000000000000000000000000000000000000000000000000",
+		"missing.txt": "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+		"invalid.txt": "xyz",
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		f := hashfs.NewFS(mfs, hashfs.WithHashLength(8), hashfs.WithHashes(hashes))
+		if got, want := f.HashName("a.txt"), "a-2c26b46b.txt"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		} else if got, want := f.Stats().BytesHashed, int64(0); got != want {
+			t.Fatalf("BytesHashed=%d, want %d", got, want)
+		} else if got, want := f.ManifestEntries()["a.txt"].Size, int64(3); got != want {
+			t.Fatalf("Size=%d, want %d", got, want)
+		} else if got, want := len(f.Manifest()), 2; got != want {
+			t.Fatalf("len(Manifest())=%d, want %d", got, want)
+		}
+	})
+
+	// Precomputed hashes of transformed files are ignored since the hash
+	// depends on the transformed contents.
+	t.Run("Transformed", func(t *testing.T) {
+		f := hashfs.NewFS(mfs, hashfs.WithHashLength(8), hashfs.WithRewriteCSS(true), hashfs.WithHashes(hashes))
+		if got := f.HashName("b.css"); got == "b-00000000.css" {
+			t.Fatalf("HashName()=%q, want computed hash", got)
+		}
+	})
+}
+
 func TestFormatName(t *testing.T) {
 	t.Run("WithExt", func(t *testing.T) {
 		if got, want := hashfs.FormatName("x.txt", "0000"), "x-0000.txt"; got != want {
@@ -70,6 +182,15 @@ func TestParseName(t *testing.T) {
 		}
 	})
 
+	t.Run("WindowsSeparators", func(t *testing.T) {
+		base, hash := hashfs.ParseName(`css\baz-b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628.html`)
+		if got, want := base, "css/baz.html"; got != want {
+			t.Fatalf("base=%q, want %q", got, want)
+		} else if got, want := hash, "b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628"; got != want {
+			t.Fatalf("base=%q, want %q", got, want)
+		}
+	})
+
 	t.Run("ShortHash", func(t *testing.T) {
 		base, hash := hashfs.ParseName("baz-b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd62.tar.gz")
 		if got, want := base, "baz-b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd62.tar.gz"; got != want {
@@ -98,6 +219,195 @@ func TestParseName(t *testing.T) {
 	})
 }
 
+func TestFS_FormatName(t *testing.T) {
+	for _, tt := range []struct {
+		loc      hashfs.HashLocation
+		filename string
+		want     string
+	}{
+		{hashfs.HashLocationFirstDot, "jquery-3.6.0.min.js", "jquery-3-0000.6.0.min.js"},
+		{hashfs.HashLocationBeforeExt, "jquery-3.6.0.min.js", "jquery-3.6.0.min-0000.js"},
+		{hashfs.HashLocationBeforeExt, "x", "x-0000"},
+		{hashfs.HashLocationStart, "a/x.txt", "a/0000-x.txt"},
+		{hashfs.HashLocationEnd, "a/x.txt", "a/x.txt-0000"},
+		{hashfs.HashLocationQuery, "a/x.txt", "a/x.txt?v=0000"},
+	} {
+		f := hashfs.NewFS(fsys, hashfs.WithHashLocation(tt.loc))
+		if got := f.FormatName(tt.filename, "0000"); got != tt.want {
+			t.Fatalf("FormatName(%q)=%q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestFS_ParseName(t *testing.T) {
+	const hash = "b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628"
+
+	for _, tt := range []struct {
+		loc      hashfs.HashLocation
+		filename string
+		base     string
+	}{
+		{hashfs.HashLocationFirstDot, "jquery-3-" + hash + ".6.0.min.js", "jquery-3.6.0.min.js"},
+		{hashfs.HashLocationBeforeExt, "jquery-3.6.0.min-" + hash + ".js", "jquery-3.6.0.min.js"},
+		{hashfs.HashLocationBeforeExt, "x-" + hash, "x"},
+		{hashfs.HashLocationStart, "a/" + hash + "-x.txt", "a/x.txt"},
+		{hashfs.HashLocationEnd, "a/x.txt-" + hash, "a/x.txt"},
+		{hashfs.HashLocationQuery, "a/x.txt?v=" + hash, "a/x.txt"},
+	} {
+		f := hashfs.NewFS(fsys, hashfs.WithHashLocation(tt.loc))
+		if base, h := f.ParseName(tt.filename); base != tt.base {
+			t.Fatalf("ParseName(%q) base=%q, want %q", tt.filename, base, tt.base)
+		} else if h != hash {
+			t.Fatalf("ParseName(%q) hash=%q, want %q", tt.filename, h, hash)
+		}
+	}
+
+	t.Run("WithSeparator", func(t *testing.T) {
+		f := hashfs.NewFS(fsys, hashfs.WithSeparator("."))
+		if base, h := f.ParseName("a/x." + hash + ".tar.gz"); base != "a/x.tar.gz" {
+			t.Fatalf("base=%q", base)
+		} else if h != hash {
+			t.Fatalf("hash=%q", h)
+		}
+
+		// Default separator should no longer be recognized.
+		if base, h := f.ParseName("a/x-" + hash + ".tar.gz"); base != "a/x-"+hash+".tar.gz" || h != "" {
+			t.Fatalf("ParseName()=(%q,%q)", base, h)
+		}
+	})
+
+	t.Run("NoHash", func(t *testing.T) {
+		f := hashfs.NewFS(fsys, hashfs.WithHashLocation(hashfs.HashLocationStart))
+		if base, hash := f.ParseName("a/x.txt"); base != "a/x.txt" || hash != "" {
+			t.Fatalf("ParseName()=(%q,%q)", base, hash)
+		}
+	})
+}
+
+func BenchmarkParseName(b *testing.B) {
+	b.Run("Hashed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			hashfs.ParseName("assets/css/main-b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628.css")
+		}
+	})
+
+	b.Run("Unhashed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			hashfs.ParseName("assets/css/main.css")
+		}
+	})
+}
+
+func BenchmarkFS_ParseName(b *testing.B) {
+	for _, tt := range []struct {
+		label string
+		loc   hashfs.HashLocation
+		name  string
+	}{
+		{"FirstDot", hashfs.HashLocationFirstDot, "assets/jquery-3-b633a587.6.0.min.js"},
+		{"BeforeExt", hashfs.HashLocationBeforeExt, "assets/jquery-3.6.0.min-b633a587.js"},
+		{"Start", hashfs.HashLocationStart, "assets/b633a587-jquery-3.6.0.min.js"},
+		{"End", hashfs.HashLocationEnd, "assets/jquery-3.6.0.min.js-b633a587"},
+		{"Query", hashfs.HashLocationQuery, "assets/jquery-3.6.0.min.js?v=b633a587"},
+	} {
+		f := hashfs.NewFS(fsys, hashfs.WithHashLocation(tt.loc), hashfs.WithHashLength(8))
+		b.Run(tt.label, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				f.ParseName(tt.name)
+			}
+		})
+	}
+
+	// Hash names that have been computed are resolved from the cache.
+	b.Run("Cached", func(b *testing.B) {
+		f := hashfs.NewFS(fsys, hashfs.WithHashLength(8))
+		name := f.HashName("testdata/baz.html")
+
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				f.ParseName(name)
+			}
+		})
+	})
+}
+
+func BenchmarkFS_HashName(b *testing.B) {
+	mfs := make(fstest.MapFS)
+	for i := 0; i < 1000; i++ {
+		mfs[fmt.Sprintf("assets/js/file%d.js", i)] = &fstest.MapFile{Data: []byte(fmt.Sprint(i))}
+	}
+	f := hashfs.NewFS(mfs, hashfs.WithHashLength(8))
+	if err := f.Warm(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("Serial", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			f.HashName("assets/js/file500.js")
+		}
+	})
+
+	b.Run("Parallel", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				f.HashName("assets/js/file500.js")
+			}
+		})
+	})
+
+	b.Run("Sub", func(b *testing.B) {
+		sub, err := f.Sub("assets")
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sub.(*hashfs.FS).HashName("js/file500.js")
+		}
+	})
+}
+
+func TestFS_WithHashEncoding(t *testing.T) {
+	mfs := fstest.MapFS{"a/main.js": {Data: []byte(`foo`)}}
+	for _, tt := range []struct {
+		enc    hashfs.HashEncoding
+		length int
+		want   string
+	}{
+		{hashfs.HashEncodingHex, 8, "a/main-2c26b46b.js"},
+		{hashfs.HashEncodingBase32, 0, "a/main-fqtli23i77di76m3iu6b2mcbgqjuellqmsb37ihzrjpiqytg46xa.js"},
+		{hashfs.HashEncodingBase32, 10, "a/main-fqtli23i77.js"},
+		{hashfs.HashEncodingBase64URL, 0, "a/main-LCa0a2j_xo_5m0U8HTBBNBNCLXBkg7-g-YpeiGJm564.js"},
+		{hashfs.HashEncodingBase64URL, 10, "a/main-LCa0a2j_xo.js"},
+		{hashfs.HashEncodingBase36, 0, "a/main-13m58g05xad3siu49pluqntiagxetb2c34gdlxq3hznj0wuoj2.js"},
+		{hashfs.HashEncodingBase36, 10, "a/main-13m58g05xa.js"},
+	} {
+		f := hashfs.NewFS(mfs, hashfs.WithHashEncoding(tt.enc), hashfs.WithHashLength(tt.length))
+		if got := f.HashName("a/main.js"); got != tt.want {
+			t.Fatalf("HashName()=%q, want %q", got, tt.want)
+		}
+
+		// Names are parsed using the encoding's alphabet & length.
+		if base, hash := hashfs.NewFS(mfs, hashfs.WithHashEncoding(tt.enc), hashfs.WithHashLength(tt.length)).ParseName(tt.want); base != "a/main.js" {
+			t.Fatalf("ParseName(%q) base=%q", tt.want, base)
+		} else if hash == "" {
+			t.Fatalf("ParseName(%q) expected hash", tt.want)
+		}
+
+		if buf, err := f.ReadFile(tt.want); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `foo`; got != want {
+			t.Fatalf("ReadFile()=%q, want %q", got, want)
+		}
+	}
+}
+
 func TestFS_Name(t *testing.T) {
 	t.Run("Exists", func(t *testing.T) {
 		f := hashfs.NewFS(fsys)
@@ -116,6 +426,1034 @@ func TestFS_Name(t *testing.T) {
 			t.Fatalf("HashName()=%q, want %q", got, want)
 		}
 	})
+
+	t.Run("WithHashLocation", func(t *testing.T) {
+		f := hashfs.NewFS(fsys, hashfs.WithHashLocation(hashfs.HashLocationStart))
+		if got, want := f.HashName("testdata/baz.html"), `testdata/b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628-baz.html`; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		}
+		if buf, err := fs.ReadFile(f, "testdata/b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628-baz.html"); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `<html></html>`; got != want {
+			t.Fatalf("ReadFile()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("WithSeparator", func(t *testing.T) {
+		f := hashfs.NewFS(fsys, hashfs.WithSeparator("~"))
+		if got, want := f.HashName("testdata/baz.html"), `testdata/baz~b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628.html`; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		}
+		if buf, err := fs.ReadFile(hashfs.NewFS(fsys, hashfs.WithSeparator("~")), "testdata/baz~b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628.html"); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `<html></html>`; got != want {
+			t.Fatalf("ReadFile()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("WithHashLength", func(t *testing.T) {
+		f := hashfs.NewFS(fsys, hashfs.WithHashLength(8))
+		if got, want := f.HashName("testdata/baz.html"), `testdata/baz-b633a587.html`; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		}
+		if base, hash := f.ParseName("testdata/baz-b633a587.html"); base != "testdata/baz.html" {
+			t.Fatalf("base=%q", base)
+		} else if got, want := hash, "b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628"; got != want {
+			t.Fatalf("hash=%q, want %q", got, want)
+		}
+	})
+}
+
+func TestFS_HashNameE(t *testing.T) {
+	t.Run("Exists", func(t *testing.T) {
+		if s, err := hashfs.NewFS(fsys).HashNameE("testdata/baz.html"); err != nil {
+			t.Fatal(err)
+		} else if got, want := s, `testdata/baz-b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628.html`; got != want {
+			t.Fatalf("HashNameE()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("NotExists", func(t *testing.T) {
+		if _, err := hashfs.NewFS(fsys).HashNameE("testdata/foobar"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("WindowsSeparators", func(t *testing.T) {
+		f := hashfs.NewFS(fstest.MapFS{
+			"css/site.css": {Data: []byte(`foo`)},
+			`a\b.txt`:      {Data: []byte(`bar`)},
+		}, hashfs.WithHashLength(8))
+		if s, err := f.HashNameE(`css\site.css`); err != nil {
+			t.Fatal(err)
+		} else if got, want := s, "css/site-2c26b46b.css"; got != want {
+			t.Fatalf("HashNameE()=%q, want %q", got, want)
+		} else if got, want := f.HashName(`css\site.css`), "css/site-2c26b46b.css"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		}
+
+		// Names containing backslashes are used as-is if they exist.
+		if got, want := f.HashName(`a\b.txt`), `a\b-fcde2b2e.txt`; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		}
+
+		if got, want := f.HashName(`css\missing.css`), `css\missing.css`; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		} else if base, hash := f.ParseName(`css\site-2c26b46b.css`); base != "css/site.css" || hash != hashHex([]byte(`foo`)) {
+			t.Fatalf("ParseName()=(%q, %q)", base, hash)
+		}
+	})
+}
+
+func TestFS_MustHashName(t *testing.T) {
+	t.Run("NotExists", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("expected panic")
+			}
+		}()
+		hashfs.NewFS(fsys).MustHashName("testdata/foobar")
+	})
+}
+
+func TestFS_HashDirName(t *testing.T) {
+	mfs := fstest.MapFS{
+		"assets/app/main.js":     {Data: []byte(`import "./chunks/a.js";`)},
+		"assets/app/chunks/a.js": {Data: []byte(`foo`)},
+		"assets/other/index.js":  {Data: []byte(`bar`)},
+	}
+	f := hashfs.NewFS(mfs, hashfs.WithHashLength(8))
+
+	name := f.HashDirName("assets/app/")
+	if !regexp.MustCompile(`^assets/app-[0-9a-f]{8}/$`).MatchString(name) {
+		t.Fatalf("unexpected hash dir name: %q", name)
+	} else if got, want := f.HashDirName("assets/app"), strings.TrimSuffix(name, "/"); got != want {
+		t.Fatalf("HashDirName()=%q, want %q", got, want)
+	}
+
+	t.Run("Change", func(t *testing.T) {
+		mfs["assets/app/chunks/a.js"] = &fstest.MapFile{Data: []byte(`baz`)}
+		f.Invalidate("assets/app/chunks/a.js")
+		if got := f.HashDirName("assets/app/"); got == name {
+			t.Fatalf("expected hash dir name to change: %q", got)
+		}
+
+		// New files also change the hash.
+		prev := f.HashDirName("assets/app/")
+		mfs["assets/app/chunks/b.js"] = &fstest.MapFile{Data: []byte(`foo`)}
+		f.Invalidate("assets/app/chunks/b.js")
+		if got := f.HashDirName("assets/app/"); got == prev {
+			t.Fatalf("expected hash dir name to change: %q", got)
+		}
+	})
+
+	t.Run("NotExists", func(t *testing.T) {
+		if got, want := f.HashDirName("assets/missing/"), "assets/missing/"; got != want {
+			t.Fatalf("HashDirName()=%q, want %q", got, want)
+		} else if got, want := f.HashDirName("assets/other/index.js"), "assets/other/index.js"; got != want {
+			t.Fatalf("HashDirName()=%q, want %q", got, want)
+		}
+	})
+}
+
+func TestFS_BuildHash(t *testing.T) {
+	mfs := fstest.MapFS{
+		"a.txt":   {Data: []byte(`foo`)},
+		"b/c.txt": {Data: []byte(`bar`)},
+	}
+	f := hashfs.NewFS(mfs)
+	hash, err := f.BuildHash()
+	if err != nil {
+		t.Fatal(err)
+	} else if got, err := hashfs.NewFS(mfs).BuildHash(); err != nil {
+		t.Fatal(err)
+	} else if got != hash {
+		t.Fatalf("BuildHash()=%q, want %q", got, hash)
+	}
+
+	mfs["a.txt"] = &fstest.MapFile{Data: []byte(`baz`)}
+	f.Invalidate("a.txt")
+	if got, err := f.BuildHash(); err != nil {
+		t.Fatal(err)
+	} else if got == hash {
+		t.Fatalf("expected build hash to change: %q", got)
+	} else {
+		hash = got
+	}
+
+	mfs["b/d.txt"] = &fstest.MapFile{Data: []byte(`foo`)}
+	f.Invalidate("b/d.txt")
+	if got, err := f.BuildHash(); err != nil {
+		t.Fatal(err)
+	} else if got == hash {
+		t.Fatalf("expected build hash to change: %q", got)
+	}
+}
+
+func TestFS_URL(t *testing.T) {
+	t.Run("NoPrefix", func(t *testing.T) {
+		f := hashfs.NewFS(fsys, hashfs.WithHashLength(8))
+		if got, want := f.URL("testdata/baz.html"), "testdata/baz-b633a587.html"; got != want {
+			t.Fatalf("URL()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("WithURLPrefix", func(t *testing.T) {
+		for _, prefix := range []string{"/static/", "static", "/static"} {
+			f := hashfs.NewFS(fsys, hashfs.WithHashLength(8), hashfs.WithURLPrefix(prefix))
+			if got, want := f.URL("testdata/baz.html"), "/static/testdata/baz-b633a587.html"; got != want {
+				t.Fatalf("URL()=%q, want %q", got, want)
+			}
+		}
+	})
+
+	t.Run("WithBaseURL", func(t *testing.T) {
+		f := hashfs.NewFS(fsys, hashfs.WithHashLength(8), hashfs.WithURLPrefix("/assets/"), hashfs.WithBaseURL("https://cdn.example.com/static"))
+		if got, want := f.URL("testdata/baz.html"), "https://cdn.example.com/static/testdata/baz-b633a587.html"; got != want {
+			t.Fatalf("URL()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("NotExists", func(t *testing.T) {
+		f := hashfs.NewFS(fsys, hashfs.WithURLPrefix("/static/"))
+		if got, want := f.URL("testdata/foobar"), "/static/testdata/foobar"; got != want {
+			t.Fatalf("URL()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Escaped", func(t *testing.T) {
+		m := fstest.MapFS{"my files/caf\u00e9 #1.css": {Data: []byte(`foo`)}}
+		f := hashfs.NewFS(m, hashfs.WithHashLength(8), hashfs.WithURLPrefix("/static/"))
+		if got, want := f.HashName("my files/caf\u00e9 #1.css"), "my files/caf\u00e9 #1-2c26b46b.css"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		} else if got, want := f.URL("my files/caf\u00e9 #1.css"), "/static/my%20files/caf%C3%A9%20%231-2c26b46b.css"; got != want {
+			t.Fatalf("URL()=%q, want %q", got, want)
+		}
+
+		// The query separator of query hash names is not escaped.
+		f = hashfs.NewFS(m, hashfs.WithHashLength(8), hashfs.WithHashLocation(hashfs.HashLocationQuery))
+		if got, want := f.URL("my files/caf\u00e9 #1.css"), "my%20files/caf%C3%A9%20%231.css?v=2c26b46b"; got != want {
+			t.Fatalf("URL()=%q, want %q", got, want)
+		}
+	})
+}
+
+func TestFS_ContentType(t *testing.T) {
+	f := hashfs.NewFS(fsys, hashfs.WithHashLocation(hashfs.HashLocationEnd))
+	for _, tt := range []struct {
+		name string
+		want string
+	}{
+		{"testdata/baz.html", "text/html; charset=utf-8"},
+		{f.HashName("testdata/baz.html"), "text/html; charset=utf-8"},
+		{"testdata/a/bar", "application/octet-stream"},
+		{"app.mjs", "text/javascript; charset=utf-8"},
+		{"app.wasm", "application/wasm"},
+		{"font.WOFF2", "font/woff2"},
+	} {
+		if got := f.ContentType(tt.name); got != tt.want {
+			t.Fatalf("ContentType(%q)=%q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFS_WithContentType(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"data.jsonld": {Data: []byte(`{}`)},
+		"app.css":     {Data: []byte(`body{}`)},
+	}, hashfs.WithContentType(func(name string) string {
+		if path.Ext(name) == ".jsonld" {
+			return "application/ld+json"
+		}
+		return ""
+	}))
+
+	if got, want := f.ContentType(f.HashName("data.jsonld")), "application/ld+json"; got != want {
+		t.Fatalf("ContentType()=%q, want %q", got, want)
+	} else if got, want := f.ContentType("app.css"), "text/css; charset=utf-8"; got != want {
+		t.Fatalf("ContentType()=%q, want %q", got, want)
+	}
+}
+
+func TestContext(t *testing.T) {
+	if r := hashfs.FromContext(context.Background()); r != nil {
+		t.Fatalf("unexpected resolver: %v", r)
+	}
+
+	f := hashfs.NewFS(fsys)
+	ctx := hashfs.NewContext(context.Background(), f)
+	if r := hashfs.FromContext(ctx); r != f {
+		t.Fatalf("unexpected resolver: %v", r)
+	} else if got, want := r.HashName("testdata/baz.html"), f.HashName("testdata/baz.html"); got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	}
+}
+
+func TestFS_HashOf(t *testing.T) {
+	t.Run("Exists", func(t *testing.T) {
+		if buf, err := hashfs.NewFS(fsys).HashOf("testdata/baz.html"); err != nil {
+			t.Fatal(err)
+		} else if got, want := hex.EncodeToString(buf), "b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628"; got != want {
+			t.Fatalf("HashOf()=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("NotExists", func(t *testing.T) {
+		if _, err := hashfs.NewFS(fsys).HashOf("testdata/foobar"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestFS_Integrity(t *testing.T) {
+	t.Run("Exists", func(t *testing.T) {
+		if s, err := hashfs.NewFS(fsys).Integrity("testdata/baz.html"); err != nil {
+			t.Fatal(err)
+		} else if got, want := s, "sha256-tjOlh8ZS0COGxPFvjG9qq3NS2X8WNnw8QFdiFDct1ig="; got != want {
+			t.Fatalf("Integrity()=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("NotExists", func(t *testing.T) {
+		if _, err := hashfs.NewFS(fsys).Integrity("testdata/foobar"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestFS_Warm(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		f := hashfs.NewFS(fsys, hashfs.WithHashLength(8))
+		if err := f.Warm(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		// Full digests are only available for cached hash names.
+		if _, hash := f.ParseName("testdata/a/foo-9f86d081.txt"); hash != "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08" {
+			t.Fatalf("unexpected hash: %q", hash)
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := hashfs.NewFS(fsys).Warm(ctx); err != context.Canceled {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Progress", func(t *testing.T) {
+		var a [][2]int
+		f := hashfs.NewFS(fstest.MapFS{
+			"a.txt":   {Data: []byte(`foo`)},
+			"b/c.txt": {Data: []byte(`bar`)},
+			"d.txt":   {Data: []byte(`baz`)},
+		}, hashfs.WithWarmProgress(func(done, total int) {
+			a = append(a, [2]int{done, total})
+		}))
+		if err := f.Warm(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := a, [][2]int{{1, 3}, {2, 3}, {3, 3}}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("progress=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		mfs := make(fstest.MapFS)
+		for i := 0; i < 8; i++ {
+			mfs[fmt.Sprintf("%d.txt", i)] = &fstest.MapFile{Data: []byte(fmt.Sprint(i))}
+		}
+		sfs := &slowFS{FS: mfs, delay: 5 * time.Millisecond}
+		f := hashfs.NewFS(sfs, hashfs.WithWarmConcurrency(4))
+		if err := f.Warm(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(f.Manifest()), 8; got != want {
+			t.Fatalf("len(Manifest())=%d, want %d", got, want)
+		} else if got := atomic.LoadInt64(&sfs.max); got < 2 {
+			t.Fatalf("max concurrent opens=%d, expected concurrency", got)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		f := hashfs.NewFS(fstest.MapFS{
+			"a.txt": {Data: []byte(`foo`)},
+			"b.txt": {Data: []byte(`bar`)},
+		}, hashfs.WithTransform(func(name string, data []byte) ([]byte, error) {
+			if name == "b.txt" {
+				return nil, errors.New("marker")
+			}
+			return data, nil
+		}))
+		if err := f.Warm(context.Background()); err == nil || !strings.Contains(err.Error(), "marker") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestFS_OpenHash(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"b.txt":     {Data: []byte(`foo`)},
+		"a.txt":     {Data: []byte(`foo`)},
+		"sub/c.txt": {Data: []byte(`bar`)},
+	}, hashfs.WithHashLength(8))
+
+	// Files are not hashed on a miss.
+	if _, err := f.OpenHash("2c26b46b"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := f.Warm(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		hash string
+		data string
+		name string
+	}{
+		{hashHex([]byte(`foo`)), "foo", "a.txt"},
+		{"2c26b46b", "foo", "a.txt"},
+		{"fcde2b2e", "bar", "c.txt"},
+	} {
+		file, err := f.OpenHash(tt.hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		if buf, err := io.ReadAll(file); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), tt.data; got != want {
+			t.Fatalf("%s: data=%q, want %q", tt.hash, got, want)
+		} else if fi, err := file.Stat(); err != nil {
+			t.Fatal(err)
+		} else if got, want := fi.Name(), tt.name; got != want {
+			t.Fatalf("%s: Name()=%q, want %q", tt.hash, got, want)
+		}
+	}
+
+	// Sub file systems only match files within their directory.
+	sub, err := f.Sub("sub")
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := sub.(*hashfs.FS).OpenHash("2c26b46b"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, hash := range []string{"", "00000000", "2c26b46"} {
+		if _, err := f.OpenHash(hash); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("%q: unexpected error: %v", hash, err)
+		}
+	}
+}
+
+func TestFS_PathForHash(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"js/app.js":   {Data: []byte(`foo`)},
+		"css/app.css": {Data: []byte(`bar`)},
+	}, hashfs.WithHashLength(8))
+	if err := f.Warm(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		hash string
+		name string
+		ok   bool
+	}{
+		{hashHex([]byte(`foo`)), "js/app.js", true},
+		{"fcde2b2e", "css/app.css", true},
+		{"00000000", "", false},
+		{"", "", false},
+	} {
+		if name, ok := f.PathForHash(tt.hash); name != tt.name || ok != tt.ok {
+			t.Fatalf("%q: PathForHash()=(%q, %v), want (%q, %v)", tt.hash, name, ok, tt.name, tt.ok)
+		}
+	}
+
+	// Names are relative to sub file systems.
+	sub, err := f.Sub("css")
+	if err != nil {
+		t.Fatal(err)
+	} else if name, ok := sub.(*hashfs.FS).PathForHash("fcde2b2e"); name != "app.css" || !ok {
+		t.Fatalf("PathForHash()=(%q, %v)", name, ok)
+	}
+}
+
+func TestFS_Names(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"b.txt":      {Data: []byte(`foo`)},
+		"a/b/c.css":  {Data: []byte(`bar`)},
+		"a.txt":      {Data: []byte(`baz`)},
+		"empty/.dir": {Mode: fs.ModeDir},
+	}, hashfs.WithHashLength(8))
+
+	if got, want := f.Names(), []string{"a.txt", "a/b/c.css", "b.txt"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Names()=%q, want %q", got, want)
+	} else if got, want := f.HashedNames(), []string{"a-baa5a096.txt", "a/b/c-fcde2b2e.css", "b-2c26b46b.txt"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("HashedNames()=%q, want %q", got, want)
+	}
+
+	// Names are relative to sub file systems.
+	sub, err := f.Sub("a")
+	if err != nil {
+		t.Fatal(err)
+	} else if got, want := sub.(*hashfs.FS).HashedNames(), []string{"b/c-fcde2b2e.css"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("HashedNames()=%q, want %q", got, want)
+	}
+}
+
+func TestFS_Walk(t *testing.T) {
+	mfs := fstest.MapFS{
+		"b.txt":     {Data: []byte(`foo`)},
+		"a/b/c.css": {Data: []byte(`bar`)},
+		"a.txt":     {Data: []byte(`baz`)},
+	}
+
+	t.Run("Lazy", func(t *testing.T) {
+		f := hashfs.NewFS(mfs, hashfs.WithHashLength(8))
+
+		var a []string
+		if err := f.Walk(func(name, hashedName string, d fs.DirEntry) error {
+			if name == "a/b/c.css" {
+				if got, want := len(f.Manifest()), 1; got != want {
+					t.Fatalf("len(Manifest())=%d, want %d", got, want)
+				}
+			}
+			a = append(a, name+":"+hashedName)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := a, []string{".:.", "a:a", "a/b:a/b", "a/b/c.css:a/b/c-fcde2b2e.css", "a.txt:a-baa5a096.txt", "b.txt:b-2c26b46b.txt"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Walk()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Eager", func(t *testing.T) {
+		f := hashfs.NewFS(mfs, hashfs.WithHashLength(8), hashfs.WithEagerWalk(true))
+		if err := f.Walk(func(name, hashedName string, d fs.DirEntry) error {
+			if got, want := len(f.Manifest()), 3; got != want {
+				t.Fatalf("len(Manifest())=%d, want %d", got, want)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("SkipDir", func(t *testing.T) {
+		f := hashfs.NewFS(mfs, hashfs.WithHashLength(8))
+
+		var a []string
+		if err := f.Walk(func(name, hashedName string, d fs.DirEntry) error {
+			if name == "a" {
+				return fs.SkipDir
+			} else if !d.IsDir() {
+				a = append(a, hashedName)
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := a, []string{"a-baa5a096.txt", "b-2c26b46b.txt"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Walk()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Sub", func(t *testing.T) {
+		f := hashfs.NewFS(mfs, hashfs.WithHashLength(8))
+		sub, err := f.Sub("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var a []string
+		if err := sub.(*hashfs.FS).Walk(func(name, hashedName string, d fs.DirEntry) error {
+			a = append(a, name+":"+hashedName)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := a, []string{".:.", "b:b", "b/c.css:b/c-fcde2b2e.css"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Walk()=%q, want %q", got, want)
+		}
+	})
+}
+
+func TestFS_WithMaxHashedFileSize(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"small.txt":       {Data: []byte(`foo`)},
+		"video/large.mp4": {Data: []byte(`0123456789`)},
+	}, hashfs.WithHashLength(8), hashfs.WithMaxHashedFileSize(4))
+
+	if got, want := f.HashName("small.txt"), "small-2c26b46b.txt"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	} else if got, want := f.HashName("video/large.mp4"), "video/large.mp4"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	} else if _, err := f.HashNameE("video/large.mp4"); !errors.Is(err, hashfs.ErrNotHashed) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Large files are skipped when warming but are still listed.
+	if err := f.Warm(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if got, want := f.Stats().BytesHashed, int64(3); got != want {
+		t.Fatalf("BytesHashed=%d, want %d", got, want)
+	} else if got, want := f.HashedNames(), []string{"small-2c26b46b.txt", "video/large.mp4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("HashedNames()=%q, want %q", got, want)
+	} else if got := f.HashDirName("video"); got == "video" {
+		t.Fatalf("HashDirName()=%q, expected hash", got)
+	}
+
+}
+
+func TestFS_Invalidate(t *testing.T) {
+	mfs := fstest.MapFS{"a.txt": {Data: []byte(`foo`)}, "b.txt": {Data: []byte(`bar`)}}
+	f := hashfs.NewFS(mfs, hashfs.WithHashLength(8))
+	if got, want := f.HashName("a.txt"), "a-2c26b46b.txt"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	}
+	if got, want := f.HashName("b.txt"), "b-fcde2b2e.txt"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	}
+
+	// Cached hash is returned until invalidated.
+	mfs["a.txt"] = &fstest.MapFile{Data: []byte(`baz`)}
+	mfs["b.txt"] = &fstest.MapFile{Data: []byte(`baz`)}
+	if got, want := f.HashName("a.txt"), "a-2c26b46b.txt"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	}
+
+	f.Invalidate("a.txt")
+	if got, want := f.HashName("a.txt"), "a-baa5a096.txt"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	} else if _, err := f.Open("a-2c26b46b.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if got, want := f.HashName("b.txt"), "b-fcde2b2e.txt"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	}
+
+	f.Reset()
+	if got, want := f.HashName("b.txt"), "b-baa5a096.txt"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	}
+}
+
+func TestFS_Invalidate_Sub(t *testing.T) {
+	mfs := fstest.MapFS{"a/b.txt": {Data: []byte(`foo`)}}
+	f := hashfs.NewFS(mfs, hashfs.WithHashLength(8))
+	sub, err := f.Sub("a")
+	if err != nil {
+		t.Fatal(err)
+	} else if got, want := sub.(*hashfs.FS).HashName("b.txt"), "b-2c26b46b.txt"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	}
+
+	// Invalidating through the parent is reflected by the sub file system.
+	mfs["a/b.txt"] = &fstest.MapFile{Data: []byte(`bar`)}
+	f.Invalidate("a/b.txt")
+	if got, want := sub.(*hashfs.FS).HashName("b.txt"), "b-fcde2b2e.txt"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	}
+
+	mfs["a/b.txt"] = &fstest.MapFile{Data: []byte(`baz`)}
+	f.Reset()
+	if got, want := sub.(*hashfs.FS).HashName("b.txt"), "b-baa5a096.txt"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	}
+}
+
+func TestFS_WithDev(t *testing.T) {
+	mfs := fstest.MapFS{"a.txt": {Data: []byte(`foo`)}}
+	f := hashfs.NewFS(mfs, hashfs.WithDev(true), hashfs.WithHashLength(8))
+	if got, want := f.HashName("a.txt"), "a-2c26b46b.txt"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	}
+
+	// Changes should be reflected immediately & old hash names should no
+	// longer resolve.
+	mfs["a.txt"] = &fstest.MapFile{Data: []byte(`baz`)}
+	if got, want := f.HashName("a.txt"), "a-baa5a096.txt"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	} else if _, hash := f.ParseName("a-2c26b46b.txt"); hash != "2c26b46b" {
+		t.Fatalf("unexpected hash: %q", hash)
+	} else if _, err := f.Open("a-2c26b46b.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Removed files should be dropped from the cache.
+	delete(mfs, "a.txt")
+	if got, want := f.HashName("a.txt"), "a.txt"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	} else if got, want := f.Manifest(), map[string]string{}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Manifest()=%v, want %v", got, want)
+	}
+}
+
+func TestFS_WithChangeNotifier(t *testing.T) {
+	var changes []string
+	mfs := fstest.MapFS{"a.txt": {Data: []byte(`foo`)}, "b.txt": {Data: []byte(`bar`)}}
+	f := hashfs.NewFS(mfs, hashfs.WithChangeNotifier(func(name, oldHash, newHash string) {
+		changes = append(changes, fmt.Sprintf("%s:%s:%s", name, oldHash[:8], newHash[:8]))
+	}))
+	f.HashName("a.txt")
+	f.HashName("b.txt")
+
+	// Unchanged content should not notify.
+	f.Invalidate("a.txt")
+	f.HashName("a.txt")
+	if len(changes) != 0 {
+		t.Fatalf("unexpected changes: %v", changes)
+	}
+
+	mfs["a.txt"] = &fstest.MapFile{Data: []byte(`baz`)}
+	f.Invalidate("a.txt")
+	f.HashName("a.txt")
+	if got, want := changes, []string{"a.txt:2c26b46b:baa5a096"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes=%v, want %v", got, want)
+	}
+
+	mfs["b.txt"] = &fstest.MapFile{Data: []byte(`baz`)}
+	f.Reset()
+	f.HashName("b.txt")
+	if got, want := changes, []string{"a.txt:2c26b46b:baa5a096", "b.txt:fcde2b2e:baa5a096"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes=%v, want %v", got, want)
+	}
+}
+
+func TestFS_WithOnHash(t *testing.T) {
+	var hashes []string
+	mfs := fstest.MapFS{"css/main.css": {Data: []byte(`foo`)}}
+	f := hashfs.NewFS(mfs, hashfs.WithHashLength(8), hashfs.WithOnHash(func(name, hashName, hash string, data []byte) {
+		hashes = append(hashes, fmt.Sprintf("%s:%s:%s:%s", name, hashName, hash[:8], data))
+	}))
+	f.HashName("css/main.css")
+	f.HashName("css/main.css")
+	if got, want := hashes, []string{"css/main.css:css/main-2c26b46b.css:2c26b46b:foo"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("hashes=%v, want %v", got, want)
+	}
+
+	// Rehashing unchanged content should not notify.
+	f.Invalidate("css/main.css")
+	f.HashName("css/main.css")
+	if got, want := len(hashes), 1; got != want {
+		t.Fatalf("len(hashes)=%d, want %d", got, want)
+	}
+
+	mfs["css/main.css"] = &fstest.MapFile{Data: []byte(`bar`)}
+	f.Invalidate("css/main.css")
+	f.HashName("css/main.css")
+	if got, want := hashes[len(hashes)-1], "css/main.css:css/main-fcde2b2e.css:fcde2b2e:bar"; got != want {
+		t.Fatalf("hash=%q, want %q", got, want)
+	}
+}
+
+func TestFS_WithContentCache(t *testing.T) {
+	cfs := &countingFS{FS: fstest.MapFS{
+		"a.txt": {Data: []byte(`foo`)},
+		"b.txt": {Data: []byte(`bar`)},
+	}}
+	f := hashfs.NewFS(cfs, hashfs.WithContentCache(5))
+	f.HashName("a.txt")
+	f.HashName("b.txt")
+
+	readFile := func(name string) string {
+		t.Helper()
+		file, err := f.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		buf, err := io.ReadAll(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf)
+	}
+
+	// Only the first file fits within the limit.
+	n := cfs.n
+	if got, want := readFile(f.HashName("a.txt")), "foo"; got != want {
+		t.Fatalf("Open()=%q, want %q", got, want)
+	} else if got, want := cfs.n, n; got != want {
+		t.Fatalf("opens=%d, want %d", got, want)
+	}
+	if got, want := readFile("b.txt"), "bar"; got != want {
+		t.Fatalf("Open()=%q, want %q", got, want)
+	} else if got, want := cfs.n, n+1; got != want {
+		t.Fatalf("opens=%d, want %d", got, want)
+	}
+
+	// Invalidating a file releases its space for other files.
+	f.Invalidate("a.txt")
+	f.Invalidate("b.txt")
+	f.HashName("b.txt")
+	n = cfs.n
+	if got, want := readFile("b.txt"), "bar"; got != want {
+		t.Fatalf("Open()=%q, want %q", got, want)
+	} else if got, want := cfs.n, n; got != want {
+		t.Fatalf("opens=%d, want %d", got, want)
+	}
+}
+
+func TestFS_WithMaxCachedNames(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"a.txt": {Data: []byte(`foo`)},
+		"b.txt": {Data: []byte(`bar`)},
+		"c.txt": {Data: []byte(`baz`)},
+	}, hashfs.WithHashLength(8), hashfs.WithMaxCachedNames(2))
+
+	f.HashName("a.txt")
+	f.HashName("b.txt")
+	f.HashName("a.txt") // mark as recently used
+	f.HashName("c.txt")
+
+	if got, want := f.Manifest(), map[string]string{"a.txt": "a-2c26b46b.txt", "c.txt": "c-baa5a096.txt"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Manifest()=%v, want %v", got, want)
+	} else if stats := f.Stats(); stats.Entries != 2 || stats.Evictions != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// Evicted names are recomputed on lookup.
+	if got, want := f.HashName("b.txt"), "b-fcde2b2e.txt"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	}
+}
+
+func TestFS_Concurrent(t *testing.T) {
+	mfs := make(fstest.MapFS)
+	for i := 0; i < 50; i++ {
+		mfs[fmt.Sprintf("%d.txt", i)] = &fstest.MapFile{Data: []byte(fmt.Sprint(i))}
+	}
+	f := hashfs.NewFS(mfs, hashfs.WithHashLength(8))
+
+	// Lookups run concurrently with invalidations & resets. Every hash name
+	// must resolve to its original name while it is cached.
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				name := fmt.Sprintf("%d.txt", (i*7+j)%50)
+				hashName := f.HashName(name)
+				if base, _ := f.ParseName(hashName); base != name {
+					t.Errorf("ParseName(%q)=%q, want %q", hashName, base, name)
+					return
+				}
+			}
+		}(i)
+	}
+
+	for i := 0; i < 100; i++ {
+		f.Invalidate(fmt.Sprintf("%d.txt", i%50))
+		if i%25 == 0 {
+			f.Reset()
+		}
+	}
+	if err := f.Warm(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(done)
+	wg.Wait()
+
+	if got, want := f.Stats().Entries, 50; got != want {
+		t.Fatalf("Entries=%d, want %d", got, want)
+	}
+}
+
+func TestFS_HashNameContext(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		f := hashfs.NewFS(fstest.MapFS{"a.txt": {Data: []byte(`foo`)}}, hashfs.WithHashLength(8))
+		if name, err := f.HashNameContext(context.Background(), "a.txt"); err != nil {
+			t.Fatal(err)
+		} else if got, want := name, "a-2c26b46b.txt"; got != want {
+			t.Fatalf("HashNameContext()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("DeadlineExceeded", func(t *testing.T) {
+		release := make(chan struct{})
+		bfs := &blockingFS{FS: fstest.MapFS{"a.txt": {Data: []byte(`foo`)}}, release: release}
+		f := hashfs.NewFS(bfs, hashfs.WithHashLength(8))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := f.HashNameContext(ctx, "a.txt"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// The hash is computed in the background & cached once the file
+		// system responds.
+		close(release)
+		if got, want := f.HashName("a.txt"), "a-2c26b46b.txt"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		} else if got, want := atomic.LoadInt64(&bfs.n), int64(1); got != want {
+			t.Fatalf("opens=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		f := hashfs.NewFS(fstest.MapFS{"a.txt": {Data: []byte(`foo`)}}, hashfs.WithHashLength(8))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := f.HashNameContext(ctx, "a.txt"); !errors.Is(err, context.Canceled) {
+			t.Fatalf("unexpected error: %v", err)
+		} else if got, want := f.Stats().Misses, int64(0); got != want {
+			t.Fatalf("Misses=%d, want %d", got, want)
+		}
+	})
+}
+
+func TestFS_OpenContext(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		f := hashfs.NewFS(fstest.MapFS{"a.txt": {Data: []byte(`foo`)}}, hashfs.WithHashLength(8))
+		file, err := f.OpenContext(context.Background(), "a-2c26b46b.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		if buf, err := io.ReadAll(file); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `foo`; got != want {
+			t.Fatalf("Read()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("DeadlineExceeded", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		bfs := &blockingFS{FS: fstest.MapFS{"a.txt": {Data: []byte(`foo`)}}, release: release}
+		f := hashfs.NewFS(bfs, hashfs.WithHashLength(8))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := f.OpenContext(ctx, "a-2c26b46b.txt"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestFS_HashName_Concurrent(t *testing.T) {
+	release := make(chan struct{})
+	bfs := &blockingFS{FS: fstest.MapFS{"a.txt": {Data: []byte(`foo`)}}, release: release}
+	f := hashfs.NewFS(bfs, hashfs.WithHashLength(8))
+
+	var wg sync.WaitGroup
+	names := make([]string, 10)
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			names[i] = f.HashName("a.txt")
+		}(i)
+	}
+
+	// Allow lookups to queue up behind the first read before releasing it.
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, name := range names {
+		if got, want := name, "a-2c26b46b.txt"; got != want {
+			t.Fatalf("%d. HashName()=%q, want %q", i, got, want)
+		}
+	}
+	if got, want := atomic.LoadInt64(&bfs.n), int64(1); got != want {
+		t.Fatalf("opens=%d, want %d", got, want)
+	}
+}
+
+// blockingFS wraps a file system and blocks calls to Open until release is
+// closed. The number of calls to Open is counted.
+type blockingFS struct {
+	n int64 // accessed atomically
+	fs.FS
+	release chan struct{}
+}
+
+func (fsys *blockingFS) Open(name string) (fs.File, error) {
+	atomic.AddInt64(&fsys.n, 1)
+	<-fsys.release
+	return fsys.FS.Open(name)
+}
+
+// slowFS wraps a file system and delays calls to Open for files. The maximum
+// number of concurrent calls is tracked.
+type slowFS struct {
+	n, max int64 // accessed atomically
+	fs.FS
+	delay time.Duration
+}
+
+func (fsys *slowFS) Open(name string) (fs.File, error) {
+	if path.Ext(name) == "" {
+		return fsys.FS.Open(name)
+	}
+
+	n := atomic.AddInt64(&fsys.n, 1)
+	defer atomic.AddInt64(&fsys.n, -1)
+	for {
+		if max := atomic.LoadInt64(&fsys.max); n <= max || atomic.CompareAndSwapInt64(&fsys.max, max, n) {
+			break
+		}
+	}
+	time.Sleep(fsys.delay)
+	return fsys.FS.Open(name)
+}
+
+func TestFS_Manifest(t *testing.T) {
+	f := hashfs.NewFS(fsys, hashfs.WithHashLength(8))
+	if got, want := f.Manifest(), map[string]string{}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Manifest()=%v, want %v", got, want)
+	}
+
+	f.HashName("testdata/baz.html")
+	if got, want := f.Manifest(), map[string]string{"testdata/baz.html": "testdata/baz-b633a587.html"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Manifest()=%v, want %v", got, want)
+	}
+}
+
+func TestFS_WriteManifest(t *testing.T) {
+	sub, err := hashfs.NewFS(fsys, hashfs.WithHashLength(8)).Sub("testdata/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := sub.(*hashfs.FS).WriteManifest(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var m map[string]hashfs.ManifestEntry
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	} else if got, want := m, map[string]hashfs.ManifestEntry{
+		"bar": {
+			HashName: "bar-e3b0c442",
+			Hash:     "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			Size:     0,
+		},
+		"foo.txt": {
+			HashName:    "foo-9f86d081.txt",
+			Hash:        "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+			Size:        4,
+			ContentType: "text/plain; charset=utf-8",
+		},
+	}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("manifest=%#v, want %#v", got, want)
+	}
 }
 
 func TestFS_Open(t *testing.T) {
@@ -156,91 +1494,243 @@ func TestFS_Open(t *testing.T) {
 	})
 }
 
-func TestFileServer(t *testing.T) {
+func TestFS_ReadFile(t *testing.T) {
 	t.Run("NoHash", func(t *testing.T) {
-		r, _ := http.NewRequest("GET", "testdata/baz.html", nil)
-		w := httptest.NewRecorder()
-		h := hashfs.FileServer(fsys)
-		h.ServeHTTP(w, r)
-
-		hdr := w.Result().Header
-		if got, want := w.Code, 200; got != want {
-			t.Fatalf("code=%v, want %v", got, want)
-		} else if got, want := hdr.Get("Cache-Control"), ``; got != want {
-			t.Fatalf("cache-control=%v, want %v", got, want)
-		} else if got, want := hdr.Get("Content-Type"), `text/html; charset=utf-8`; got != want {
-			t.Fatalf("content-type=%v, want %v", got, want)
-		} else if got, want := hdr.Get("Content-Length"), `13`; got != want {
-			t.Fatalf("content-length=%v, want %v", got, want)
-		} else if got, want := hdr.Get("ETag"), ""; got != want {
-			t.Fatalf("etag=%v, want %v", got, want)
-		} else if got, want := w.Body.String(), `<html></html>`; got != want {
-			t.Fatalf("body=%q, want %q", got, want)
+		if buf, err := hashfs.NewFS(fsys).ReadFile("testdata/baz.html"); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `<html></html>`; got != want {
+			t.Fatalf("ReadFile()=%q, want %q", got, want)
 		}
 	})
 
 	t.Run("WithHash", func(t *testing.T) {
-		r, _ := http.NewRequest("GET", "testdata/baz-b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628.html", nil)
-		h := hashfs.FileServer(fsys)
-		hash := "\"b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628\""
-
-		for i := 0; i < 2; i++ {
-			w := httptest.NewRecorder()
-			h.ServeHTTP(w, r)
-
-			hdr := w.Result().Header
-			if got, want := w.Code, 200; got != want {
-				t.Fatalf("code=%v, want %v", got, want)
-			} else if got, want := hdr.Get("Cache-Control"), `public, max-age=31536000`; got != want {
-				t.Fatalf("cache-control=%v, want %v", got, want)
-			} else if got, want := hdr.Get("Content-Type"), `text/html; charset=utf-8`; got != want {
-				t.Fatalf("content-type=%v, want %v", got, want)
-			} else if got, want := hdr.Get("Content-Length"), `13`; got != want {
-				t.Fatalf("content-length=%v, want %v", got, want)
-			} else if got, want := hdr.Get("ETag"), hash; got != want {
-				t.Fatalf("etag=%v, want %v", got, want)
-			} else if got, want := w.Body.String(), `<html></html>`; got != want {
-				t.Fatalf("body=%q, want %q", got, want)
-			}
+		if buf, err := hashfs.NewFS(fsys).ReadFile("testdata/baz-b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628.html"); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `<html></html>`; got != want {
+			t.Fatalf("ReadFile()=%q, want %q", got, want)
 		}
 	})
 
-	t.Run("NotFound", func(t *testing.T) {
-		r, _ := http.NewRequest("GET", "nosuchfile", nil)
-		w := httptest.NewRecorder()
-		h := hashfs.FileServer(fsys)
-		h.ServeHTTP(w, r)
+	t.Run("WithMismatchHash", func(t *testing.T) {
+		if _, err := hashfs.NewFS(fsys).ReadFile("testdata/baz-0000000000000000000000000000000000000000000000000000000000000000.html"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
 
-		if got, want := w.Code, 404; got != want {
-			t.Fatalf("code=%v, want %v", got, want)
-		} else if got, want := w.Body.String(), "404 page not found\n"; got != want {
-			t.Fatalf("body=%q, want %q", got, want)
+func TestFS_Stat(t *testing.T) {
+	t.Run("NoHash", func(t *testing.T) {
+		if fi, err := fs.Stat(hashfs.NewFS(fsys), "testdata/baz.html"); err != nil {
+			t.Fatal(err)
+		} else if got, want := fi.Name(), "baz.html"; got != want {
+			t.Fatalf("Name()=%q, want %q", got, want)
+		} else if got, want := fi.Size(), int64(13); got != want {
+			t.Fatalf("Size()=%d, want %d", got, want)
 		}
 	})
 
-	t.Run("Dir", func(t *testing.T) {
-		r, _ := http.NewRequest("GET", "testdata", nil)
-		w := httptest.NewRecorder()
-		h := hashfs.FileServer(fsys)
-		h.ServeHTTP(w, r)
+	t.Run("WithHash", func(t *testing.T) {
+		if fi, err := fs.Stat(hashfs.NewFS(fsys, hashfs.WithHashLength(8)), "testdata/baz-b633a587.html"); err != nil {
+			t.Fatal(err)
+		} else if got, want := fi.Name(), "baz-b633a587.html"; got != want {
+			t.Fatalf("Name()=%q, want %q", got, want)
+		} else if got, want := fi.Size(), int64(13); got != want {
+			t.Fatalf("Size()=%d, want %d", got, want)
+		}
+	})
 
-		if got, want := w.Code, 403; got != want {
-			t.Fatalf("code=%v, want %v", got, want)
-		} else if got, want := w.Body.String(), "403 Forbidden\n"; got != want {
-			t.Fatalf("body=%q, want %q", got, want)
+	t.Run("NotExists", func(t *testing.T) {
+		if _, err := fs.Stat(hashfs.NewFS(fsys), "nosuchfile"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("unexpected error: %v", err)
 		}
 	})
+}
 
-	t.Run("Root", func(t *testing.T) {
-		r, _ := http.NewRequest("GET", "/", nil)
-		w := httptest.NewRecorder()
-		h := hashfs.FileServer(fsys)
-		h.ServeHTTP(w, r)
+func TestFS_Errors(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"a.txt":     {Data: []byte(`foo`)},
+		"dir/b.txt": {Data: []byte(`bar`)},
+	}, hashfs.WithHashLength(8))
 
-		if got, want := w.Code, 403; got != want {
-			t.Fatalf("code=%v, want %v", got, want)
-		} else if got, want := w.Body.String(), "403 Forbidden\n"; got != want {
-			t.Fatalf("body=%q, want %q", got, want)
+	for _, tt := range []struct {
+		name string
+		err  error
+	}{
+		{"a-00000000.txt", hashfs.ErrHashMismatch},
+		{"dir-2c26b46b", hashfs.ErrNotHashed},
+		{"missing-2c26b46b.txt", fs.ErrNotExist},
+		{"missing.txt", fs.ErrNotExist},
+	} {
+		if _, err := f.ResolveName(tt.name); !errors.Is(err, tt.err) {
+			t.Fatalf("%s: ResolveName() err=%v, want %v", tt.name, err, tt.err)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("%s: ResolveName() err=%v, want not exist", tt.name, err)
+		}
+
+		// The fs.FS methods report every unresolved name as missing.
+		if _, err := f.Open(tt.name); !os.IsNotExist(err) {
+			t.Fatalf("%s: Open() err=%v, want not exist", tt.name, err)
+		} else if _, err := f.ReadFile(tt.name); !os.IsNotExist(err) {
+			t.Fatalf("%s: ReadFile() err=%v, want not exist", tt.name, err)
+		} else if _, err := f.Stat(tt.name); !os.IsNotExist(err) {
+			t.Fatalf("%s: Stat() err=%v, want not exist", tt.name, err)
+		}
+	}
+
+	// Missing files are not reported as stale or unhashed.
+	if _, err := f.ResolveName("missing-2c26b46b.txt"); errors.Is(err, hashfs.ErrHashMismatch) || errors.Is(err, hashfs.ErrNotHashed) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if name, err := f.ResolveName(f.HashName("dir/b.txt")); err != nil {
+		t.Fatal(err)
+	} else if got, want := name, "dir/b.txt"; got != want {
+		t.Fatalf("ResolveName()=%q, want %q", got, want)
+	}
+
+	if _, err := f.HashNameE("dir"); !errors.Is(err, hashfs.ErrIsDirectory) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFS_ReadDir(t *testing.T) {
+	t.Run("OriginalNames", func(t *testing.T) {
+		entries, err := fs.ReadDir(hashfs.NewFS(fsys), "testdata")
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := direntNames(entries), []string{"a", "baz.html", "x.y"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("names=%v, want %v", got, want)
 		}
 	})
+
+	t.Run("HashNames", func(t *testing.T) {
+		entries, err := fs.ReadDir(hashfs.NewFS(fsys, hashfs.WithListHashNames(true), hashfs.WithHashLength(8)), "testdata")
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := direntNames(entries), []string{"a", "baz-b633a587.html", "x.y"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("names=%v, want %v", got, want)
+		}
+
+		if fi, err := entries[1].Info(); err != nil {
+			t.Fatal(err)
+		} else if got, want := fi.Name(), "baz-b633a587.html"; got != want {
+			t.Fatalf("Info().Name()=%q, want %q", got, want)
+		} else if got, want := fi.Size(), int64(13); got != want {
+			t.Fatalf("Info().Size()=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("NotExists", func(t *testing.T) {
+		if _, err := fs.ReadDir(hashfs.NewFS(fsys), "nosuchdir"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestFS_Glob(t *testing.T) {
+	t.Run("OriginalNames", func(t *testing.T) {
+		if matches, err := fs.Glob(hashfs.NewFS(fsys), "testdata/*.html"); err != nil {
+			t.Fatal(err)
+		} else if got, want := matches, []string{"testdata/baz.html"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Glob()=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("HashNames", func(t *testing.T) {
+		f := hashfs.NewFS(fsys, hashfs.WithListHashNames(true), hashfs.WithHashLength(8))
+		if matches, err := fs.Glob(f, "testdata/*"); err != nil {
+			t.Fatal(err)
+		} else if got, want := matches, []string{"testdata/a", "testdata/baz-b633a587.html", "testdata/x.y"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Glob()=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Sub", func(t *testing.T) {
+		sub, err := hashfs.NewFS(fsys).Sub("testdata")
+		if err != nil {
+			t.Fatal(err)
+		} else if matches, err := fs.Glob(sub, "a/*.txt"); err != nil {
+			t.Fatal(err)
+		} else if got, want := matches, []string{"a/foo.txt"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Glob()=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrBadPattern", func(t *testing.T) {
+		if _, err := fs.Glob(hashfs.NewFS(fsys), "testdata/["); !errors.Is(err, path.ErrBadPattern) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestFS_Sub(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		f := hashfs.NewFS(fsys, hashfs.WithHashLength(8))
+		sub, err := fs.Sub(f, "testdata")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hsub, ok := sub.(*hashfs.FS)
+		if !ok {
+			t.Fatalf("unexpected type: %T", sub)
+		} else if got, want := hsub.HashName("baz.html"), `baz-b633a587.html`; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		}
+
+		if buf, err := fs.ReadFile(sub, "baz-b633a587.html"); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `<html></html>`; got != want {
+			t.Fatalf("ReadFile()=%q, want %q", got, want)
+		}
+
+		// Parent should share the cache with the sub file system.
+		if _, hash := f.ParseName("testdata/baz-b633a587.html"); hash != "b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628" {
+			t.Fatalf("unexpected hash: %q", hash)
+		}
+	})
+
+	t.Run("Nested", func(t *testing.T) {
+		sub, err := hashfs.NewFS(fsys).Sub("testdata")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub, err = sub.(*hashfs.FS).Sub("a")
+		if err != nil {
+			t.Fatal(err)
+		} else if _, err := fs.ReadFile(sub, "foo.txt"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("ErrInvalid", func(t *testing.T) {
+		if _, err := hashfs.NewFS(fsys).Sub("../testdata"); !errors.Is(err, fs.ErrInvalid) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// Paths outside of the sub file system are rejected.
+	t.Run("ParentPath", func(t *testing.T) {
+		sub, err := hashfs.NewFS(fsys).Sub("testdata/a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		hsub := sub.(*hashfs.FS)
+
+		if _, err := hsub.HashNameE("../baz.html"); !errors.Is(err, fs.ErrInvalid) {
+			t.Fatalf("unexpected error: %v", err)
+		} else if got, want := hsub.HashName("../baz.html"), "../baz.html"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		} else if _, err := hsub.HashOf("../baz.html"); !errors.Is(err, fs.ErrInvalid) {
+			t.Fatalf("unexpected error: %v", err)
+		} else if _, err := hsub.Integrity("../baz.html"); !errors.Is(err, fs.ErrInvalid) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func direntNames(entries []fs.DirEntry) []string {
+	a := make([]string, len(entries))
+	for i := range entries {
+		a[i] = entries[i].Name()
+	}
+	return a
 }
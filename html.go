@@ -0,0 +1,368 @@
+package hashfs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"image/png"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// FuncMap returns template functions for referencing files by their hash
+// names. The functions are "hashName" (see HashName), "assetURL" (see URL),
+// "integrity" (see Integrity), "srcset" (see SrcSet), "dataURI" (see DataURI),
+// "inlineStyle" (see InlineStyle), "scriptTag" (see ScriptTag), "styleTag"
+// (see StyleTag) & "iconLinks" (see IconLinks).
+func (fsys *FS) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"hashName":    fsys.HashName,
+		"assetURL":    fsys.URL,
+		"integrity":   fsys.Integrity,
+		"srcset":      fsys.SrcSet,
+		"dataURI":     fsys.DataURI,
+		"inlineStyle": fsys.InlineStyle,
+		"scriptTag":   fsys.ScriptTag,
+		"styleTag":    fsys.StyleTag,
+		"iconLinks":   fsys.IconLinks,
+	}
+}
+
+// ImportMap returns the JSON body of a <script type="importmap"> element that
+// maps the module specifier for each named file to its hashed URL. The
+// specifier is prefix followed by the file's name (e.g. "/js/" & "app.js"
+// maps "/js/app.js"). Returns an error if any file cannot be read.
+func (fsys *FS) ImportMap(prefix string, names ...string) (template.JS, error) {
+	var m struct {
+		Imports map[string]string `json:"imports"`
+	}
+	m.Imports = make(map[string]string, len(names))
+
+	for _, name := range names {
+		hashName, err := fsys.HashNameE(name)
+		if err != nil {
+			return "", err
+		}
+		m.Imports[prefix+name] = fsys.url(hashName)
+	}
+
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return template.JS(buf), nil
+}
+
+// PreloadTag returns a <link rel="preload"> element for the hashed URL of
+// name. The "as" attribute is derived from the file extension and fonts are
+// marked as crossorigin, as required by browsers.
+func (fsys *FS) PreloadTag(name string) template.HTML {
+	s := `<link rel="preload" href="` + template.HTMLEscapeString(fsys.URL(name)) + `"`
+	if as := preloadAs(name); as != "" {
+		s += ` as="` + as + `"`
+		if as == "font" {
+			s += ` crossorigin`
+		}
+	}
+	return template.HTML(s + `>`)
+}
+
+// ScriptTag returns a <script> element that loads name from its hashed URL
+// with integrity & crossorigin attributes set. Additional attributes are
+// specified as "name" or "name=value" (e.g. "defer" or "type=module") and a
+// crossorigin attribute replaces the default of "anonymous".
+func (fsys *FS) ScriptTag(name string, attrs ...string) (template.HTML, error) {
+	s, err := fsys.tag(`<script src="`, name, attrs)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(s + `></script>`), nil
+}
+
+// StyleTag returns a <link rel="stylesheet"> element that loads name from its
+// hashed URL with integrity & crossorigin attributes set. Additional
+// attributes are specified in the same form as ScriptTag (e.g. "media=print").
+func (fsys *FS) StyleTag(name string, attrs ...string) (template.HTML, error) {
+	s, err := fsys.tag(`<link rel="stylesheet" href="`, name, attrs)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(s + `>`), nil
+}
+
+// tag returns the opening tag, up to the closing bracket, of an element that
+// references name. The prefix ends with the opening quote of the URL attribute.
+func (fsys *FS) tag(prefix, name string, attrs []string) (string, error) {
+	integrity, err := fsys.Integrity(name)
+	if err != nil {
+		return "", err
+	}
+
+	crossorigin := "anonymous"
+	var extra string
+	for _, attr := range attrs {
+		key, value, hasValue := attr, "", false
+		if i := strings.Index(attr, "="); i != -1 {
+			key, value, hasValue = attr[:i], attr[i+1:], true
+		}
+		if !isAttrName(key) {
+			return "", fmt.Errorf("invalid attribute name: %q", key)
+		}
+
+		if strings.EqualFold(key, "crossorigin") {
+			crossorigin = value
+			continue
+		}
+		extra += " " + key
+		if hasValue {
+			extra += `="` + template.HTMLEscapeString(value) + `"`
+		}
+	}
+
+	s := prefix + template.HTMLEscapeString(fsys.URL(name)) + `" integrity="` + integrity + `"`
+	s += ` crossorigin="` + template.HTMLEscapeString(crossorigin) + `"`
+	return s + extra, nil
+}
+
+// isAttrName returns true if s is a valid, unquoted HTML attribute name.
+func isAttrName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if !(ch >= 'a' && ch <= 'z') && !(ch >= 'A' && ch <= 'Z') && !(ch >= '0' && ch <= '9') && ch != '-' && ch != '_' && ch != ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// preloadLink returns the value of a Link header that preloads name.
+func (fsys *FS) preloadLink(name string) string {
+	s := "<" + fsys.URL(name) + ">; rel=preload"
+	if as := preloadAs(name); as != "" {
+		s += "; as=" + as
+		if as == "font" {
+			s += "; crossorigin"
+		}
+	}
+	return s
+}
+
+// preloadAs returns the preload destination for name based on its extension.
+// Returns a blank string if the destination is unknown.
+func preloadAs(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".css":
+		return "style"
+	case ".js", ".mjs":
+		return "script"
+	case ".woff", ".woff2", ".ttf", ".otf", ".eot":
+		return "font"
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".avif", ".svg", ".ico":
+		return "image"
+	}
+	return ""
+}
+
+// SrcSet returns the value of an image's srcset attribute listing the hashed
+// URL of a pre-generated variant of base for each width. Variants are named
+// with the width before the extension (e.g. "hero-640.jpg" for "hero.jpg" at
+// a width of 640). Returns an error if any variant cannot be read.
+func (fsys *FS) SrcSet(base string, widths ...int) (template.Srcset, error) {
+	ext := path.Ext(base)
+	a := make([]string, 0, len(widths))
+	for _, w := range widths {
+		hashName, err := fsys.HashNameE(fmt.Sprintf("%s-%d%s", strings.TrimSuffix(base, ext), w, ext))
+		if err != nil {
+			return "", err
+		}
+		a = append(a, fmt.Sprintf("%s %dw", fsys.url(hashName), w))
+	}
+	return template.Srcset(strings.Join(a, ", ")), nil
+}
+
+// DefaultMaxDataURISize is the default maximum size, in bytes, of files
+// inlined by DataURI.
+const DefaultMaxDataURISize = 32 << 10
+
+// WithMaxDataURISize returns an option that sets the maximum size, in bytes,
+// of files inlined by DataURI. Defaults to DefaultMaxDataURISize.
+func WithMaxDataURISize(n int64) Option {
+	return func(fsys *FS) {
+		fsys.maxDataURI = n
+	}
+}
+
+// DataURI returns the contents of name as a base64-encoded data URI with the
+// file's content type. This allows small files, such as icons, to be inlined
+// into a page to save a request. Large files should be referenced by URL
+// instead since inlined content cannot be cached separately from the page, so
+// an error is returned for files larger than the limit set by
+// WithMaxDataURISize.
+func (fsys *FS) DataURI(name string) (template.URL, error) {
+	limit := fsys.maxDataURI
+	if limit <= 0 {
+		limit = DefaultMaxDataURISize
+	}
+
+	// Check the size before reading so large files are never loaded.
+	if fi, err := fsys.Stat(name); err != nil {
+		return "", err
+	} else if fi.Size() > limit {
+		return "", fmt.Errorf("cannot inline %q: size of %d bytes exceeds limit of %d", name, fi.Size(), limit)
+	}
+
+	buf, err := fsys.ReadFile(name)
+	if err != nil {
+		return "", err
+	} else if int64(len(buf)) > limit {
+		return "", fmt.Errorf("cannot inline %q: size of %d bytes exceeds limit of %d", name, len(buf), limit)
+	}
+	ctype := strings.ReplaceAll(fsys.ContentType(name), " ", "")
+	return template.URL("data:" + ctype + ";base64," + base64.StdEncoding.EncodeToString(buf)), nil
+}
+
+// InlineStyle returns a <style> element containing the contents of name so
+// that critical CSS can be inlined into a page. The element's contents match
+// the file exactly so CSPHash returns the hash source that permits it under a
+// strict style-src policy. Returns an error if the contents would end the
+// element early.
+func (fsys *FS) InlineStyle(name string) (template.HTML, error) {
+	buf, err := fsys.ReadFile(name)
+	if err != nil {
+		return "", err
+	} else if bytes.Contains(bytes.ToLower(buf), []byte("</style")) {
+		return "", fmt.Errorf("cannot inline %q: contains closing style tag", name)
+	}
+	return template.HTML("<style>" + string(buf) + "</style>"), nil
+}
+
+// CSPHash returns a Content-Security-Policy hash source for the contents of
+// name (e.g. "'sha256-...'"). This allows the file to be inlined into a page
+// while still being permitted by a strict script-src or style-src policy.
+func (fsys *FS) CSPHash(name string) (string, error) {
+	integrity, err := fsys.Integrity(name)
+	if err != nil {
+		return "", err
+	}
+	return "'" + integrity + "'", nil
+}
+
+// CSPDirective returns a Content-Security-Policy directive that permits the
+// inlined contents of each named file, e.g. "script-src 'sha256-...'".
+func (fsys *FS) CSPDirective(directive string, names ...string) (string, error) {
+	s := directive
+	for _, name := range names {
+		hash, err := fsys.CSPHash(name)
+		if err != nil {
+			return "", err
+		}
+		s += " " + hash
+	}
+	return s, nil
+}
+
+// IconLinks returns the <link> & <meta> elements for the conventional icon
+// files found in dir, such as favicon.ico, favicon.svg, favicon-32x32.png,
+// apple-touch-icon.png, safari-pinned-tab.svg, site.webmanifest &
+// browserconfig.xml. Each element references the hashed URL of its file and
+// PNG icons are annotated with their dimensions. Unrecognized files are
+// ignored.
+func (fsys *FS) IconLinks(dir string) (template.HTML, error) {
+	if !fs.ValidPath(dir) {
+		return "", &fs.PathError{Op: "readdir", Path: dir, Err: fs.ErrInvalid}
+	}
+	entries, err := fs.ReadDir(fsys.fsys, fsys.path(dir))
+	if err != nil {
+		return "", err
+	}
+
+	var links []iconLink
+	for _, ent := range entries {
+		if ent.IsDir() || fsys.excluded(fsys.path(path.Join(dir, ent.Name()))) {
+			continue
+		}
+		name := path.Join(dir, ent.Name())
+
+		link, ok, err := fsys.iconLink(name)
+		if err != nil {
+			return "", err
+		} else if ok {
+			links = append(links, link)
+		}
+	}
+
+	// Order elements by kind & then by size so output is stable.
+	sort.SliceStable(links, func(i, j int) bool {
+		if links[i].rank != links[j].rank {
+			return links[i].rank < links[j].rank
+		}
+		return links[i].width < links[j].width
+	})
+
+	a := make([]string, len(links))
+	for i := range links {
+		a[i] = links[i].html
+	}
+	return template.HTML(strings.Join(a, "\n")), nil
+}
+
+// iconLink represents a single element generated by IconLinks.
+type iconLink struct {
+	rank  int // position of the element's kind within the output
+	width int // icon width, if known
+	html  string
+}
+
+// iconLink returns the element for name, if name is a conventional icon file.
+func (fsys *FS) iconLink(name string) (iconLink, bool, error) {
+	base := strings.ToLower(path.Base(name))
+	href := template.HTMLEscapeString(fsys.URL(name))
+
+	switch {
+	case base == "favicon.ico":
+		return iconLink{rank: 0, html: `<link rel="icon" href="` + href + `" sizes="any">`}, true, nil
+	case base == "favicon.svg" || base == "icon.svg":
+		return iconLink{rank: 1, html: `<link rel="icon" href="` + href + `" type="image/svg+xml">`}, true, nil
+	case strings.HasPrefix(base, "apple-touch-icon") && path.Ext(base) == ".png":
+		w, h, err := fsys.pngSize(name)
+		if err != nil {
+			return iconLink{}, false, err
+		}
+		return iconLink{rank: 3, width: w, html: fmt.Sprintf(`<link rel="apple-touch-icon" href="%s" sizes="%dx%d">`, href, w, h)}, true, nil
+	case (strings.HasPrefix(base, "favicon") || strings.HasPrefix(base, "icon") || strings.HasPrefix(base, "android-chrome")) && path.Ext(base) == ".png":
+		w, h, err := fsys.pngSize(name)
+		if err != nil {
+			return iconLink{}, false, err
+		}
+		return iconLink{rank: 2, width: w, html: fmt.Sprintf(`<link rel="icon" href="%s" type="image/png" sizes="%dx%d">`, href, w, h)}, true, nil
+	case base == "safari-pinned-tab.svg" || base == "mask-icon.svg":
+		return iconLink{rank: 4, html: `<link rel="mask-icon" href="` + href + `">`}, true, nil
+	case base == "site.webmanifest" || base == "manifest.webmanifest" || base == "manifest.json":
+		return iconLink{rank: 5, html: `<link rel="manifest" href="` + href + `">`}, true, nil
+	case base == "browserconfig.xml":
+		return iconLink{rank: 6, html: `<meta name="msapplication-config" content="` + href + `">`}, true, nil
+	default:
+		return iconLink{}, false, nil
+	}
+}
+
+// pngSize returns the dimensions of the PNG image stored at name.
+func (fsys *FS) pngSize(name string) (width, height int, err error) {
+	f, err := fsys.fsys.Open(fsys.path(name))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	config, err := png.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, fmt.Errorf("decode %q: %w", name, err)
+	}
+	return config.Width, config.Height, nil
+}
@@ -0,0 +1,271 @@
+package hashfs_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"html/template"
+	"image"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestFS_ImportMap(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"js/app.js":  {Data: []byte(`foo`)},
+		"js/util.js": {Data: []byte(`bar`)},
+	}, hashfs.WithHashLength(8), hashfs.WithURLPrefix("/static"))
+
+	t.Run("OK", func(t *testing.T) {
+		if got, err := f.ImportMap("./", "js/app.js", "js/util.js"); err != nil {
+			t.Fatal(err)
+		} else if want := template.JS(`{"imports":{"./js/app.js":"/static/js/app-2c26b46b.js","./js/util.js":"/static/js/util-fcde2b2e.js"}}`); got != want {
+			t.Fatalf("ImportMap()=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("ErrNotExist", func(t *testing.T) {
+		if _, err := f.ImportMap("", "js/missing.js"); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestFS_PreloadTag(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"app.css":    {Data: []byte(`foo`)},
+		"font.woff2": {Data: []byte(`bar`)},
+	}, hashfs.WithHashLength(8), hashfs.WithURLPrefix("/static"))
+
+	if got, want := f.PreloadTag("app.css"), template.HTML(`<link rel="preload" href="/static/app-2c26b46b.css" as="style">`); got != want {
+		t.Fatalf("PreloadTag()=%s, want %s", got, want)
+	}
+	if got, want := f.PreloadTag("font.woff2"), template.HTML(`<link rel="preload" href="/static/font-fcde2b2e.woff2" as="font" crossorigin>`); got != want {
+		t.Fatalf("PreloadTag()=%s, want %s", got, want)
+	}
+	if got, want := f.PreloadTag("data.bin"), template.HTML(`<link rel="preload" href="/static/data.bin">`); got != want {
+		t.Fatalf("PreloadTag()=%s, want %s", got, want)
+	}
+}
+
+func TestFS_CSPHash(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"a.js": {Data: []byte(`foo`)},
+		"b.js": {Data: []byte(`bar`)},
+	})
+
+	if got, err := f.CSPHash("a.js"); err != nil {
+		t.Fatal(err)
+	} else if want := `'sha256-LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564='`; got != want {
+		t.Fatalf("CSPHash()=%s, want %s", got, want)
+	}
+
+	if got, err := f.CSPDirective("script-src", "a.js", "b.js"); err != nil {
+		t.Fatal(err)
+	} else if want := `script-src 'sha256-LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564=' 'sha256-/N4rLtula/QIYB+3If6bXDONEO5CnqBPrlURto+/j7k='`; got != want {
+		t.Fatalf("CSPDirective()=%s, want %s", got, want)
+	}
+
+	if _, err := f.CSPDirective("script-src", "missing.js"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFS_SrcSet(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"img/hero-640.jpg":  {Data: []byte(`foo`)},
+		"img/hero-1280.jpg": {Data: []byte(`bar`)},
+	}, hashfs.WithHashLength(8), hashfs.WithURLPrefix("/static/"))
+
+	if got, err := f.SrcSet("img/hero.jpg", 640, 1280); err != nil {
+		t.Fatal(err)
+	} else if want := `/static/img/hero-640-2c26b46b.jpg 640w, /static/img/hero-1280-fcde2b2e.jpg 1280w`; string(got) != want {
+		t.Fatalf("SrcSet()=%s, want %s", got, want)
+	}
+
+	if _, err := f.SrcSet("img/hero.jpg", 1920); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tmpl := template.Must(template.New("").Funcs(f.FuncMap()).Parse(`<img srcset="{{srcset "img/hero.jpg" 640 1280}}">`))
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	} else if got, want := buf.String(), `<img srcset="/static/img/hero-640-2c26b46b.jpg 640w, /static/img/hero-1280-fcde2b2e.jpg 1280w">`; got != want {
+		t.Fatalf("Execute()=%s, want %s", got, want)
+	}
+}
+
+func TestFS_DataURI(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"icon.svg":     {Data: []byte(`<svg/>`)},
+		"critical.css": {Data: []byte(`foo`)},
+	})
+
+	if got, err := f.DataURI("icon.svg"); err != nil {
+		t.Fatal(err)
+	} else if want := `data:image/svg+xml;base64,PHN2Zy8+`; string(got) != want {
+		t.Fatalf("DataURI()=%s, want %s", got, want)
+	}
+
+	if got, err := f.DataURI("critical.css"); err != nil {
+		t.Fatal(err)
+	} else if want := `data:text/css;charset=utf-8;base64,Zm9v`; string(got) != want {
+		t.Fatalf("DataURI()=%s, want %s", got, want)
+	}
+
+	if _, err := f.DataURI("missing.png"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Files larger than the limit are not inlined.
+	if _, err := hashfs.NewFS(fstest.MapFS{"big.png": {Data: make([]byte, hashfs.DefaultMaxDataURISize+1)}}).DataURI("big.png"); err == nil {
+		t.Fatal("expected error")
+	} else if _, err := hashfs.NewFS(fstest.MapFS{"icon.svg": {Data: []byte(`<svg/>`)}}, hashfs.WithMaxDataURISize(5)).DataURI("icon.svg"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	tmpl := template.Must(template.New("").Funcs(f.FuncMap()).Parse(`<img src="{{dataURI "icon.svg"}}">`))
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	} else if got, want := buf.String(), `<img src="data:image/svg&#43;xml;base64,PHN2Zy8&#43;">`; got != want {
+		t.Fatalf("Execute()=%s, want %s", got, want)
+	}
+}
+
+func TestFS_InlineStyle(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"critical.css": {Data: []byte(`body{margin:0}`)},
+		"evil.css":     {Data: []byte(`</STYLE><script>`)},
+	})
+
+	if got, err := f.InlineStyle("critical.css"); err != nil {
+		t.Fatal(err)
+	} else if want := `<style>body{margin:0}</style>`; string(got) != want {
+		t.Fatalf("InlineStyle()=%s, want %s", got, want)
+	}
+
+	// The CSP hash covers the element's contents exactly.
+	sum := sha256.Sum256([]byte(`body{margin:0}`))
+	if got, err := f.CSPHash("critical.css"); err != nil {
+		t.Fatal(err)
+	} else if want := "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"; got != want {
+		t.Fatalf("CSPHash()=%s, want %s", got, want)
+	}
+
+	if _, err := f.InlineStyle("evil.css"); err == nil {
+		t.Fatal("expected error")
+	} else if _, err := f.InlineStyle("missing.css"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFS_ScriptTag(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{"app.js": {Data: []byte(`foo`)}}, hashfs.WithHashLength(8), hashfs.WithURLPrefix("/static"))
+
+	if got, err := f.ScriptTag("app.js", "defer", "type=module"); err != nil {
+		t.Fatal(err)
+	} else if want := `<script src="/static/app-2c26b46b.js" integrity="sha256-LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564=" crossorigin="anonymous" defer type="module"></script>`; string(got) != want {
+		t.Fatalf("ScriptTag()=%s, want %s", got, want)
+	}
+
+	// The default crossorigin value can be replaced & values are escaped.
+	if got, err := f.ScriptTag("app.js", "crossorigin=use-credentials", `data-x="<>"`); err != nil {
+		t.Fatal(err)
+	} else if want := `<script src="/static/app-2c26b46b.js" integrity="sha256-LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564=" crossorigin="use-credentials" data-x="&#34;&lt;&gt;&#34;"></script>`; string(got) != want {
+		t.Fatalf("ScriptTag()=%s, want %s", got, want)
+	}
+
+	if _, err := f.ScriptTag("app.js", `onload x=y`); err == nil {
+		t.Fatal("expected error")
+	} else if _, err := f.ScriptTag("missing.js"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFS_StyleTag(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{"app.css": {Data: []byte(`foo`)}}, hashfs.WithHashLength(8))
+
+	if got, err := f.StyleTag("app.css", "media=print"); err != nil {
+		t.Fatal(err)
+	} else if want := `<link rel="stylesheet" href="app-2c26b46b.css" integrity="sha256-LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564=" crossorigin="anonymous" media="print">`; string(got) != want {
+		t.Fatalf("StyleTag()=%s, want %s", got, want)
+	}
+
+	if _, err := f.StyleTag("missing.css"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFS_IconLinks(t *testing.T) {
+	png16, png32, png180 := encodePNG(t, 16), encodePNG(t, 32), encodePNG(t, 180)
+	f := hashfs.NewFS(fstest.MapFS{
+		"icons/favicon.ico":              {Data: []byte(`foo`)},
+		"icons/favicon.svg":              {Data: []byte(`foo`)},
+		"icons/favicon-32x32.png":        {Data: png32},
+		"icons/favicon-16x16.png":        {Data: png16},
+		"icons/apple-touch-icon.png":     {Data: png180},
+		"icons/safari-pinned-tab.svg":    {Data: []byte(`foo`)},
+		"icons/site.webmanifest":         {Data: []byte(`foo`)},
+		"icons/browserconfig.xml":        {Data: []byte(`foo`)},
+		"icons/readme.txt":               {Data: []byte(`foo`)},
+		"icons/sub/android-chrome-1.png": {Data: []byte(`foo`)},
+	}, hashfs.WithHashLength(8), hashfs.WithURLPrefix("/static"))
+
+	got, err := f.IconLinks("icons")
+	if err != nil {
+		t.Fatal(err)
+	} else if want := strings.Join([]string{
+		`<link rel="icon" href="/static/icons/favicon-2c26b46b.ico" sizes="any">`,
+		`<link rel="icon" href="/static/icons/favicon-2c26b46b.svg" type="image/svg+xml">`,
+		`<link rel="icon" href="/static/icons/favicon-16x16-` + hashHex(png16)[:8] + `.png" type="image/png" sizes="16x16">`,
+		`<link rel="icon" href="/static/icons/favicon-32x32-` + hashHex(png32)[:8] + `.png" type="image/png" sizes="32x32">`,
+		`<link rel="apple-touch-icon" href="/static/icons/apple-touch-icon-` + hashHex(png180)[:8] + `.png" sizes="180x180">`,
+		`<link rel="mask-icon" href="/static/icons/safari-pinned-tab-2c26b46b.svg">`,
+		`<link rel="manifest" href="/static/icons/site-2c26b46b.webmanifest">`,
+		`<meta name="msapplication-config" content="/static/icons/browserconfig-2c26b46b.xml">`,
+	}, "\n"); string(got) != want {
+		t.Fatalf("IconLinks()=%s\nwant %s", got, want)
+	}
+
+	// Icons that are not valid PNG images are reported.
+	if _, err := f.IconLinks("icons/sub"); err == nil {
+		t.Fatal("expected error")
+	} else if _, err := f.IconLinks("missing"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// encodePNG returns an encoded, square PNG image of the given size.
+func encodePNG(tb testing.TB, size int) []byte {
+	tb.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, size, size))); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFS_FuncMap(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{"app.js": {Data: []byte(`foo`)}}, hashfs.WithHashLength(8), hashfs.WithURLPrefix("/static"))
+	tmpl := template.Must(template.New("").Funcs(f.FuncMap()).Parse(`{{hashName "app.js"}} {{assetURL "app.js"}} {{integrity "app.js"}}`))
+
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	} else if got, want := buf.String(), `app-2c26b46b.js /static/app-2c26b46b.js sha256-LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7&#43;g&#43;YpeiGJm564=`; got != want {
+		t.Fatalf("Execute()=%s, want %s", got, want)
+	}
+
+	if got, want := f.URLPrefix(), "/static/"; got != want {
+		t.Fatalf("URLPrefix()=%s, want %s", got, want)
+	} else if got, want := hashfs.NewFS(f).URLPrefix(), "/"; got != want {
+		t.Fatalf("URLPrefix()=%s, want %s", got, want)
+	}
+}
@@ -0,0 +1,1810 @@
+package hashfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// FileServer returns an http.Handler for serving FS files. It provides a
+// simplified implementation of http.FileServer which is used to aggressively
+// cache files on the client since the file hash is in the filename.
+//
+// Because FileServer is focused on small known path files, several features
+// of http.FileServer have been removed including canonicalizing directories
+// & multi-part range requests for files that do not implement io.Seeker.
+// Directory index pages are only served if enabled with WithIndexFiles.
+func FileServer(fsys fs.FS, opts ...ServerOption) http.Handler {
+	hfsys, ok := fsys.(*FS)
+	if !ok {
+		hfsys = NewFS(fsys)
+	}
+
+	h := &fsHandler{
+		fsys:                 hfsys,
+		hashedCacheControl:   DefaultCacheControl,
+		unhashedCacheControl: "",
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.vary = h.varyHeaders()
+	return h
+}
+
+// ServerOption represents a configuration option passed to FileServer.
+type ServerOption func(*fsHandler)
+
+// DefaultCacheControl is the Cache-Control header value used for requests
+// to hash names. Since the content of a hash name never changes, the
+// "immutable" directive allows browsers to skip revalidation entirely.
+const DefaultCacheControl = `public, max-age=31536000, immutable`
+
+// WithCacheControl returns an option that sets the Cache-Control header value
+// for requests to hash names & to unhashed names, respectively. A blank value
+// omits the header. Defaults to DefaultCacheControl for hash names and no
+// header for unhashed names.
+func WithCacheControl(hashed, unhashed string) ServerOption {
+	return func(h *fsHandler) {
+		h.hashedCacheControl = hashed
+		h.unhashedCacheControl = unhashed
+	}
+}
+
+// WithCacheRules returns an option that sets the Cache-Control header value
+// for files matching glob patterns, overriding the values set by
+// WithCacheControl. Patterns use path.Match syntax against names relative to
+// the file system and a "**" element matches any number of directories (e.g.
+// "fonts/**"). If multiple patterns match then the longest pattern is used. A
+// blank value omits the header.
+func WithCacheRules(rules map[string]string) ServerOption {
+	a := make([]cacheRule, 0, len(rules))
+	for pattern, value := range rules {
+		a = append(a, cacheRule{pattern: pattern, value: value})
+	}
+	sort.Slice(a, func(i, j int) bool {
+		if len(a[i].pattern) != len(a[j].pattern) {
+			return len(a[i].pattern) > len(a[j].pattern)
+		}
+		return a[i].pattern < a[j].pattern
+	})
+
+	return func(h *fsHandler) {
+		h.cacheRules = a
+	}
+}
+
+// cacheRule is a Cache-Control value for files matching a glob pattern.
+type cacheRule struct {
+	pattern string
+	value   string
+}
+
+// WithPrecompressed returns an option that serves precompressed sibling files
+// (e.g. "main.js.br" for "main.js") when the client accepts their encoding.
+// Supported encodings are "br", "gzip", & "zstd" and are tried in the order
+// specified. Defaults to "br" & "gzip" if no encodings are specified.
+func WithPrecompressed(encodings ...string) ServerOption {
+	if len(encodings) == 0 {
+		encodings = []string{"br", "gzip"}
+	}
+	return func(h *fsHandler) {
+		h.encodings = encodings
+	}
+}
+
+// WithCompression returns an option that gzips compressible assets (e.g.
+// HTML, CSS, JavaScript, JSON, & SVG) when the client accepts it and no
+// precompressed variant is available. The compressed content of each file is
+// cached in memory until the file's content changes so each version of an
+// asset is only compressed once.
+func WithCompression(level int) ServerOption {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		level = gzip.DefaultCompression
+	}
+	return func(h *fsHandler) {
+		h.compression = true
+		h.compressionLevel = level
+	}
+}
+
+// WithNotFoundHandler returns an option that delegates requests for missing
+// files to handler. This can be used to fall through to an application router
+// or to serve a custom 404 page.
+func WithNotFoundHandler(handler http.Handler) ServerOption {
+	return func(h *fsHandler) {
+		h.notFoundHandler = handler
+	}
+}
+
+// WithErrorHandler returns an option that calls fn to write error responses,
+// such as 403, 404 & 500 responses, instead of the default plain text body.
+// This allows JSON errors for API deployments or branded error pages. For 404
+// responses, err matches fs.ErrNotExist and may also match ErrHashMismatch
+// for stale hash names. The handler set by WithNotFoundHandler takes
+// precedence for 404 responses.
+func WithErrorHandler(fn func(w http.ResponseWriter, r *http.Request, status int, err error)) ServerOption {
+	return func(h *fsHandler) {
+		h.errorHandler = fn
+	}
+}
+
+// Errors passed to the error handler for rejected requests.
+var (
+	errInvalidPath      = errors.New("invalid URL path")
+	errInvalidSignature = errors.New("invalid or missing signature")
+	errNotAuthorized    = errors.New("not authorized")
+)
+
+// serveError writes an error response with the given status code.
+func (h *fsHandler) serveError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if h.errorHandler != nil {
+		h.errorHandler(w, r, status, err)
+		return
+	}
+
+	text := http.StatusText(status)
+	if status == http.StatusNotFound {
+		text = "page not found"
+	}
+	http.Error(w, fmt.Sprintf("%d %s", status, text), status)
+}
+
+// WithSPAFallback returns an option that serves the index file for requests
+// to missing files that accept HTML, as is typical for single-page apps. The
+// index is served with "no-cache" so clients always revalidate it.
+func WithSPAFallback(index string) ServerOption {
+	return func(h *fsHandler) {
+		h.spaIndex = index
+	}
+}
+
+// WithIndexFiles returns an option that serves the first matching index file
+// (e.g. "index.html") for requests to directories. Index files are served
+// with the unhashed Cache-Control value since their URL does not change.
+func WithIndexFiles(names ...string) ServerOption {
+	return func(h *fsHandler) {
+		h.indexFiles = names
+	}
+}
+
+// WithCanonicalPaths returns an option that canonicalizes request paths in
+// the same way as http.FileServer. Paths containing ".." elements are rejected
+// with a 400 status, non-canonical paths (e.g. "/a//b" or "/a/./b") are
+// redirected to their cleaned form, directories are redirected to a path with
+// a trailing slash & files are redirected to a path without one. By default,
+// paths are cleaned silently.
+func WithCanonicalPaths(enabled bool) ServerOption {
+	return func(h *fsHandler) {
+		h.canonicalPaths = enabled
+	}
+}
+
+// serveCanonical rejects request paths containing ".." & redirects paths that
+// are not clean. Returns true if a response was written.
+func (h *fsHandler) serveCanonical(w http.ResponseWriter, r *http.Request) bool {
+	upath := r.URL.Path
+	if containsDotDot(upath) {
+		h.serveError(w, r, http.StatusBadRequest, errInvalidPath)
+		return true
+	}
+
+	cleaned := path.Clean("/" + upath)
+	if strings.HasSuffix(upath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if cleaned != upath && cleaned != "/"+upath {
+		redirect(w, r, cleaned)
+		return true
+	}
+	return false
+}
+
+// containsDotDot returns true if any element of the slash-separated path v
+// is "..".
+func containsDotDot(v string) bool {
+	for _, elem := range strings.Split(v, "/") {
+		if elem == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// redirect responds with a permanent redirect to urlpath, preserving the
+// query string of the request.
+func redirect(w http.ResponseWriter, r *http.Request, urlpath string) {
+	if q := r.URL.RawQuery; q != "" {
+		urlpath += "?" + q
+	}
+	w.Header().Set("Location", urlpath)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+// StaleHashPolicy specifies how FileServer responds to requests for a hash
+// name whose hash does not match the current content of the file. This
+// typically occurs when a page cached before a deploy references an asset.
+type StaleHashPolicy int
+
+const (
+	// StaleHashNotFound responds with a 404. This is the default.
+	StaleHashNotFound StaleHashPolicy = iota
+
+	// StaleHashRedirect redirects the client to the current hash name.
+	StaleHashRedirect
+
+	// StaleHashServe serves the current content without aggressive caching.
+	StaleHashServe
+)
+
+// WithStaleHashPolicy returns an option that sets how requests for outdated
+// hash names are handled. Defaults to StaleHashNotFound.
+func WithStaleHashPolicy(policy StaleHashPolicy) ServerOption {
+	return func(h *fsHandler) {
+		h.staleHashPolicy = policy
+	}
+}
+
+// VersionStore provides access to previous versions of files so that hash
+// names referenced by earlier deploys can still be served, e.g. while old &
+// new application versions overlap during a rolling deploy.
+//
+// Any fs.FS containing previously hashed files, such as the output directory
+// of the hashfs command, can be used as a VersionStore.
+type VersionStore interface {
+	// Open returns the file for the given hash name. Returns an error
+	// wrapping fs.ErrNotExist if the version is not available.
+	Open(hashName string) (fs.File, error)
+}
+
+// WithVersionStore returns an option that consults store when a requested
+// hash name does not match the current content of its file. Versions found
+// in the store are served with the hashed Cache-Control value.
+func WithVersionStore(store VersionStore) ServerOption {
+	return func(h *fsHandler) {
+		h.versionStore = store
+	}
+}
+
+// DefaultManifestPath is the path, relative to the file system's URL prefix,
+// that the manifest is served from if WithManifestEndpoint is passed a blank
+// path.
+const DefaultManifestPath = "/.hashfs/manifest.json"
+
+// WithManifestEndpoint returns an option that serves a JSON object mapping
+// the original name of every file to its hash name at path, relative to the
+// file system's URL prefix. This allows client-side code, such as service
+// workers & dynamic imports, to resolve hashed URLs at runtime. The manifest
+// is served with "no-cache" since it changes whenever a file changes. The
+// file system is warmed on the first request & again after hashes are
+// invalidated, so new files are listed once they are passed to Invalidate.
+func WithManifestEndpoint(path string) ServerOption {
+	if path == "" {
+		path = DefaultManifestPath
+	}
+	return func(h *fsHandler) {
+		h.manifestPath = cleanEndpoint(path)
+	}
+}
+
+// DefaultBundlePath is the path, relative to the file system's URL prefix,
+// that the bundle is served from if WithBundleEndpoint is passed a blank path.
+const DefaultBundlePath = "/.hashfs/bundle.tar.gz"
+
+// WithBundleEndpoint returns an option that streams a gzipped tarball of
+// files at path, relative to the file system's URL prefix. Files are stored
+// under their hash names so the archive can be used to populate offline
+// caches or to verify deployed assets. If filter is not nil then only files
+// whose original names it returns true for are included. As with
+// WithManifestEndpoint, the file system is only warmed again after hashes are
+// invalidated.
+func WithBundleEndpoint(path string, filter func(name string) bool) ServerOption {
+	if path == "" {
+		path = DefaultBundlePath
+	}
+	return func(h *fsHandler) {
+		h.bundlePath = cleanEndpoint(path)
+		h.bundleFilter = filter
+	}
+}
+
+// DefaultByHashPath is the path, relative to the file system's URL prefix,
+// that files are served beneath if WithByHashEndpoint is passed a blank path.
+const DefaultByHashPath = "/.by-hash"
+
+// WithByHashEndpoint returns an option that serves files by their digest alone
+// at "<path>/<hash>", relative to the file system's URL prefix. The hash may
+// be a full hex-encoded SHA-256 digest or the hash from a hash name. This
+// allows clients that only know a digest, such as source map uploaders &
+// cache probers, to retrieve content without knowing its path. Only files
+// whose hashes have already been computed are served so the file system is
+// typically warmed at startup. See OpenHash & FS.Warm.
+func WithByHashEndpoint(path string) ServerOption {
+	if path == "" {
+		path = DefaultByHashPath
+	}
+	return func(h *fsHandler) {
+		h.byHashPath = cleanEndpoint(path)
+	}
+}
+
+// cleanEndpoint returns the cleaned path of an endpoint served by the handler
+// in the same form as the filenames of requests.
+func cleanEndpoint(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+p), "/")
+}
+
+// WithPreload returns an option that adds a "Link: <...>; rel=preload" header
+// to HTML responses for each named file, resolved to its hashed URL. This
+// allows browsers to begin fetching critical assets such as stylesheets,
+// scripts & fonts before the document is parsed.
+func WithPreload(names ...string) ServerOption {
+	return func(h *fsHandler) {
+		h.preloads = append(h.preloads, names...)
+	}
+}
+
+// WithEarlyHints returns an option that sends a "103 Early Hints" response
+// containing the preload links set by WithPreload before serving HTML files.
+// Clients can then fetch critical assets while the document is being sent.
+// Informational responses require Go 1.19 or later. With earlier versions the
+// links are only sent with the final response.
+func WithEarlyHints(enabled bool) ServerOption {
+	return func(h *fsHandler) {
+		h.earlyHints = enabled
+	}
+}
+
+// EarlyHints returns a handler that sends a "103 Early Hints" response with
+// preload links to the hashed URLs of names before calling next. This is
+// intended to wrap handlers that render HTML pages referencing the assets.
+// As with WithEarlyHints, the 103 response is only sent with Go 1.19 or later.
+func EarlyHints(fsys *FS, next http.Handler, names ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeEarlyHints(w, r, fsys, names)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeEarlyHints adds preload links for names to the response headers and
+// flushes them in an informational response. The links remain set for the
+// final response. HTTP/1.0 clients do not support informational responses.
+func writeEarlyHints(w http.ResponseWriter, r *http.Request, fsys *FS, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	for _, name := range names {
+		w.Header().Add("Link", fsys.preloadLink(name))
+	}
+	if earlyHintsSupported && r.ProtoAtLeast(1, 1) {
+		w.WriteHeader(http.StatusEarlyHints)
+	}
+}
+
+// WithHeaders returns an option that calls fn before each file is written so
+// that additional response headers can be set, such as CORS or security
+// headers. The name is the file's original name and hashed is true if the
+// file was requested by its hash name. Headers set by fn take precedence over
+// headers set by the file server.
+func WithHeaders(fn func(w http.Header, name string, hashed bool)) ServerOption {
+	return func(h *fsHandler) {
+		h.headers = fn
+	}
+}
+
+// WithCORS returns an option that allows cross-origin requests from the given
+// origins, as is required for fonts served from a separate domain or CDN. An
+// origin of "*" allows requests from any origin. Preflight OPTIONS requests
+// are answered directly by the file server.
+func WithCORS(origins ...string) ServerOption {
+	return func(h *fsHandler) {
+		h.corsOrigins = append(h.corsOrigins, origins...)
+	}
+}
+
+// WithObserver returns an option that calls fn after each request has been
+// served. The name is the original name of the file that was served, relative
+// to the file system, or blank if no file was served. The number of bytes is
+// the size of the response body. This can be used for access logging, tracing
+// or alerting on slow assets.
+func WithObserver(fn func(r *http.Request, name string, status int, bytes int64, d time.Duration)) ServerOption {
+	return func(h *fsHandler) {
+		h.observer = fn
+	}
+}
+
+// WithAuthorize returns an option that calls fn before a file is served and
+// responds with "403 Forbidden" if it returns false. The name is the original
+// name of the file, relative to the file system, regardless of whether it was
+// requested by hash name. This allows per-file authorization, such as for
+// tenant-scoped assets. Files that are not authorized are also omitted from
+// the manifest & bundle endpoints.
+func WithAuthorize(fn func(r *http.Request, name string) bool) ServerOption {
+	return func(h *fsHandler) {
+		h.authorize = fn
+	}
+}
+
+// WithDenyPatterns returns an option that responds with "404 Not Found" for
+// files & directories matching any of the glob patterns, such as ".git/**",
+// "*.tmpl" or "secret/**", so that sensitive files within the file system are
+// not publicly downloadable. Unlike WithExclude, matching files are still
+// hashed. Patterns use the same syntax as WithExclude. Denied files are also
+// omitted from directory listings & the manifest & bundle endpoints.
+func WithDenyPatterns(patterns ...string) ServerOption {
+	return func(h *fsHandler) {
+		h.denyPatterns = append(h.denyPatterns, patterns...)
+	}
+}
+
+// denied returns true if name, relative to the file system, matches a pattern
+// set by WithDenyPatterns.
+func (h *fsHandler) denied(name string) bool {
+	for _, pattern := range h.denyPatterns {
+		if matchFilter(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithRewrite returns an option that calls fn to rewrite the path of each
+// request before it is resolved to a file. The path is relative to the file
+// system's URL prefix and may be a hash name. This can be used to select
+// assets by locale or experiment, to apply tenant-specific overrides, or to
+// map legacy URLs. Request headers used to select files should be declared
+// with WithVary.
+func WithRewrite(fn func(r *http.Request, path string) string) ServerOption {
+	return func(h *fsHandler) {
+		h.rewrite = fn
+	}
+}
+
+// WithImageVariants returns an option that serves a sibling file in a modern
+// image format (e.g. "hero.jpg.avif" for "hero.jpg") for JPEG, PNG & GIF
+// requests when the client's Accept header lists its type. The URL of the
+// original image, including its hash name, is unchanged while the response
+// carries the variant's content type & ETag along with "Vary: Accept".
+// Supported formats are "avif" & "webp" and are tried in the order specified.
+// Defaults to "avif" & "webp" if no formats are specified.
+func WithImageVariants(formats ...string) ServerOption {
+	if len(formats) == 0 {
+		formats = []string{"avif", "webp"}
+	}
+	return func(h *fsHandler) {
+		h.imageFormats = formats
+	}
+}
+
+// WithVary returns an option that declares request headers that responses
+// vary on, such as "Accept-Language" when WithRewrite selects files by
+// locale. The headers are added to the Vary header of every response, along
+// with the headers required by other options such as compression & CORS, so
+// that caches never serve one variant in place of another.
+func WithVary(headers ...string) ServerOption {
+	return func(h *fsHandler) {
+		h.varyUser = append(h.varyUser, headers...)
+	}
+}
+
+// DefaultRootCacheControl is the Cache-Control header value used for files
+// served by WithRootFiles. Their names are fixed by convention so they must be
+// revalidated periodically to pick up changes.
+const DefaultRootCacheControl = `public, max-age=3600`
+
+// WithRootFiles returns an option that serves files at conventional root
+// level paths, such as "/favicon.ico", "/robots.txt" or "/.well-known/...",
+// which cannot use hash names. Keys are request paths and values are names
+// within the file system. A key ending in "/" maps every path beneath it onto
+// the directory named by its value. Root paths are matched before the URL
+// prefix is stripped and are served with DefaultRootCacheControl unless a
+// WithCacheRules pattern matches the file.
+func WithRootFiles(files map[string]string) ServerOption {
+	return func(h *fsHandler) {
+		if h.rootFiles == nil {
+			h.rootFiles = make(map[string]string)
+		}
+		for k, v := range files {
+			h.rootFiles["/"+strings.TrimPrefix(k, "/")] = strings.Trim(v, "/")
+		}
+	}
+}
+
+// rootFile returns the file system name mapped to the request path by
+// WithRootFiles. Returns false if the path is not mapped.
+func (h *fsHandler) rootFile(urlpath string) (string, bool) {
+	urlpath = path.Clean("/" + urlpath)
+	if name, ok := h.rootFiles[urlpath]; ok {
+		return name, true
+	}
+
+	// Use the longest directory mapping containing the path.
+	var prefix string
+	for k := range h.rootFiles {
+		if strings.HasSuffix(k, "/") && strings.HasPrefix(urlpath, k) && len(k) > len(prefix) {
+			prefix = k
+		}
+	}
+	if prefix == "" {
+		return "", false
+	}
+	return path.Join(h.rootFiles[prefix], strings.TrimPrefix(urlpath, prefix)), true
+}
+
+// serveRootFile serves the unhashed file mapped to a root level path.
+func (h *fsHandler) serveRootFile(w http.ResponseWriter, r *http.Request, filename string) {
+	f, name, _, err := h.fsys.open(r.Context(), filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		h.serveNotFound(w, r, err)
+		return
+	} else if err != nil {
+		h.serveError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		h.serveError(w, r, http.StatusInternalServerError, err)
+		return
+	} else if fi.IsDir() {
+		h.serveNotFound(w, r, &fs.PathError{Op: "open", Path: filename, Err: fs.ErrNotExist})
+		return
+	}
+
+	cacheControl := DefaultRootCacheControl
+	for _, rule := range h.cacheRules {
+		if matchGlob(rule.pattern, h.fsys.rel(name)) {
+			cacheControl = rule.value
+			break
+		}
+	}
+	h.serveFile(w, r, &asset{File: f, info: fi, name: name, cacheControl: cacheControl})
+}
+
+// varyHeaders returns the request headers that responses vary on based on
+// the enabled options.
+func (h *fsHandler) varyHeaders() []string {
+	var a []string
+	if len(h.corsOrigins) > 0 {
+		a = append(a, "Origin")
+	}
+	if len(h.encodings) > 0 || h.compression {
+		a = append(a, "Accept-Encoding")
+	}
+
+	for _, hdr := range h.varyUser {
+		hdr = http.CanonicalHeaderKey(strings.TrimSpace(hdr))
+		if hdr != "" && !containsFold(a, hdr) {
+			a = append(a, hdr)
+		}
+	}
+	return a
+}
+
+// containsFold returns true if a contains s, ignoring case.
+func containsFold(a []string, s string) bool {
+	for _, v := range a {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodingExts maps content encodings to the file extension of their
+// precompressed files.
+var encodingExts = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+	"zstd": ".zst",
+}
+
+type fsHandler struct {
+	fsys *FS
+
+	hashedCacheControl   string
+	unhashedCacheControl string
+	cacheRules           []cacheRule // ordered by precedence
+
+	notFoundHandler http.Handler
+	staleHashPolicy StaleHashPolicy
+	versionStore    VersionStore
+	spaIndex        string
+	indexFiles      []string
+	preloads        []string // files advertised via Link headers on HTML responses
+	earlyHints      bool     // if true, preloads are sent in a 103 response
+	headers         func(w http.Header, name string, hashed bool)
+	corsOrigins     []string
+	manifestPath    string // manifest endpoint, if enabled
+	bundlePath      string // bundle endpoint, if enabled
+	bundleFilter    func(name string) bool
+	byHashPath      string   // by-hash endpoint, if enabled
+	signedPatterns  []string // files that require a signature
+	denyPatterns    []string // files that are never served
+	authorize       func(r *http.Request, name string) bool
+	rewrite         func(r *http.Request, path string) string
+	varyUser        []string          // request headers declared with WithVary
+	rootFiles       map[string]string // file names by root level request path
+	canonicalPaths  bool              // if true, redirect to canonical paths
+	imageFormats    []string          // image variant formats, in order of preference
+	vary            []string          // request headers that all responses vary on
+	observer        func(r *http.Request, name string, status int, bytes int64, d time.Duration)
+	errorHandler    func(w http.ResponseWriter, r *http.Request, status int, err error)
+	dirListing      bool
+	dirListRenderer DirListRenderer
+
+	encodings []string // precompressed encodings, in order of preference
+
+	compression      bool
+	compressionLevel int
+	compressedMu     sync.Mutex
+	compressed       map[string]compressedFile // gzipped content of current files, by path
+
+	meta sync.Map // *fileMeta of served files, by path
+
+	warmMu  sync.Mutex
+	warmed  bool  // if true, the file system has been warmed
+	warmGen int64 // cache generation when last warmed
+}
+
+// fileMeta holds the file info of a served file so that HEAD & conditional
+// requests can be answered without accessing the underlying file system.
+type fileMeta struct {
+	hash string // digest of the content the info belongs to
+	info fs.FileInfo
+}
+
+// matches returns true if m holds the same metadata as hash & fi.
+func (m *fileMeta) matches(hash string, fi fs.FileInfo) bool {
+	return m.hash == hash && m.info.Size() == fi.Size() && m.info.ModTime().Equal(fi.ModTime())
+}
+
+func (h *fsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t := time.Now()
+	rw := &responseWriter{ResponseWriter: w}
+	if resolvedName(r.Context()) == nil {
+		r = r.WithContext(NewResolvedNameContext(r.Context()))
+	}
+	h.serveHTTP(rw, r)
+	h.fsys.addRequest(rw.statusCode())
+
+	if h.observer != nil {
+		h.observer(r, rw.name, rw.statusCode(), rw.n, time.Since(t))
+	}
+}
+
+func (h *fsHandler) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	// Declare variant dimensions up front so every response, including
+	// not modified & error responses, is cached consistently.
+	for _, hdr := range h.vary {
+		addVary(w.Header(), hdr)
+	}
+
+	// Set CORS headers and respond to preflight requests, if enabled.
+	if len(h.corsOrigins) > 0 && h.serveCORS(w, r) {
+		return
+	}
+
+	// Reject or redirect non-canonical paths, if enabled.
+	if h.canonicalPaths && h.serveCanonical(w, r) {
+		return
+	}
+
+	// Serve conventional root level files, which are never hashed.
+	if len(h.rootFiles) > 0 {
+		if name, ok := h.rootFile(r.URL.Path); ok {
+			h.serveRootFile(w, r, name)
+			return
+		}
+	}
+
+	// Strip the URL prefix of the file system, if set.
+	filename := r.URL.Path
+	if prefix := h.fsys.urlPrefix; prefix != "" {
+		if !strings.HasPrefix(filename, prefix) {
+			h.serveNotFound(w, r, &fs.PathError{Op: "open", Path: filename, Err: fs.ErrNotExist})
+			return
+		}
+		filename = "/" + strings.TrimPrefix(filename, prefix)
+	}
+
+	// Clean up filename based on URL path.
+	if filename == "/" {
+		filename = "."
+	} else {
+		filename = strings.TrimPrefix(filename, "/")
+	}
+	filename = path.Clean(filename)
+	trailingSlash := filename != "." && strings.HasSuffix(r.URL.Path, "/")
+
+	// Serve the manifest endpoint, if enabled.
+	if h.manifestPath != "" && filename == h.manifestPath {
+		h.serveManifest(w, r)
+		return
+	} else if h.bundlePath != "" && filename == h.bundlePath {
+		h.serveBundle(w, r)
+		return
+	} else if h.byHashPath != "" && strings.HasPrefix(filename, h.byHashPath+"/") {
+		h.serveByHash(w, r, strings.TrimPrefix(filename, h.byHashPath+"/"))
+		return
+	}
+
+	// Allow the application to map the path to a different file. Signatures
+	// are verified against the requested path.
+	requested := filename
+	if h.rewrite != nil {
+		filename = path.Clean(strings.TrimPrefix(h.rewrite(r, filename), "/"))
+	}
+
+	// Rebuild the hash name from the query string, if hashes are stored there.
+	if h.fsys.format.location == HashLocationQuery {
+		if v := r.URL.Query().Get("v"); v != "" {
+			requested = h.fsys.format.format(requested, v)
+			filename = h.fsys.format.format(filename, v)
+		}
+	}
+
+	// Reject invalid signatures. Unsigned requests for protected files are
+	// rejected once the original file is resolved.
+	signed, ok := h.verifyRequestSignature(r, requested)
+	if !ok {
+		h.serveError(w, r, http.StatusForbidden, errInvalidSignature)
+		return
+	}
+
+	// Resolve paths within hashed directories to their original paths. These
+	// are cached aggressively but the file itself is not requested by hash.
+	var hashedDir bool
+	if name, ok := h.fsys.resolveDir(h.fsys.path(filename)); ok {
+		filename, hashedDir = h.fsys.rel(name), true
+	}
+
+	// Respond to HEAD & conditional requests from cached metadata, if possible.
+	if a := h.cachedAsset(r, filename); a != nil {
+		if h.canonicalPaths && trailingSlash {
+			redirect(w, r, strings.TrimSuffix(r.URL.Path, "/"))
+			return
+		} else if hashedDir {
+			a.cacheControl = h.cacheControl(a.name, true)
+		}
+		a.signed = signed
+		h.serveFile(w, r, a)
+		return
+	}
+
+	// Read file from attached file system. If the file does not exist then
+	// other encodings of the path are tried.
+	e, _ := h.cachedEntry(filename)
+	f, name, hash, err := h.fsys.open(r.Context(), filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		if other, ok := h.normalize(filename); ok {
+			filename = other
+			e, _ = h.cachedEntry(filename)
+			f, name, hash, err = h.fsys.open(r.Context(), filename)
+		}
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		if h.serveVersion(w, r, filename) || h.serveStale(w, r, filename) {
+			return
+		}
+		h.serveNotFound(w, r, err)
+		return
+	} else if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// The request ended before the hash name could be resolved.
+		h.serveError(w, r, http.StatusServiceUnavailable, err)
+		return
+	} else if err != nil {
+		h.serveError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	defer f.Close()
+
+	// Fetch file info. Directories are only displayed if listings are enabled.
+	fi, err := f.Stat()
+	if err != nil {
+		h.serveError(w, r, http.StatusInternalServerError, err)
+		return
+	} else if h.denied(h.fsys.rel(name)) {
+		h.serveNotFound(w, r, &fs.PathError{Op: "open", Path: filename, Err: fs.ErrNotExist})
+		return
+	} else if !fi.IsDir() && h.fsys.excluded(name) {
+		h.serveNotFound(w, r, &fs.PathError{Op: "open", Path: filename, Err: ErrNotHashed})
+		return
+	} else if h.canonicalPaths && fi.IsDir() != trailingSlash && name != h.fsys.path(".") {
+		if fi.IsDir() {
+			redirect(w, r, r.URL.Path+"/")
+		} else {
+			redirect(w, r, strings.TrimSuffix(r.URL.Path, "/"))
+		}
+		return
+	} else if fi.IsDir() {
+		if h.serveIndex(w, r, name) {
+			return
+		} else if h.dirListing {
+			h.serveDirList(w, r, name)
+			return
+		}
+		h.serveError(w, r, http.StatusForbidden, &fs.PathError{Op: "open", Path: filename, Err: ErrIsDirectory})
+		return
+	}
+
+	// Cache the file aggressively if the file contains a hash.
+	h.serveFile(w, r, &asset{File: f, info: fi, name: name, hash: hash, cacheControl: h.cacheControl(name, hash != "" || hashedDir), hit: e != nil && e.name == name, signed: signed})
+}
+
+// normalize returns the name of the file requested by filename when the path
+// is still percent-encoded, such as when a router passes the raw path, or
+// uses a different Unicode normalization form than the file's name. The NFC
+// form is tried before the NFD form. It is only called once filename is known
+// not to exist so that other forms are not checked on every request. Returns
+// false if no other form exists or if filename only contains unescaped ASCII.
+func (h *fsHandler) normalize(filename string) (string, bool) {
+	if isPlainASCII(filename) {
+		return "", false
+	}
+
+	names := []string{filename}
+	if s, err := url.PathUnescape(filename); err == nil && s != filename {
+		names = append(names, path.Clean(s))
+	}
+
+	candidates := append([]string(nil), names...)
+	for _, s := range names {
+		candidates = append(candidates, norm.NFC.String(s), norm.NFD.String(s))
+	}
+
+	seen := map[string]bool{filename: true}
+	for _, s := range candidates {
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+
+		if _, err := fs.Stat(h.fsys, s); err == nil {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// isPlainASCII returns true if s only contains ASCII characters & no percent
+// signs, in which case no other encoding of s can exist.
+func isPlainASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf || s[i] == '%' {
+			return false
+		}
+	}
+	return true
+}
+
+// cachedAsset returns an asset without an open file for HEAD requests &
+// conditional requests that can be answered as not modified. Returns nil if
+// the file's metadata is not cached or the response requires the content.
+func (h *fsHandler) cachedAsset(r *http.Request, filename string) *asset {
+	if h.fsys.dev || r.Header.Get("Range") != "" {
+		return nil
+	} else if r.Method != "HEAD" && (r.Method != "GET" || (r.Header.Get("If-None-Match") == "" && r.Header.Get("If-Modified-Since") == "")) {
+		return nil
+	}
+
+	e, hash := h.cachedEntry(filename)
+	if e == nil {
+		return nil
+	}
+
+	// Encoded variants may be served so the content must be inspected.
+	if len(h.encodings) > 0 && !h.fsys.transformed(e.name) {
+		return nil
+	} else if len(h.imageFormats) > 0 && isImage(e.name) {
+		return nil
+	} else if h.compression && IsCompressible(typeByExtension(path.Ext(e.name))) && acceptsEncoding(r.Header.Get("Accept-Encoding"), "gzip") {
+		return nil
+	}
+
+	v, _ := h.meta.Load(e.name)
+	meta, _ := v.(*fileMeta)
+	if meta == nil || meta.hash != e.hashHex {
+		return nil
+	} else if r.Method == "GET" && !isNotModified(r, "\""+e.hashHex+"\"", meta.info.ModTime()) {
+		return nil
+	}
+
+	return &asset{info: meta.info, name: e.name, hash: hash, cacheControl: h.cacheControl(e.name, hash != ""), hit: true}
+}
+
+// cachedEntry resolves filename from the hash cache only, preferring hash
+// names. Returns the digest if filename is a hash name. Returns nil in
+// development mode since cached hashes are not used.
+func (h *fsHandler) cachedEntry(filename string) (e *entry, hash string) {
+	if h.fsys.dev {
+		return nil, ""
+	}
+
+	fullname := h.fsys.path(filename)
+	e = h.fsys.cached(fullname)
+	if base, _ := h.fsys.parse(fullname); base != fullname {
+		if be := h.fsys.cached(base); be != nil && be.hashName == fullname {
+			e, hash = be, be.hashHex
+		}
+	}
+	return e, hash
+}
+
+// cacheControl returns the Cache-Control header value for a path within the
+// underlying file system. Cache rules take precedence over the hashed &
+// unhashed values.
+func (h *fsHandler) cacheControl(name string, hashed bool) string {
+	rel := h.fsys.rel(name)
+	for _, rule := range h.cacheRules {
+		if matchGlob(rule.pattern, rel) {
+			return rule.value
+		}
+	}
+
+	if hashed {
+		return h.hashedCacheControl
+	}
+	return h.unhashedCacheControl
+}
+
+// asset represents a resolved file to be served. The file is nil if the
+// response is served from cached metadata only.
+type asset struct {
+	fs.File
+	info         fs.FileInfo
+	name         string // path within the underlying file system
+	hash         string // digest, if requested by hash name
+	cacheControl string // Cache-Control header value, if any
+	hit          bool   // if true, the hash was cached before the request
+	signed       bool   // if true, the request has a valid signature
+
+	// If true, the file is a previous version from the version store so
+	// encoded variants of the current file cannot be used.
+	versioned bool
+}
+
+// serveFile writes the contents of the asset to w.
+func (h *fsHandler) serveFile(w http.ResponseWriter, r *http.Request, a *asset) {
+	f, fi, name := fs.File(a.File), a.info, a.name
+	if h.denied(h.fsys.rel(name)) {
+		h.serveError(w, r, http.StatusNotFound, &fs.PathError{Op: "open", Path: h.fsys.rel(name), Err: fs.ErrNotExist})
+		return
+	} else if h.authorize != nil && !h.authorize(r, h.fsys.rel(name)) {
+		h.serveError(w, r, http.StatusForbidden, errNotAuthorized)
+		return
+	} else if !a.signed && h.signatureRequired(h.fsys.rel(name)) {
+		h.serveError(w, r, http.StatusForbidden, errInvalidSignature)
+		return
+	}
+
+	// Signed responses are only cached privately so they are not shared.
+	if a.signed {
+		a.cacheControl = SignedCacheControl
+	}
+	if rw, ok := w.(*responseWriter); ok {
+		rw.name = h.fsys.rel(name)
+	}
+
+	// Use the content hash as a strong ETag for both hashed & unhashed names
+	// so all requests can be revalidated cheaply.
+	digest := a.hash
+	if digest == "" {
+		if e, err := h.fsys.hashContext(r.Context(), name); err == nil {
+			digest = e.hashHex
+		}
+	}
+
+	if rn := resolvedName(r.Context()); rn != nil {
+		*rn = ResolvedName{Name: h.fsys.rel(name), Hash: digest, Hashed: a.hash != "", Hit: a.hit}
+	}
+
+	// Swap in a modern image format if the client accepts it. The variant is
+	// identified by its own content type & hash.
+	ctypeName, variant := name, false
+	if len(h.imageFormats) > 0 && isImage(name) {
+		addVary(w.Header(), "Accept")
+	}
+	if len(h.imageFormats) > 0 && isImage(name) && !a.versioned {
+		if vf, vfi, vname := h.openImageVariant(r, name); vf != nil {
+			defer vf.Close()
+			f, fi, ctypeName, variant = vf, vfi, vname, true
+			if e, err := h.fsys.hash(vname); err == nil {
+				digest = e.hashHex
+			}
+		}
+	}
+
+	// Swap in a precompressed variant of the file if the client accepts it.
+	// Otherwise compress the file on-the-fly, if enabled. The content type is
+	// derived from the original file's extension. Precompressed variants
+	// of transformed files are skipped as they contain the original content.
+	var encoding string
+	if len(h.encodings) > 0 && !a.versioned && !h.fsys.transformed(name) {
+		if ef, efi, enc := h.openEncoded(r, name); ef != nil {
+			defer ef.Close()
+			f, fi, encoding = ef, efi, enc
+		}
+	}
+	if encoding == "" && h.compression && IsCompressible(typeByExtension(path.Ext(name))) && acceptsEncoding(r.Header.Get("Accept-Encoding"), "gzip") {
+		buf, err := h.compress(f, name, digest)
+		if err != nil {
+			h.serveError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		f, encoding = &memFile{Reader: bytes.NewReader(buf), fi: fi}, "gzip"
+	}
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+
+	// Set the content type from the original extension rather than relying on
+	// the system's MIME registrations or content sniffing. Encoded content
+	// cannot be sniffed so it falls back to a generic type.
+	if ctype := h.fsys.contentType(ctypeName); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	} else if encoding != "" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+
+	// Cache metadata of unencoded files for later HEAD & conditional requests.
+	// Metadata is only stored when it changes since this runs on every request.
+	if a.File != nil && encoding == "" && !variant && digest != "" && !a.versioned {
+		if v, _ := h.meta.Load(name); v == nil || !v.(*fileMeta).matches(digest, fi) {
+			h.meta.Store(name, &fileMeta{hash: digest, info: fi})
+		}
+	}
+
+	// Encoded variants use a separate ETag since their content differs.
+	if etag := digest; etag != "" {
+		if encoding != "" {
+			etag += "-" + encoding
+		}
+		w.Header().Set("ETag", "\""+etag+"\"")
+	}
+
+	// Development mode always revalidates since content may change at any time.
+	if h.fsys.dev {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else if a.cacheControl != "" {
+		w.Header().Set("Cache-Control", a.cacheControl)
+	}
+
+	// Advertise critical assets on HTML responses so they can be preloaded.
+	if isHTML(name) {
+		if h.earlyHints && r.Method == "GET" {
+			writeEarlyHints(w, r, h.fsys, h.preloads)
+		} else {
+			for _, p := range h.preloads {
+				w.Header().Add("Link", h.fsys.preloadLink(p))
+			}
+		}
+	}
+
+	// Allow caller to set additional headers.
+	if h.headers != nil {
+		h.headers(w.Header(), h.fsys.rel(name), a.hash != "")
+	}
+
+	// Flush header and write content.
+	switch f := f.(type) {
+	case io.ReadSeeker:
+		http.ServeContent(w, r, name, fi.ModTime(), f)
+	default:
+		if modTime := fi.ModTime(); !isZeroTime(modTime) {
+			w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+		}
+
+		// Respond without content if the client's cached copy is still valid.
+		if isNotModified(r, w.Header().Get("ETag"), fi.ModTime()) {
+			writeNotModified(w)
+			return
+		}
+
+		// Serve a single byte range, if requested. Since the file cannot seek,
+		// the bytes before the range are read & discarded. Malformed &
+		// multi-range requests fall through and are served in full.
+		w.Header().Set("Accept-Ranges", "bytes")
+		if rng := r.Header.Get("Range"); rng != "" && isIfRangeMatch(r, w.Header().Get("ETag"), fi.ModTime()) {
+			start, length, err := parseRange(rng, fi.Size())
+			if err == errRangeNotSatisfiable {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", fi.Size()))
+				h.serveError(w, r, http.StatusRequestedRangeNotSatisfiable, err)
+				return
+			} else if err == nil {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, fi.Size()))
+				w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+				w.WriteHeader(http.StatusPartialContent)
+				if r.Method != "HEAD" {
+					if _, err := io.CopyN(io.Discard, f, start); err == nil {
+						io.CopyN(w, f, length)
+					}
+				}
+				return
+			}
+		}
+
+		// Set content length.
+		w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+
+		// Flush header and write content.
+		w.WriteHeader(http.StatusOK)
+		if r.Method != "HEAD" {
+			io.Copy(w, f)
+		}
+	}
+}
+
+// serveCORS sets the CORS headers for an allowed origin. Returns true if the
+// request was a preflight request and a response has been written.
+func (h *fsHandler) serveCORS(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+
+	allowed := ""
+	for _, o := range h.corsOrigins {
+		if o == "*" {
+			allowed = "*"
+			break
+		} else if strings.EqualFold(o, origin) {
+			allowed = origin
+			break
+		}
+	}
+
+	preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+	if allowed != "" {
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+		if preflight {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD")
+			if hdrs := r.Header.Get("Access-Control-Request-Headers"); hdrs != "" {
+				w.Header().Set("Access-Control-Allow-Headers", hdrs)
+			}
+			w.Header().Set("Access-Control-Max-Age", "86400")
+		} else {
+			w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Range, ETag")
+		}
+	}
+
+	if preflight {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return preflight
+}
+
+// serveVersion serves a previous version of a file from the version store.
+// Returns false if no store is set or it does not contain the version.
+func (h *fsHandler) serveVersion(w http.ResponseWriter, r *http.Request, filename string) bool {
+	if h.versionStore == nil {
+		return false
+	}
+
+	base, hash := h.fsys.ParseName(filename)
+	if hash == "" {
+		return false
+	}
+
+	f, err := h.versionStore.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		return false
+	}
+
+	h.serveFile(w, r, &asset{
+		File:         f,
+		info:         fi,
+		name:         h.fsys.path(base),
+		hash:         hash,
+		cacheControl: h.cacheControl(h.fsys.path(base), true),
+		versioned:    true,
+	})
+	return true
+}
+
+// warm hashes every file in the file system the first time it is called &
+// again only once cached hashes have been invalidated, so that endpoints that
+// list every file do not walk the file system on each request.
+func (h *fsHandler) warm(ctx context.Context) error {
+	h.warmMu.Lock()
+	defer h.warmMu.Unlock()
+
+	gen := atomic.LoadInt64(&h.fsys.cache.gen)
+	if h.warmed && h.warmGen == gen {
+		return nil
+	} else if err := h.fsys.Warm(ctx); err != nil {
+		return err
+	}
+	h.warmed, h.warmGen = true, gen
+	return nil
+}
+
+// serveManifest writes the manifest of every file in the file system as JSON.
+func (h *fsHandler) serveManifest(w http.ResponseWriter, r *http.Request) {
+	if err := h.warm(r.Context()); err != nil {
+		h.serveError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	m := h.fsys.Manifest()
+	for name := range m {
+		if h.denied(name) || (h.authorize != nil && !h.authorize(r, name)) {
+			delete(m, name)
+		}
+	}
+
+	buf, err := json.Marshal(m)
+	if err != nil {
+		h.serveError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	hash := sha256.Sum256(buf)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", "\""+hex.EncodeToString(hash[:])+"\"")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf))
+}
+
+// serveByHash serves the file whose content matches hash. Since the URL is
+// derived from the content, the file is cached as aggressively as hash names.
+func (h *fsHandler) serveByHash(w http.ResponseWriter, r *http.Request, hash string) {
+	f, e, err := h.fsys.openHash(hash)
+	if errors.Is(err, fs.ErrNotExist) {
+		h.serveNotFound(w, r, err)
+		return
+	} else if err != nil {
+		h.serveError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		h.serveError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.serveFile(w, r, &asset{File: f, info: fi, name: e.name, hash: e.hashHex, cacheControl: h.cacheControl(e.name, true)})
+}
+
+// serveBundle writes a gzipped tarball of files stored under their hash names.
+// Errors after the response has started cannot be reported so the archive is
+// truncated instead.
+func (h *fsHandler) serveBundle(w http.ResponseWriter, r *http.Request) {
+	if err := h.warm(r.Context()); err != nil {
+		h.serveError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	m := h.fsys.Manifest()
+	names := make([]string, 0, len(m))
+	for name := range m {
+		if (h.bundleFilter == nil || h.bundleFilter(name)) && (h.authorize == nil || h.authorize(r, name)) && !h.denied(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(h.bundlePath)))
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Method == "HEAD" {
+		return
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, name := range names {
+		if err := h.writeBundleFile(tw, name, m[name]); err != nil {
+			return
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return
+	}
+	gw.Close()
+}
+
+// writeBundleFile writes a single file to a bundle under its hash name.
+func (h *fsHandler) writeBundleFile(tw *tar.Writer, name, hashName string) error {
+	buf, err := h.fsys.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	modTime := time.Unix(0, 0)
+	if fi, err := h.fsys.Stat(name); err == nil && !fi.ModTime().IsZero() {
+		modTime = fi.ModTime()
+	}
+
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     hashName,
+		Mode:     0o644,
+		Size:     int64(len(buf)),
+		ModTime:  modTime,
+	}); err != nil {
+		return err
+	}
+	_, err = tw.Write(buf)
+	return err
+}
+
+// serveStale handles a request for a hash name that does not match the
+// current content of its file, according to the stale hash policy. Returns
+// false if filename is not a stale hash name or the policy is to not serve it.
+func (h *fsHandler) serveStale(w http.ResponseWriter, r *http.Request, filename string) bool {
+	if h.staleHashPolicy == StaleHashNotFound {
+		return false
+	}
+
+	base, hash := h.fsys.ParseName(filename)
+	if hash == "" {
+		return false
+	}
+	current, err := h.fsys.HashNameE(base)
+	if err != nil || current == filename {
+		return false
+	}
+
+	switch h.staleHashPolicy {
+	case StaleHashRedirect:
+		// Use a relative location since only the base name changes. This
+		// avoids needing to know any prefix stripped before the handler. The
+		// name is escaped & prefixed with "./" so that a colon is not read
+		// as a URL scheme.
+		var query string
+		if h.fsys.format.location == HashLocationQuery {
+			if i := strings.LastIndex(current, "?v="); i != -1 {
+				current, query = current[:i], current[i:]
+			}
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Location", "./"+(&url.URL{Path: path.Base(current)}).EscapedPath()+query)
+		w.WriteHeader(http.StatusFound)
+		return true
+
+	case StaleHashServe:
+		f, name, _, err := h.fsys.open(r.Context(), base)
+		if err != nil {
+			return false
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			return false
+		}
+		h.serveFile(w, r, &asset{File: f, info: fi, name: name, cacheControl: "no-cache"})
+		return true
+
+	default:
+		return false
+	}
+}
+
+// serveIndex serves the first index file that exists within dir. Returns
+// false if no index file exists.
+func (h *fsHandler) serveIndex(w http.ResponseWriter, r *http.Request, dir string) bool {
+	for _, index := range h.indexFiles {
+		name := path.Join(dir, index)
+		if h.fsys.excluded(name) {
+			continue
+		}
+		f, err := h.fsys.fsys.Open(name)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		if fi, err := f.Stat(); err == nil && !fi.IsDir() {
+			h.serveFile(w, r, &asset{File: f, info: fi, name: name, cacheControl: h.cacheControl(name, false)})
+			return true
+		}
+	}
+	return false
+}
+
+// serveNotFound responds to a request for a missing file. The err argument
+// describes why the file could not be found.
+func (h *fsHandler) serveNotFound(w http.ResponseWriter, r *http.Request, err error) {
+	// Serve the single-page app's index for page navigations, if enabled.
+	if h.spaIndex != "" && (r.Method == "GET" || r.Method == "HEAD") && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		if f, name, _, err := h.fsys.open(r.Context(), h.spaIndex); err == nil {
+			defer f.Close()
+			if fi, err := f.Stat(); err == nil && !fi.IsDir() {
+				h.serveFile(w, r, &asset{File: f, info: fi, name: name, cacheControl: "no-cache"})
+				return
+			}
+		}
+	}
+
+	if h.notFoundHandler != nil {
+		h.notFoundHandler.ServeHTTP(w, r)
+		return
+	}
+	h.serveError(w, r, http.StatusNotFound, err)
+}
+
+// openEncoded opens the first precompressed variant of name that is accepted
+// by the client. Returns a nil file if no variant is available.
+func (h *fsHandler) openEncoded(r *http.Request, name string) (fs.File, fs.FileInfo, string) {
+	for _, enc := range h.encodings {
+		ext, ok := encodingExts[enc]
+		if !ok || !acceptsEncoding(r.Header.Get("Accept-Encoding"), enc) {
+			continue
+		}
+
+		f, err := h.fsys.fsys.Open(name + ext)
+		if err != nil {
+			continue
+		}
+
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			f.Close()
+			continue
+		}
+		return f, fi, enc
+	}
+	return nil, nil, ""
+}
+
+// openImageVariant opens the first image variant of name whose content type
+// is accepted by the client. Returns a nil file if no variant is available.
+func (h *fsHandler) openImageVariant(r *http.Request, name string) (fs.File, fs.FileInfo, string) {
+	accept := r.Header.Get("Accept")
+	for _, format := range h.imageFormats {
+		// The Accept header uses the same list & quality syntax as
+		// Accept-Encoding. Wildcards such as "image/*" are ignored since
+		// clients list the modern formats they support explicitly.
+		if !acceptsEncoding(accept, "image/"+format) {
+			continue
+		}
+
+		vname := name + "." + format
+		f, err := h.fsys.fsys.Open(vname)
+		if err != nil {
+			continue
+		}
+
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			f.Close()
+			continue
+		}
+		return f, fi, vname
+	}
+	return nil, nil, ""
+}
+
+// compressedFile is the gzipped content of a file with a given content hash.
+type compressedFile struct {
+	hash string
+	data []byte
+}
+
+// compress returns the gzipped contents of f, which was opened from name.
+// Results are cached by name along with the file's content hash, if
+// available, so only the current content of each file is held in memory.
+func (h *fsHandler) compress(f fs.File, name, hash string) ([]byte, error) {
+	h.compressedMu.Lock()
+	c, ok := h.compressed[name]
+	h.compressedMu.Unlock()
+	if ok && hash != "" && c.hash == hash {
+		return c.data, nil
+	}
+
+	var b bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&b, h.compressionLevel)
+	if err != nil {
+		return nil, err
+	} else if _, err := io.Copy(zw, f); err != nil {
+		return nil, err
+	} else if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	// Replace the content of any previous version of the file.
+	h.compressedMu.Lock()
+	if hash == "" {
+		delete(h.compressed, name)
+	} else {
+		if h.compressed == nil {
+			h.compressed = make(map[string]compressedFile)
+		}
+		h.compressed[name] = compressedFile{hash: hash, data: b.Bytes()}
+	}
+	h.compressedMu.Unlock()
+
+	return b.Bytes(), nil
+}
+
+// isImage returns true if name has an image extension that modern formats can
+// replace.
+func isImage(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// isHTML returns true if name has an HTML file extension.
+func isHTML(name string) bool {
+	switch path.Ext(name) {
+	case ".html", ".htm":
+		return true
+	}
+	return false
+}
+
+// matchGlob reports whether name matches the slash-separated glob pattern. A
+// "**" element matches zero or more path elements.
+func matchGlob(pattern, name string) bool {
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		} else if len(name) == 0 {
+			return false
+		} else if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// isNotModified returns true if the request's conditional headers match the
+// given ETag or modification time. If-None-Match takes precedence over
+// If-Modified-Since as specified by RFC 7232.
+func isNotModified(r *http.Request, etag string, modTime time.Time) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" {
+			return false
+		}
+		for _, v := range strings.Split(inm, ",") {
+			if v = strings.TrimSpace(v); v == "*" || strings.TrimPrefix(v, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || isZeroTime(modTime) {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !modTime.Truncate(time.Second).After(t)
+}
+
+// isIfRangeMatch returns true if the Range header should be honored based on
+// the request's If-Range header, if any.
+func isIfRangeMatch(r *http.Request, etag string, modTime time.Time) bool {
+	ir := r.Header.Get("If-Range")
+	if ir == "" {
+		return true
+	} else if strings.HasPrefix(ir, `"`) {
+		return etag != "" && ir == etag
+	} else if t, err := http.ParseTime(ir); err == nil && !isZeroTime(modTime) {
+		return modTime.Truncate(time.Second).Equal(t)
+	}
+	return false
+}
+
+// errRangeNotSatisfiable is returned by parseRange when a range does not
+// overlap the content.
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// parseRange parses a Range header containing a single byte range and returns
+// the starting offset & length of the range within content of the given size.
+func parseRange(s string, size int64) (start, length int64, err error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(s, prefix) {
+		return 0, 0, errors.New("invalid range unit")
+	}
+	spec := strings.TrimSpace(s[len(prefix):])
+	if strings.Contains(spec, ",") {
+		return 0, 0, errors.New("multiple ranges not supported")
+	}
+
+	i := strings.Index(spec, "-")
+	if i == -1 {
+		return 0, 0, errors.New("invalid range")
+	}
+	first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+
+	// Parse suffix range (e.g. "-500" for the last 500 bytes).
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, errors.New("invalid range")
+		} else if n == 0 || size == 0 {
+			return 0, 0, errRangeNotSatisfiable
+		} else if n > size {
+			n = size
+		}
+		return size - n, n, nil
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, errors.New("invalid range")
+	} else if start >= size {
+		return 0, 0, errRangeNotSatisfiable
+	}
+
+	// Parse end of range. An open range extends to the end of the content.
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, errors.New("invalid range")
+		} else if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, nil
+}
+
+// writeNotModified writes a 304 response. Representation headers are removed
+// since no content is sent.
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	delete(h, "Content-Type")
+	delete(h, "Content-Length")
+	delete(h, "Content-Encoding")
+	if h.Get("ETag") != "" {
+		delete(h, "Last-Modified")
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// isZeroTime returns true if t is the zero time or the Unix epoch.
+func isZeroTime(t time.Time) bool {
+	return t.IsZero() || t.Equal(time.Unix(0, 0))
+}
+
+// addVary adds the value to the Vary header if it does not already exist.
+func addVary(hdr http.Header, value string) {
+	for _, v := range hdr.Values("Vary") {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), value) {
+				return
+			}
+		}
+	}
+	hdr.Add("Vary", value)
+}
+
+// acceptsEncoding returns true if the Accept-Encoding header value allows enc.
+// An explicitly listed encoding takes precedence over the "*" wildcard.
+func acceptsEncoding(header, enc string) bool {
+	wildcard := false
+	for _, v := range strings.Split(header, ",") {
+		coding, params := strings.TrimSpace(v), ""
+		if i := strings.Index(coding, ";"); i != -1 {
+			coding, params = strings.TrimSpace(coding[:i]), coding[i+1:]
+		}
+
+		// Encodings with a zero quality value are explicitly not acceptable.
+		ok := true
+		if q := strings.ReplaceAll(params, " ", ""); strings.HasPrefix(q, "q=") {
+			if v, err := strconv.ParseFloat(q[2:], 64); err == nil && v == 0 {
+				ok = false
+			}
+		}
+
+		switch coding {
+		case enc:
+			return ok
+		case "*":
+			wildcard = ok
+		}
+	}
+	return wildcard
+}
+
+// responseWriter wraps an http.ResponseWriter to record the status code,
+// number of bytes written & the name of the file served.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	n      int64
+	name   string // original name of the file served, if any
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	// Informational responses, such as Early Hints, precede the final status.
+	if w.status == 0 && (code < 100 || code > 199) {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// ReadFrom delegates to the underlying writer, if supported, so that
+// optimizations such as sendfile are preserved.
+func (w *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(w.ResponseWriter, r)
+	}
+	w.n += n
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for use by http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// statusCode returns the status code written, defaulting to 200.
+func (w *responseWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
@@ -0,0 +1,1789 @@
+package hashfs_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestFileServer(t *testing.T) {
+	t.Run("NoHash", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "testdata/baz.html", nil)
+		w := httptest.NewRecorder()
+		h := hashfs.FileServer(fsys)
+		h.ServeHTTP(w, r)
+
+		hdr := w.Result().Header
+		if got, want := w.Code, 200; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := hdr.Get("Cache-Control"), ``; got != want {
+			t.Fatalf("cache-control=%v, want %v", got, want)
+		} else if got, want := hdr.Get("Content-Type"), `text/html; charset=utf-8`; got != want {
+			t.Fatalf("content-type=%v, want %v", got, want)
+		} else if got, want := hdr.Get("Content-Length"), `13`; got != want {
+			t.Fatalf("content-length=%v, want %v", got, want)
+		} else if got, want := hdr.Get("ETag"), `"b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628"`; got != want {
+			t.Fatalf("etag=%v, want %v", got, want)
+		} else if got, want := w.Body.String(), `<html></html>`; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("WithHash", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "testdata/baz-b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628.html", nil)
+		h := hashfs.FileServer(fsys)
+		hash := "\"b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628\""
+
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			hdr := w.Result().Header
+			if got, want := w.Code, 200; got != want {
+				t.Fatalf("code=%v, want %v", got, want)
+			} else if got, want := hdr.Get("Cache-Control"), `public, max-age=31536000, immutable`; got != want {
+				t.Fatalf("cache-control=%v, want %v", got, want)
+			} else if got, want := hdr.Get("Content-Type"), `text/html; charset=utf-8`; got != want {
+				t.Fatalf("content-type=%v, want %v", got, want)
+			} else if got, want := hdr.Get("Content-Length"), `13`; got != want {
+				t.Fatalf("content-length=%v, want %v", got, want)
+			} else if got, want := hdr.Get("ETag"), hash; got != want {
+				t.Fatalf("etag=%v, want %v", got, want)
+			} else if got, want := w.Body.String(), `<html></html>`; got != want {
+				t.Fatalf("body=%q, want %q", got, want)
+			}
+		}
+	})
+
+	t.Run("WithHashLength", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "testdata/baz-b633a587.html", nil)
+		w := httptest.NewRecorder()
+		h := hashfs.FileServer(hashfs.NewFS(fsys, hashfs.WithHashLength(8)))
+		h.ServeHTTP(w, r)
+
+		hdr := w.Result().Header
+		if got, want := w.Code, 200; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := hdr.Get("ETag"), "\"b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628\""; got != want {
+			t.Fatalf("etag=%v, want %v", got, want)
+		} else if got, want := w.Body.String(), `<html></html>`; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "nosuchfile", nil)
+		w := httptest.NewRecorder()
+		h := hashfs.FileServer(fsys)
+		h.ServeHTTP(w, r)
+
+		if got, want := w.Code, 404; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Body.String(), "404 page not found\n"; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("WithNotFoundHandler", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "nosuchfile", nil)
+		w := httptest.NewRecorder()
+		h := hashfs.FileServer(fsys, hashfs.WithNotFoundHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+			w.Write([]byte("custom"))
+		})))
+		h.ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusTeapot; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Body.String(), "custom"; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("WithSPAFallback", func(t *testing.T) {
+		h := hashfs.FileServer(fsys, hashfs.WithSPAFallback("testdata/baz.html"))
+
+		r, _ := http.NewRequest("GET", "app/settings", nil)
+		r.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if got, want := w.Code, 200; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Result().Header.Get("Cache-Control"), "no-cache"; got != want {
+			t.Fatalf("cache-control=%v, want %v", got, want)
+		} else if got, want := w.Body.String(), `<html></html>`; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+
+		// Non-HTML requests should still receive a 404.
+		r, _ = http.NewRequest("GET", "app/missing.js", nil)
+		r.Header.Set("Accept", "*/*")
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Code, 404; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("WithIndexFiles", func(t *testing.T) {
+		mfs := fstest.MapFS{
+			"index.html":      {Data: []byte(`root`)},
+			"docs/index.htm":  {Data: []byte(`docs`)},
+			"empty/README.md": {Data: []byte(`readme`)},
+		}
+		h := hashfs.FileServer(mfs, hashfs.WithIndexFiles("index.html", "index.htm"))
+
+		for _, tt := range []struct {
+			path string
+			code int
+			body string
+		}{
+			{"/", 200, "root"},
+			{"/docs/", 200, "docs"},
+			{"/empty/", 403, "403 Forbidden\n"},
+		} {
+			r, _ := http.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if got, want := w.Code, tt.code; got != want {
+				t.Fatalf("%s: code=%v, want %v", tt.path, got, want)
+			} else if got, want := w.Body.String(), tt.body; got != want {
+				t.Fatalf("%s: body=%q, want %q", tt.path, got, want)
+			} else if got, want := w.Result().Header.Get("Cache-Control"), ""; got != want {
+				t.Fatalf("%s: cache-control=%v, want %v", tt.path, got, want)
+			}
+		}
+	})
+
+	t.Run("WithURLPrefix", func(t *testing.T) {
+		f := hashfs.NewFS(fsys, hashfs.WithURLPrefix("/static/"))
+		h := hashfs.FileServer(f)
+
+		r, _ := http.NewRequest("GET", f.URL("testdata/baz.html"), nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Code, 200; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Body.String(), `<html></html>`; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+
+		// Paths outside the prefix are not found.
+		r, _ = http.NewRequest("GET", "/testdata/baz.html", nil)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Code, 404; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("StaleHash", func(t *testing.T) {
+		const stale = "testdata/baz-0000000000000000000000000000000000000000000000000000000000000000.html"
+
+		t.Run("NotFound", func(t *testing.T) {
+			r, _ := http.NewRequest("GET", stale, nil)
+			w := httptest.NewRecorder()
+			hashfs.FileServer(fsys).ServeHTTP(w, r)
+			if got, want := w.Code, 404; got != want {
+				t.Fatalf("code=%v, want %v", got, want)
+			}
+		})
+
+		t.Run("Redirect", func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/"+stale, nil)
+			w := httptest.NewRecorder()
+			hashfs.FileServer(fsys, hashfs.WithStaleHashPolicy(hashfs.StaleHashRedirect)).ServeHTTP(w, r)
+			if got, want := w.Code, http.StatusFound; got != want {
+				t.Fatalf("code=%v, want %v", got, want)
+			} else if got, want := w.Result().Header.Get("Location"), "./baz-b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628.html"; got != want {
+				t.Fatalf("location=%v, want %v", got, want)
+			}
+		})
+
+		// Locations are escaped so that names form valid relative URLs.
+		t.Run("RedirectEscape", func(t *testing.T) {
+			mfs := fstest.MapFS{"a:caf\u00e9 1.js": {Data: []byte(`foo`)}}
+			r := httptest.NewRequest("GET", "/", nil)
+			r.URL.Path = "/a:caf\u00e9 1-00000000.js"
+			w := httptest.NewRecorder()
+			hashfs.FileServer(hashfs.NewFS(mfs, hashfs.WithHashLength(8)), hashfs.WithStaleHashPolicy(hashfs.StaleHashRedirect)).ServeHTTP(w, r)
+			if got, want := w.Code, http.StatusFound; got != want {
+				t.Fatalf("code=%v, want %v", got, want)
+			} else if got, want := w.Result().Header.Get("Location"), "./a:caf%C3%A9%201-2c26b46b.js"; got != want {
+				t.Fatalf("location=%v, want %v", got, want)
+			}
+		})
+
+		t.Run("Serve", func(t *testing.T) {
+			r, _ := http.NewRequest("GET", stale, nil)
+			w := httptest.NewRecorder()
+			hashfs.FileServer(fsys, hashfs.WithStaleHashPolicy(hashfs.StaleHashServe)).ServeHTTP(w, r)
+			if got, want := w.Code, 200; got != want {
+				t.Fatalf("code=%v, want %v", got, want)
+			} else if got, want := w.Result().Header.Get("Cache-Control"), "no-cache"; got != want {
+				t.Fatalf("cache-control=%v, want %v", got, want)
+			} else if got, want := w.Body.String(), `<html></html>`; got != want {
+				t.Fatalf("body=%q, want %q", got, want)
+			}
+		})
+
+		t.Run("MissingBase", func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "testdata/nosuchfile-0000000000000000000000000000000000000000000000000000000000000000.html", nil)
+			w := httptest.NewRecorder()
+			hashfs.FileServer(fsys, hashfs.WithStaleHashPolicy(hashfs.StaleHashRedirect)).ServeHTTP(w, r)
+			if got, want := w.Code, 404; got != want {
+				t.Fatalf("code=%v, want %v", got, want)
+			}
+		})
+	})
+
+	t.Run("WithVersionStore", func(t *testing.T) {
+		const old = "main-0000000000000000000000000000000000000000000000000000000000000000.js"
+		mfs := fstest.MapFS{"main.js": {Data: []byte(`new`)}}
+		store := fstest.MapFS{old: {Data: []byte(`old`)}}
+		h := hashfs.FileServer(mfs, hashfs.WithVersionStore(store), hashfs.WithStaleHashPolicy(hashfs.StaleHashRedirect))
+
+		r, _ := http.NewRequest("GET", old, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		hdr := w.Result().Header
+		if got, want := w.Code, 200; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := hdr.Get("Cache-Control"), hashfs.DefaultCacheControl; got != want {
+			t.Fatalf("cache-control=%v, want %v", got, want)
+		} else if got, want := hdr.Get("Content-Type"), "text/javascript; charset=utf-8"; got != want {
+			t.Fatalf("content-type=%v, want %v", got, want)
+		} else if got, want := hdr.Get("ETag"), `"0000000000000000000000000000000000000000000000000000000000000000"`; got != want {
+			t.Fatalf("etag=%v, want %v", got, want)
+		} else if got, want := w.Body.String(), "old"; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+
+		// Versions missing from the store should fall through to the stale policy.
+		r, _ = http.NewRequest("GET", "main-1111111111111111111111111111111111111111111111111111111111111111.js", nil)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusFound; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("WithDev", func(t *testing.T) {
+		f := hashfs.NewFS(fsys, hashfs.WithDev(true))
+		h := hashfs.FileServer(f)
+
+		for _, name := range []string{"testdata/baz.html", f.HashName("testdata/baz.html")} {
+			r, _ := http.NewRequest("GET", name, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got, want := w.Code, 200; got != want {
+				t.Fatalf("code=%v, want %v", got, want)
+			} else if got, want := w.Result().Header.Get("Cache-Control"), "no-cache"; got != want {
+				t.Fatalf("cache-control=%v, want %v", got, want)
+			}
+		}
+	})
+
+	t.Run("Dir", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "testdata", nil)
+		w := httptest.NewRecorder()
+		h := hashfs.FileServer(fsys)
+		h.ServeHTTP(w, r)
+
+		if got, want := w.Code, 403; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Body.String(), "403 Forbidden\n"; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Root", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		h := hashfs.FileServer(fsys)
+		h.ServeHTTP(w, r)
+
+		if got, want := w.Code, 403; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Body.String(), "403 Forbidden\n"; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Precompressed", func(t *testing.T) {
+		mfs := fstest.MapFS{
+			"main.js":    {Data: []byte(`var x = 1;`)},
+			"main.js.br": {Data: []byte(`BROTLI`)},
+			"main.js.gz": {Data: []byte(`GZIP`)},
+			"style.css":  {Data: []byte(`body{}`)},
+		}
+		h := hashfs.FileServer(mfs, hashfs.WithPrecompressed())
+
+		for _, tt := range []struct {
+			path           string
+			acceptEncoding string
+			encoding       string
+			body           string
+		}{
+			{"main.js", "gzip, br", "br", "BROTLI"},
+			{"main.js", "gzip", "gzip", "GZIP"},
+			{"main.js", "gzip, br;q=0", "gzip", "GZIP"},
+			{"main.js", "*", "br", "BROTLI"},
+			{"main.js", "", "", "var x = 1;"},
+			{"style.css", "gzip, br", "", "body{}"},
+		} {
+			r, _ := http.NewRequest("GET", tt.path, nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			hdr := w.Result().Header
+			if got, want := w.Code, 200; got != want {
+				t.Fatalf("code=%v, want %v", got, want)
+			} else if got, want := hdr.Get("Content-Encoding"), tt.encoding; got != want {
+				t.Fatalf("%s (%s): content-encoding=%v, want %v", tt.path, tt.acceptEncoding, got, want)
+			} else if got, want := hdr.Get("Content-Type"), mime.TypeByExtension(path.Ext(tt.path)); got != want {
+				t.Fatalf("content-type=%v, want %v", got, want)
+			} else if got, want := hdr.Get("Vary"), "Accept-Encoding"; got != want {
+				t.Fatalf("vary=%v, want %v", got, want)
+			} else if got, want := w.Body.String(), tt.body; got != want {
+				t.Fatalf("body=%q, want %q", got, want)
+			}
+		}
+	})
+
+	t.Run("PrecompressedWithHash", func(t *testing.T) {
+		mfs := fstest.MapFS{
+			"main.js":    {Data: []byte(`var x = 1;`)},
+			"main.js.gz": {Data: []byte(`GZIP`)},
+		}
+		fsys := hashfs.NewFS(mfs, hashfs.WithHashLength(8))
+		h := hashfs.FileServer(fsys, hashfs.WithPrecompressed("gzip"))
+
+		r, _ := http.NewRequest("GET", fsys.HashName("main.js"), nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		hdr := w.Result().Header
+		if got, want := hdr.Get("Content-Encoding"), "gzip"; got != want {
+			t.Fatalf("content-encoding=%v, want %v", got, want)
+		} else if got, want := hdr.Get("Cache-Control"), `public, max-age=31536000, immutable`; got != want {
+			t.Fatalf("cache-control=%v, want %v", got, want)
+		} else if etag := hdr.Get("ETag"); !strings.HasSuffix(etag, `-gzip"`) {
+			t.Fatalf("unexpected etag: %v", etag)
+		} else if got, want := w.Body.String(), "GZIP"; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Compression", func(t *testing.T) {
+		mfs := fstest.MapFS{
+			"main.js":    {Data: []byte(strings.Repeat("var x = 1;\n", 100))},
+			"main.js.br": {Data: []byte(`BROTLI`)},
+			"image.png":  {Data: []byte(`PNG`)},
+		}
+		fsys := hashfs.NewFS(mfs)
+		h := hashfs.FileServer(fsys, hashfs.WithPrecompressed("br"), hashfs.WithCompression(gzip.BestSpeed))
+
+		// Compress when client only accepts gzip.
+		for i := 0; i < 2; i++ {
+			r, _ := http.NewRequest("GET", "main.js", nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			hdr := w.Result().Header
+			if got, want := hdr.Get("Content-Encoding"), "gzip"; got != want {
+				t.Fatalf("content-encoding=%v, want %v", got, want)
+			} else if got, want := hdr.Values("Vary"), []string{"Accept-Encoding"}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("vary=%v, want %v", got, want)
+			}
+
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			} else if buf, err := io.ReadAll(zr); err != nil {
+				t.Fatal(err)
+			} else if got, want := string(buf), string(mfs["main.js"].Data); got != want {
+				t.Fatalf("body=%q, want %q", got, want)
+			}
+		}
+
+		// Changed content is compressed again.
+		mfs["main.js"] = &fstest.MapFile{Data: []byte(strings.Repeat("var y = 2;\n", 100))}
+		fsys.Invalidate("main.js")
+		r, _ := http.NewRequest("GET", "main.js", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if zr, err := gzip.NewReader(w.Body); err != nil {
+			t.Fatal(err)
+		} else if buf, err := io.ReadAll(zr); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), string(mfs["main.js"].Data); got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+
+		// Prefer precompressed variants.
+		r, _ = http.NewRequest("GET", "main.js", nil)
+		r.Header.Set("Accept-Encoding", "gzip, br")
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Result().Header.Get("Content-Encoding"), "br"; got != want {
+			t.Fatalf("content-encoding=%v, want %v", got, want)
+		}
+
+		// Skip incompressible types.
+		r, _ = http.NewRequest("GET", "image.png", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Result().Header.Get("Content-Encoding"), ""; got != want {
+			t.Fatalf("content-encoding=%v, want %v", got, want)
+		} else if got, want := w.Body.String(), "PNG"; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("WithCacheControl", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{"main.js": {Data: []byte(`var x = 1;`)}})
+		h := hashfs.FileServer(fsys, hashfs.WithCacheControl("public, max-age=3600", "no-cache"))
+
+		for _, tt := range []struct {
+			path string
+			want string
+		}{
+			{fsys.HashName("main.js"), "public, max-age=3600"},
+			{"main.js", "no-cache"},
+		} {
+			r, _ := http.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got := w.Result().Header.Get("Cache-Control"); got != tt.want {
+				t.Fatalf("%s: cache-control=%v, want %v", tt.path, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("NotModified", func(t *testing.T) {
+		modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		fsys := hashfs.NewFS(&nonSeekableFS{fstest.MapFS{"main.js": {Data: []byte(`var x = 1;`), ModTime: modTime}}})
+		h := hashfs.FileServer(fsys)
+		hashName := fsys.HashName("main.js")
+		_, hash := fsys.ParseName(hashName)
+
+		for _, tt := range []struct {
+			name   string
+			path   string
+			header string
+			value  string
+			code   int
+		}{
+			{"IfNoneMatch", hashName, "If-None-Match", `"` + hash + `"`, http.StatusNotModified},
+			{"IfNoneMatchList", hashName, "If-None-Match", `"xyz", W/"` + hash + `"`, http.StatusNotModified},
+			{"IfNoneMatchMismatch", hashName, "If-None-Match", `"xyz"`, http.StatusOK},
+			{"IfModifiedSince", "main.js", "If-Modified-Since", modTime.Format(http.TimeFormat), http.StatusNotModified},
+			{"IfModifiedSinceStale", "main.js", "If-Modified-Since", modTime.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				r, _ := http.NewRequest("GET", tt.path, nil)
+				r.Header.Set(tt.header, tt.value)
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+
+				if got, want := w.Code, tt.code; got != want {
+					t.Fatalf("code=%v, want %v", got, want)
+				} else if tt.code == http.StatusNotModified && w.Body.Len() != 0 {
+					t.Fatalf("unexpected body: %q", w.Body.String())
+				} else if tt.code == http.StatusOK && w.Body.String() != `var x = 1;` {
+					t.Fatalf("unexpected body: %q", w.Body.String())
+				}
+			})
+		}
+	})
+
+	t.Run("NoHashNotModified", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", "testdata/baz.html", nil)
+		r.Header.Set("If-None-Match", `"b633a587c652d02386c4f16f8c6f6aab7352d97f16367c3c40576214372dd628"`)
+		w := httptest.NewRecorder()
+		hashfs.FileServer(fsys).ServeHTTP(w, r)
+
+		if got, want := w.Code, http.StatusNotModified; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Result().Header.Get("Cache-Control"), ""; got != want {
+			t.Fatalf("cache-control=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("RangeNonSeekable", func(t *testing.T) {
+		fsys := hashfs.NewFS(&nonSeekableFS{fstest.MapFS{"data.bin": {Data: []byte(`0123456789`)}}})
+		h := hashfs.FileServer(fsys)
+		etag := `"` + hex.EncodeToString(mustHashOf(t, fsys, "data.bin")) + `"`
+
+		for _, tt := range []struct {
+			name         string
+			rng          string
+			ifRange      string
+			code         int
+			contentRange string
+			body         string
+		}{
+			{"Bounded", "bytes=2-5", "", http.StatusPartialContent, "bytes 2-5/10", "2345"},
+			{"Open", "bytes=7-", "", http.StatusPartialContent, "bytes 7-9/10", "789"},
+			{"Suffix", "bytes=-3", "", http.StatusPartialContent, "bytes 7-9/10", "789"},
+			{"EndPastSize", "bytes=8-100", "", http.StatusPartialContent, "bytes 8-9/10", "89"},
+			{"IfRangeMatch", "bytes=0-0", etag, http.StatusPartialContent, "bytes 0-0/10", "0"},
+			{"IfRangeMismatch", "bytes=0-0", `"xyz"`, http.StatusOK, "", "0123456789"},
+			{"MultiRange", "bytes=0-1,3-4", "", http.StatusOK, "", "0123456789"},
+			{"Unsatisfiable", "bytes=20-", "", http.StatusRequestedRangeNotSatisfiable, "bytes */10", "416 Requested Range Not Satisfiable\n"},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				r, _ := http.NewRequest("GET", "data.bin", nil)
+				r.Header.Set("Range", tt.rng)
+				if tt.ifRange != "" {
+					r.Header.Set("If-Range", tt.ifRange)
+				}
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+
+				if got, want := w.Code, tt.code; got != want {
+					t.Fatalf("code=%v, want %v", got, want)
+				} else if got, want := w.Result().Header.Get("Content-Range"), tt.contentRange; got != want {
+					t.Fatalf("content-range=%v, want %v", got, want)
+				} else if got, want := w.Body.String(), tt.body; got != want {
+					t.Fatalf("body=%q, want %q", got, want)
+				}
+			})
+		}
+	})
+
+	t.Run("WithPreload", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{
+			"index.html": {Data: []byte(`<html></html>`)},
+			"app.css":    {Data: []byte(`foo`)},
+			"app.js":     {Data: []byte(`bar`)},
+		}, hashfs.WithHashLength(8), hashfs.WithURLPrefix("/static/"))
+		h := hashfs.FileServer(fsys, hashfs.WithPreload("app.css", "app.js"))
+
+		r, _ := http.NewRequest("GET", "/static/index.html", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Result().Header.Values("Link"), []string{
+			"</static/app-2c26b46b.css>; rel=preload; as=style",
+			"</static/app-fcde2b2e.js>; rel=preload; as=script",
+		}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("link=%v, want %v", got, want)
+		}
+
+		// Non-HTML responses do not include preload links.
+		r, _ = http.NewRequest("GET", "/static/app.js", nil)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got := w.Result().Header.Values("Link"); len(got) != 0 {
+			t.Fatalf("unexpected link: %v", got)
+		}
+	})
+
+	t.Run("ContentType", func(t *testing.T) {
+		// Simulate an environment with an incorrect system registration.
+		if err := mime.AddExtensionType(".css", "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+
+		fsys := hashfs.NewFS(fstest.MapFS{
+			"main.css":   {Data: []byte(`body{}`)},
+			"font.woff2": {Data: []byte(`wOF2`)},
+		})
+		h := hashfs.FileServer(fsys)
+
+		for _, tt := range []struct {
+			path string
+			want string
+		}{
+			{fsys.HashName("main.css"), "text/css; charset=utf-8"},
+			{"font.woff2", "font/woff2"},
+		} {
+			r, _ := http.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got := w.Result().Header.Get("Content-Type"); got != tt.want {
+				t.Fatalf("%s: content-type=%v, want %v", tt.path, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("WithContentType", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{"data.jsonld": {Data: []byte(`{}`)}}, hashfs.WithContentType(func(name string) string {
+			return "application/ld+json"
+		}))
+
+		r, _ := http.NewRequest("GET", "data.jsonld", nil)
+		w := httptest.NewRecorder()
+		hashfs.FileServer(fsys).ServeHTTP(w, r)
+		if got, want := w.Result().Header.Get("Content-Type"), "application/ld+json"; got != want {
+			t.Fatalf("content-type=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("WithHeaders", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{"main.js": {Data: []byte(`var x = 1;`)}})
+		h := hashfs.FileServer(fsys, hashfs.WithHeaders(func(w http.Header, name string, hashed bool) {
+			w.Set("X-Content-Type-Options", "nosniff")
+			w.Set("X-Name", name)
+			if hashed {
+				w.Set("Cache-Control", "private")
+			}
+		}))
+
+		for _, tt := range []struct {
+			path         string
+			cacheControl string
+		}{
+			{fsys.HashName("main.js"), "private"},
+			{"main.js", ""},
+		} {
+			r, _ := http.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			hdr := w.Result().Header
+			if got, want := hdr.Get("X-Content-Type-Options"), "nosniff"; got != want {
+				t.Fatalf("%s: x-content-type-options=%v, want %v", tt.path, got, want)
+			} else if got, want := hdr.Get("X-Name"), "main.js"; got != want {
+				t.Fatalf("%s: x-name=%v, want %v", tt.path, got, want)
+			} else if got, want := hdr.Get("Cache-Control"), tt.cacheControl; got != want {
+				t.Fatalf("%s: cache-control=%v, want %v", tt.path, got, want)
+			}
+		}
+	})
+
+	t.Run("WithCORS", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{"font.woff2": {Data: []byte(`wOF2`)}})
+		h := hashfs.FileServer(fsys, hashfs.WithCORS("https://example.com"))
+
+		t.Run("Allowed", func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "font.woff2", nil)
+			r.Header.Set("Origin", "https://example.com")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got, want := w.Code, http.StatusOK; got != want {
+				t.Fatalf("code=%v, want %v", got, want)
+			} else if got, want := w.Result().Header.Get("Access-Control-Allow-Origin"), "https://example.com"; got != want {
+				t.Fatalf("allow-origin=%v, want %v", got, want)
+			} else if got, want := w.Result().Header.Get("Vary"), "Origin"; got != want {
+				t.Fatalf("vary=%v, want %v", got, want)
+			}
+		})
+
+		t.Run("Disallowed", func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "font.woff2", nil)
+			r.Header.Set("Origin", "https://evil.com")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got := w.Result().Header.Get("Access-Control-Allow-Origin"); got != "" {
+				t.Fatalf("unexpected allow-origin: %v", got)
+			}
+		})
+
+		t.Run("Preflight", func(t *testing.T) {
+			r, _ := http.NewRequest("OPTIONS", "font.woff2", nil)
+			r.Header.Set("Origin", "https://example.com")
+			r.Header.Set("Access-Control-Request-Method", "GET")
+			r.Header.Set("Access-Control-Request-Headers", "range")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got, want := w.Code, http.StatusNoContent; got != want {
+				t.Fatalf("code=%v, want %v", got, want)
+			} else if got, want := w.Result().Header.Get("Access-Control-Allow-Methods"), "GET, HEAD"; got != want {
+				t.Fatalf("allow-methods=%v, want %v", got, want)
+			} else if got, want := w.Result().Header.Get("Access-Control-Allow-Headers"), "range"; got != want {
+				t.Fatalf("allow-headers=%v, want %v", got, want)
+			} else if got := w.Body.String(); got != "" {
+				t.Fatalf("unexpected body: %q", got)
+			}
+		})
+
+		t.Run("Wildcard", func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "font.woff2", nil)
+			r.Header.Set("Origin", "https://other.com")
+			w := httptest.NewRecorder()
+			hashfs.FileServer(fsys, hashfs.WithCORS("*")).ServeHTTP(w, r)
+			if got, want := w.Result().Header.Get("Access-Control-Allow-Origin"), "*"; got != want {
+				t.Fatalf("allow-origin=%v, want %v", got, want)
+			}
+		})
+	})
+
+	t.Run("CachedMetadata", func(t *testing.T) {
+		cfs := &countingFS{FS: fstest.MapFS{"main.js": {Data: []byte(`var x = 1;`), ModTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}}}
+		fsys := hashfs.NewFS(cfs)
+		h := hashfs.FileServer(fsys)
+		hashName := fsys.HashName("main.js")
+		etag := `"` + hex.EncodeToString(mustHashOf(t, fsys, "main.js")) + `"`
+
+		// Initial request reads the file & caches its metadata.
+		r, _ := http.NewRequest("GET", hashName, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+		n := cfs.n
+
+		r, _ = http.NewRequest("HEAD", hashName, nil)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Result().Header.Get("Content-Length"), "10"; got != want {
+			t.Fatalf("content-length=%v, want %v", got, want)
+		} else if got, want := w.Result().Header.Get("ETag"), etag; got != want {
+			t.Fatalf("etag=%v, want %v", got, want)
+		} else if got, want := w.Result().Header.Get("Cache-Control"), hashfs.DefaultCacheControl; got != want {
+			t.Fatalf("cache-control=%v, want %v", got, want)
+		} else if got := w.Body.String(); got != "" {
+			t.Fatalf("unexpected body: %q", got)
+		}
+
+		r, _ = http.NewRequest("GET", "main.js", nil)
+		r.Header.Set("If-None-Match", etag)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusNotModified; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+
+		if got, want := cfs.n, n; got != want {
+			t.Fatalf("opens=%d, want %d", got, want)
+		}
+
+		// Requests for changed content must read the file.
+		r, _ = http.NewRequest("GET", "main.js", nil)
+		r.Header.Set("If-None-Match", `"xyz"`)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Body.String(), `var x = 1;`; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("WithObserver", func(t *testing.T) {
+		type observation struct {
+			path   string
+			name   string
+			status int
+			bytes  int64
+		}
+		var got []observation
+		fsys := hashfs.NewFS(fstest.MapFS{"main.js": {Data: []byte(`var x = 1;`)}})
+		h := hashfs.FileServer(fsys, hashfs.WithObserver(func(r *http.Request, name string, status int, bytes int64, d time.Duration) {
+			if d < 0 {
+				t.Fatalf("unexpected duration: %s", d)
+			}
+			got = append(got, observation{r.URL.Path, name, status, bytes})
+		}))
+
+		for _, path := range []string{fsys.HashName("main.js"), "missing.js"} {
+			r, _ := http.NewRequest("GET", path, nil)
+			h.ServeHTTP(httptest.NewRecorder(), r)
+		}
+
+		if want := []observation{
+			{fsys.HashName("main.js"), "main.js", http.StatusOK, 10},
+			{"missing.js", "", http.StatusNotFound, 19},
+		}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("observations=%+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("WithCacheRules", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{
+			"fonts/inter.woff2":     {Data: []byte(`foo`)},
+			"previews/a/b/home.png": {Data: []byte(`bar`)},
+			"previews/a/top.png":    {Data: []byte(`baz`)},
+			"main.js":               {Data: []byte(`var x = 1;`)},
+		}, hashfs.WithHashLength(8))
+		h := hashfs.FileServer(fsys, hashfs.WithCacheRules(map[string]string{
+			"fonts/**":         "public, max-age=31536000, immutable",
+			"previews/**":      "public, max-age=60",
+			"previews/a/top.*": "no-store",
+		}))
+
+		for _, tt := range []struct {
+			path string
+			want string
+		}{
+			{"fonts/inter.woff2", "public, max-age=31536000, immutable"},
+			{fsys.HashName("previews/a/b/home.png"), "public, max-age=60"},
+			{"previews/a/top.png", "no-store"},
+			{fsys.HashName("main.js"), hashfs.DefaultCacheControl},
+			{"main.js", ""},
+		} {
+			r, _ := http.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got, want := w.Code, http.StatusOK; got != want {
+				t.Fatalf("%s: code=%v, want %v", tt.path, got, want)
+			} else if got := w.Result().Header.Get("Cache-Control"); got != tt.want {
+				t.Fatalf("%s: cache-control=%q, want %q", tt.path, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("HashLocationQuery", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{"main.js": {Data: []byte(`foo`)}},
+			hashfs.WithHashLength(8), hashfs.WithHashLocation(hashfs.HashLocationQuery), hashfs.WithURLPrefix("/static/"))
+		h := hashfs.FileServer(fsys)
+		if got, want := fsys.URL("main.js"), "/static/main.js?v=2c26b46b"; got != want {
+			t.Fatalf("URL()=%q, want %q", got, want)
+		}
+
+		for _, tt := range []struct {
+			url          string
+			code         int
+			cacheControl string
+		}{
+			{"/static/main.js?v=2c26b46b", http.StatusOK, hashfs.DefaultCacheControl},
+			{"/static/main.js", http.StatusOK, ""},
+			{"/static/main.js?v=00000000", http.StatusNotFound, ""},
+		} {
+			r := httptest.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got, want := w.Code, tt.code; got != want {
+				t.Fatalf("%s: code=%v, want %v", tt.url, got, want)
+			} else if got := w.Result().Header.Get("Cache-Control"); got != tt.cacheControl {
+				t.Fatalf("%s: cache-control=%q, want %q", tt.url, got, tt.cacheControl)
+			}
+		}
+	})
+
+	t.Run("HashDirName", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{
+			"app/main.js":     {Data: []byte(`import "./chunks/a.js";`)},
+			"app/chunks/a.js": {Data: []byte(`foo`)},
+		}, hashfs.WithHashLength(8))
+		h := hashfs.FileServer(fsys)
+		dir := fsys.HashDirName("app/")
+
+		for _, tt := range []struct {
+			path         string
+			code         int
+			cacheControl string
+			body         string
+		}{
+			{dir + "chunks/a.js", http.StatusOK, hashfs.DefaultCacheControl, `foo`},
+			{dir + "main.js", http.StatusOK, hashfs.DefaultCacheControl, `import "./chunks/a.js";`},
+			{"app/chunks/a.js", http.StatusOK, "", `foo`},
+			{"app-00000000/chunks/a.js", http.StatusNotFound, "", "404 page not found\n"},
+		} {
+			r, _ := http.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got, want := w.Code, tt.code; got != want {
+				t.Fatalf("%s: code=%v, want %v", tt.path, got, want)
+			} else if got := w.Result().Header.Get("Cache-Control"); got != tt.cacheControl {
+				t.Fatalf("%s: cache-control=%q, want %q", tt.path, got, tt.cacheControl)
+			} else if got := w.Body.String(); got != tt.body {
+				t.Fatalf("%s: body=%q, want %q", tt.path, got, tt.body)
+			}
+		}
+	})
+
+	t.Run("WithManifestEndpoint", func(t *testing.T) {
+		mapfs := fstest.MapFS{
+			"main.js":      {Data: []byte(`foo`)},
+			"css/main.css": {Data: []byte(`bar`)},
+		}
+		fsys := hashfs.NewFS(mapfs, hashfs.WithHashLength(8), hashfs.WithURLPrefix("/static/"))
+		h := hashfs.FileServer(fsys, hashfs.WithManifestEndpoint(""))
+
+		r := httptest.NewRequest("GET", "/static/.hashfs/manifest.json", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		var m map[string]string
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Result().Header.Get("Content-Type"), "application/json"; got != want {
+			t.Fatalf("content-type=%q, want %q", got, want)
+		} else if got, want := w.Result().Header.Get("Cache-Control"), "no-cache"; got != want {
+			t.Fatalf("cache-control=%q, want %q", got, want)
+		} else if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+			t.Fatal(err)
+		} else if want := map[string]string{"main.js": "main-2c26b46b.js", "css/main.css": "css/main-fcde2b2e.css"}; !reflect.DeepEqual(m, want) {
+			t.Fatalf("manifest=%v, want %v", m, want)
+		}
+
+		// Unchanged manifests can be revalidated.
+		r = httptest.NewRequest("GET", "/static/.hashfs/manifest.json", nil)
+		r.Header.Set("If-None-Match", w.Result().Header.Get("ETag"))
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusNotModified; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+
+		// The file system is only walked again once files are invalidated.
+		mapfs["new.js"] = &fstest.MapFile{Data: []byte(`baz`)}
+		for i, want := range []bool{false, true} {
+			if i == 1 {
+				fsys.Invalidate("new.js")
+			}
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/static/.hashfs/manifest.json", nil))
+			m = nil
+			if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+				t.Fatal(err)
+			} else if _, ok := m["new.js"]; ok != want {
+				t.Fatalf("%d: listed=%v, want %v", i, ok, want)
+			}
+		}
+
+		// Custom paths are relative to the URL prefix.
+		h = hashfs.FileServer(fsys, hashfs.WithManifestEndpoint("assets.json"))
+		r = httptest.NewRequest("GET", "/static/assets.json", nil)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("WithBundleEndpoint", func(t *testing.T) {
+		mapfs := fstest.MapFS{
+			"main.js":      {Data: []byte(`foo`)},
+			"css/main.css": {Data: []byte(`bar`)},
+			"README.md":    {Data: []byte(`baz`)},
+		}
+		fsys := hashfs.NewFS(mapfs, hashfs.WithHashLength(8))
+		h := hashfs.FileServer(fsys, hashfs.WithBundleEndpoint("", func(name string) bool {
+			return path.Ext(name) != ".md"
+		}))
+
+		r, _ := http.NewRequest("GET", ".hashfs/bundle.tar.gz", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Result().Header.Get("Content-Type"), "application/gzip"; got != want {
+			t.Fatalf("content-type=%q, want %q", got, want)
+		}
+
+		gr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := make(map[string]string)
+		for tr := tar.NewReader(gr); ; {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			buf, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[hdr.Name] = string(buf)
+		}
+		if want := map[string]string{"css/main-fcde2b2e.css": "bar", "main-2c26b46b.js": "foo"}; !reflect.DeepEqual(files, want) {
+			t.Fatalf("files=%v, want %v", files, want)
+		}
+
+		// The file system is only walked again once files are invalidated.
+		mapfs["new.js"] = &fstest.MapFile{Data: []byte(`baz`)}
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/.hashfs/bundle.tar.gz", nil))
+		if gr, err := gzip.NewReader(w.Body); err != nil {
+			t.Fatal(err)
+		} else if buf, err := io.ReadAll(gr); err != nil {
+			t.Fatal(err)
+		} else if strings.Contains(string(buf), "new-baa5a096.js") {
+			t.Fatal("expected bundle to exclude uninvalidated file")
+		}
+	})
+
+	t.Run("WithAuthorize", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{
+			"tenants/a/logo.png": {Data: []byte(`foo`)},
+			"tenants/b/logo.png": {Data: []byte(`bar`)},
+		}, hashfs.WithHashLength(8))
+		h := hashfs.FileServer(fsys, hashfs.WithManifestEndpoint(""), hashfs.WithAuthorize(func(r *http.Request, name string) bool {
+			return strings.HasPrefix(name, "tenants/"+r.Header.Get("X-Tenant")+"/")
+		}))
+
+		for _, tt := range []struct {
+			path   string
+			tenant string
+			code   int
+		}{
+			{"tenants/a/logo.png", "a", http.StatusOK},
+			{"tenants/a/logo-2c26b46b.png", "a", http.StatusOK},
+			{"tenants/b/logo.png", "a", http.StatusForbidden},
+			{"tenants/b/logo-fcde2b2e.png", "a", http.StatusForbidden},
+			{"tenants/b/logo-fcde2b2e.png", "b", http.StatusOK},
+		} {
+			r, _ := http.NewRequest("GET", tt.path, nil)
+			r.Header.Set("X-Tenant", tt.tenant)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got := w.Code; got != tt.code {
+				t.Fatalf("%s: code=%v, want %v", tt.path, got, tt.code)
+			}
+		}
+
+		// Unauthorized files are omitted from the manifest.
+		r, _ := http.NewRequest("GET", ".hashfs/manifest.json", nil)
+		r.Header.Set("X-Tenant", "a")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		var m map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+			t.Fatal(err)
+		} else if want := map[string]string{"tenants/a/logo.png": "tenants/a/logo-2c26b46b.png"}; !reflect.DeepEqual(m, want) {
+			t.Fatalf("manifest=%v, want %v", m, want)
+		}
+	})
+
+	t.Run("WithRewrite", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{
+			"en/logo.png": {Data: []byte(`foo`)},
+			"fr/logo.png": {Data: []byte(`bar`)},
+		})
+		h := hashfs.FileServer(fsys, hashfs.WithRewrite(func(r *http.Request, path string) string {
+			if path == "legacy/logo.png" {
+				path = "logo.png"
+			}
+			if lang := r.Header.Get("Accept-Language"); lang == "fr" {
+				return "fr/" + path
+			}
+			return "/en/" + path
+		}))
+
+		for _, tt := range []struct {
+			path string
+			lang string
+			body string
+		}{
+			{"logo.png", "fr", "bar"},
+			{"logo.png", "", "foo"},
+			{"legacy/logo.png", "fr", "bar"},
+		} {
+			r, _ := http.NewRequest("GET", tt.path, nil)
+			r.Header.Set("Accept-Language", tt.lang)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got, want := w.Code, http.StatusOK; got != want {
+				t.Fatalf("%s: code=%v, want %v", tt.path, got, want)
+			} else if got := w.Body.String(); got != tt.body {
+				t.Fatalf("%s: body=%q, want %q", tt.path, got, tt.body)
+			}
+		}
+	})
+
+	t.Run("WithVary", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{"main.js": {Data: []byte(`var x = 1;`)}})
+		h := hashfs.FileServer(fsys,
+			hashfs.WithCompression(gzip.DefaultCompression),
+			hashfs.WithCORS("*"),
+			hashfs.WithVary("accept-language", "Origin"),
+		)
+		etag := `"` + hashHex([]byte(`var x = 1;`)) + `"`
+
+		for _, tt := range []struct {
+			path        string
+			ifNoneMatch string
+			code        int
+		}{
+			{"main.js", "", http.StatusOK},
+			{"main.js", etag, http.StatusNotModified},
+			{"missing.js", "", http.StatusNotFound},
+		} {
+			r, _ := http.NewRequest("GET", tt.path, nil)
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got, want := w.Code, tt.code; got != want {
+				t.Fatalf("%s: code=%v, want %v", tt.path, got, want)
+			} else if got, want := w.Result().Header.Values("Vary"), []string{"Origin", "Accept-Encoding", "Accept-Language"}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s: vary=%q, want %q", tt.path, got, want)
+			}
+		}
+	})
+
+	t.Run("WithImageVariants", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{
+			"hero.jpg":      {Data: []byte(`jpeg`)},
+			"hero.jpg.avif": {Data: []byte(`avif`)},
+			"hero.jpg.webp": {Data: []byte(`webp`)},
+			"logo.png":      {Data: []byte(`png`)},
+		})
+		h := hashfs.FileServer(fsys, hashfs.WithImageVariants())
+
+		for _, tt := range []struct {
+			path   string
+			accept string
+			ctype  string
+			body   string
+		}{
+			{fsys.HashName("hero.jpg"), "image/avif,image/webp,*/*", "image/avif", "avif"},
+			{fsys.HashName("hero.jpg"), "image/avif;q=0,image/webp", "image/webp", "webp"},
+			{fsys.HashName("hero.jpg"), "image/*", "image/jpeg", "jpeg"},
+			{"logo.png", "image/avif", "image/png", "png"},
+		} {
+			r, _ := http.NewRequest("GET", tt.path, nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			hdr := w.Result().Header
+			if got, want := w.Code, http.StatusOK; got != want {
+				t.Fatalf("%s: code=%v, want %v", tt.accept, got, want)
+			} else if got := hdr.Get("Content-Type"); got != tt.ctype {
+				t.Fatalf("%s: content-type=%q, want %q", tt.accept, got, tt.ctype)
+			} else if got := w.Body.String(); got != tt.body {
+				t.Fatalf("%s: body=%q, want %q", tt.accept, got, tt.body)
+			} else if got, want := hdr.Get("Vary"), "Accept"; got != want {
+				t.Fatalf("%s: vary=%q, want %q", tt.accept, got, want)
+			} else if got, want := hdr.Get("ETag"), `"`+hashHex([]byte(tt.body))+`"`; got != want {
+				t.Fatalf("%s: etag=%q, want %q", tt.accept, got, want)
+			}
+		}
+	})
+
+	t.Run("WithRootFiles", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{
+			"static/robots.txt":        {Data: []byte(`foo`)},
+			"static/favicon.ico":       {Data: []byte(`bar`)},
+			"wellknown/security.txt":   {Data: []byte(`baz`)},
+			"wellknown/sub/assetlinks": {Data: []byte(`foo`)},
+			"private/secret.txt":       {Data: []byte(`foo`)},
+		}, hashfs.WithURLPrefix("/assets/"), hashfs.WithHashLength(8))
+		h := hashfs.FileServer(fsys,
+			hashfs.WithRootFiles(map[string]string{
+				"/robots.txt":   "static/robots.txt",
+				"favicon.ico":   "static/favicon.ico",
+				"/.well-known/": "wellknown",
+			}),
+			hashfs.WithCacheRules(map[string]string{"static/favicon.ico": "public, max-age=86400"}),
+		)
+
+		for _, tt := range []struct {
+			path         string
+			code         int
+			body         string
+			cacheControl string
+		}{
+			{"/robots.txt", http.StatusOK, "foo", hashfs.DefaultRootCacheControl},
+			{"/favicon.ico", http.StatusOK, "bar", "public, max-age=86400"},
+			{"/.well-known/security.txt", http.StatusOK, "baz", hashfs.DefaultRootCacheControl},
+			{"/.well-known/sub/assetlinks", http.StatusOK, "foo", hashfs.DefaultRootCacheControl},
+			{"/.well-known/../private/secret.txt", http.StatusNotFound, "", ""},
+			{"/.well-known/missing.txt", http.StatusNotFound, "", ""},
+			{"/.well-known/sub", http.StatusNotFound, "", ""},
+			{"/assets/static/robots-2c26b46b.txt", http.StatusOK, "foo", hashfs.DefaultCacheControl},
+		} {
+			r := httptest.NewRequest("GET", tt.path, nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got, want := w.Code, tt.code; got != want {
+				t.Fatalf("%s: code=%v, want %v", tt.path, got, want)
+			} else if tt.code != http.StatusOK {
+				continue
+			} else if got, want := w.Body.String(), tt.body; got != want {
+				t.Fatalf("%s: body=%q, want %q", tt.path, got, want)
+			} else if got, want := w.Header().Get("Cache-Control"), tt.cacheControl; got != want {
+				t.Fatalf("%s: Cache-Control=%q, want %q", tt.path, got, want)
+			} else if got, want := w.Header().Get("ETag"), `"`+hashHex([]byte(tt.body))+`"`; got != want {
+				t.Fatalf("%s: ETag=%q, want %q", tt.path, got, want)
+			}
+		}
+	})
+
+	t.Run("WithCanonicalPaths", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{
+			"index.html":     {Data: []byte(`root`)},
+			"dir/index.html": {Data: []byte(`dir`)},
+			"dir/main.js":    {Data: []byte(`foo`)},
+		}, hashfs.WithHashLength(8))
+		h := hashfs.FileServer(fsys, hashfs.WithCanonicalPaths(true), hashfs.WithIndexFiles("index.html"))
+
+		// Cache the metadata of main.js so redirects are also applied to
+		// requests answered from the cache.
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/dir/main.js", nil))
+
+		for _, tt := range []struct {
+			method   string
+			target   string
+			code     int
+			location string
+			body     string
+		}{
+			{"GET", "/", http.StatusOK, "", "root"},
+			{"GET", "/dir/", http.StatusOK, "", "dir"},
+			{"GET", "/dir", http.StatusMovedPermanently, "/dir/", ""},
+			{"GET", "/dir?x=1", http.StatusMovedPermanently, "/dir/?x=1", ""},
+			{"GET", "/dir/main.js/", http.StatusMovedPermanently, "/dir/main.js", ""},
+			{"HEAD", "/dir/main.js/", http.StatusMovedPermanently, "/dir/main.js", ""},
+			{"GET", "/dir/main-2c26b46b.js/", http.StatusMovedPermanently, "/dir/main-2c26b46b.js", ""},
+			{"GET", "//dir//main.js", http.StatusMovedPermanently, "/dir/main.js", ""},
+			{"GET", "/dir/./main.js", http.StatusMovedPermanently, "/dir/main.js", ""},
+			{"GET", "/dir/../dir/main.js", http.StatusBadRequest, "", ""},
+			{"GET", "/dir/main.js", http.StatusOK, "", "foo"},
+		} {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.URL.Path, r.URL.RawQuery = tt.target, ""
+			if i := strings.Index(tt.target, "?"); i != -1 {
+				r.URL.Path, r.URL.RawQuery = tt.target[:i], tt.target[i+1:]
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got, want := w.Code, tt.code; got != want {
+				t.Fatalf("%s %s: code=%v, want %v", tt.method, tt.target, got, want)
+			} else if got, want := w.Header().Get("Location"), tt.location; got != want {
+				t.Fatalf("%s %s: Location=%q, want %q", tt.method, tt.target, got, want)
+			} else if tt.code == http.StatusOK && w.Body.String() != tt.body {
+				t.Fatalf("%s %s: body=%q, want %q", tt.method, tt.target, w.Body.String(), tt.body)
+			}
+		}
+
+		// Paths are cleaned silently by default.
+		h = hashfs.FileServer(fsys)
+		r := httptest.NewRequest("GET", "/", nil)
+		r.URL.Path = "/dir/../dir//main.js/"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Normalize", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{
+			"my file.js":         {Data: []byte(`foo`)},
+			"caf\u00e9.css":      {Data: []byte(`bar`)},
+			"nfd/cafe\u0301.css": {Data: []byte(`baz`)},
+			"100%.txt":           {Data: []byte(`foo`)},
+		}, hashfs.WithHashLength(8))
+		h := hashfs.FileServer(fsys)
+
+		for _, tt := range []struct {
+			path string
+			code int
+			body string
+		}{
+			{"/my file.js", http.StatusOK, "foo"},
+			{"/my%20file.js", http.StatusOK, "foo"},
+			{"/my%20file-2c26b46b.js", http.StatusOK, "foo"},
+			{"/caf\u00e9.css", http.StatusOK, "bar"},
+			{"/cafe\u0301.css", http.StatusOK, "bar"},
+			{"/caf%C3%A9.css", http.StatusOK, "bar"},
+			{"/caf%C3%A9-fcde2b2e.css", http.StatusOK, "bar"},
+			{"/nfd/caf\u00e9.css", http.StatusOK, "baz"},
+			{"/100%.txt", http.StatusOK, "foo"},
+			{"/my%2520file.js", http.StatusNotFound, ""},
+			{"/%2e%2e/my%20file.js", http.StatusNotFound, ""},
+		} {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.URL.Path = tt.path
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got, want := w.Code, tt.code; got != want {
+				t.Fatalf("%s: code=%v, want %v", tt.path, got, want)
+			} else if got, want := w.Body.String(), tt.body; tt.code == http.StatusOK && got != want {
+				t.Fatalf("%s: body=%q, want %q", tt.path, got, want)
+			}
+		}
+
+		// Paths that exist as-is are opened as often as plain ASCII paths.
+		cfs := &countingFS{FS: fstest.MapFS{
+			"app.js":       {Data: []byte(`foo`)},
+			"caf\u00e9.js": {Data: []byte(`bar`)},
+		}}
+		h = hashfs.FileServer(hashfs.NewFS(cfs))
+		var opens []int
+		for _, p := range []string{"/app.js", "/caf\u00e9.js"} {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.URL.Path = p
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			n := cfs.n
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			opens = append(opens, cfs.n-n)
+		}
+		if opens[0] != opens[1] {
+			t.Fatalf("opens=%v, want equal", opens)
+		}
+	})
+
+	t.Run("WithErrorHandler", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{
+			"main.js":        {Data: []byte(`foo`)},
+			"secret/key.txt": {Data: []byte(`bar`)},
+		}, hashfs.WithHashLength(8))
+
+		var errs []error
+		h := hashfs.FileServer(fsys,
+			hashfs.WithAuthorize(func(r *http.Request, name string) bool { return !strings.HasPrefix(name, "secret/") }),
+			hashfs.WithErrorHandler(func(w http.ResponseWriter, r *http.Request, status int, err error) {
+				errs = append(errs, err)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				json.NewEncoder(w).Encode(map[string]int{"status": status})
+			}),
+		)
+
+		for _, tt := range []struct {
+			path string
+			code int
+		}{
+			{"/missing.js", http.StatusNotFound},
+			{"/main-00000000.js", http.StatusNotFound},
+			{"/secret/key.txt", http.StatusForbidden},
+			{"/secret", http.StatusForbidden},
+		} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if got, want := w.Code, tt.code; got != want {
+				t.Fatalf("%s: code=%v, want %v", tt.path, got, want)
+			} else if got, want := w.Header().Get("Content-Type"), "application/json"; got != want {
+				t.Fatalf("%s: Content-Type=%q, want %q", tt.path, got, want)
+			} else if got, want := w.Body.String(), fmt.Sprintf("{\"status\":%d}\n", tt.code); got != want {
+				t.Fatalf("%s: body=%q, want %q", tt.path, got, want)
+			}
+		}
+
+		// Errors describe the failure, including stale hash names.
+		if len(errs) != 4 {
+			t.Fatalf("unexpected errors: %v", errs)
+		} else if !errors.Is(errs[0], fs.ErrNotExist) || errors.Is(errs[0], hashfs.ErrHashMismatch) {
+			t.Fatalf("unexpected error: %v", errs[0])
+		} else if !errors.Is(errs[1], hashfs.ErrHashMismatch) {
+			t.Fatalf("unexpected error: %v", errs[1])
+		} else if !errors.Is(errs[3], hashfs.ErrIsDirectory) {
+			t.Fatalf("unexpected error: %v", errs[3])
+		}
+
+		// The default response is unchanged without an error handler.
+		w := httptest.NewRecorder()
+		hashfs.FileServer(fsys).ServeHTTP(w, httptest.NewRequest("GET", "/missing.js", nil))
+		if got, want := w.Body.String(), "404 page not found\n"; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("WithByHashEndpoint", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{
+			"app.js":    {Data: []byte(`foo`)},
+			"style.css": {Data: []byte(`bar`)},
+		}, hashfs.WithHashLength(8), hashfs.WithURLPrefix("/assets/"))
+		h := hashfs.FileServer(fsys, hashfs.WithByHashEndpoint(""))
+
+		// Probing an unknown hash must not hash the file system.
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/assets/.by-hash/fcde2b2e", nil))
+		if got, want := w.Code, http.StatusNotFound; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := fsys.Stats().Misses, int64(0); got != want {
+			t.Fatalf("Misses=%v, want %v", got, want)
+		} else if err := fsys.Warm(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tt := range []struct {
+			path  string
+			code  int
+			body  string
+			ctype string
+		}{
+			{"/assets/.by-hash/" + hashHex([]byte(`foo`)), http.StatusOK, "foo", "text/javascript; charset=utf-8"},
+			{"/assets/.by-hash/fcde2b2e", http.StatusOK, "bar", "text/css; charset=utf-8"},
+			{"/assets/.by-hash/00000000", http.StatusNotFound, "", ""},
+			{"/assets/.by-hash/", http.StatusNotFound, "", ""},
+		} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if got, want := w.Code, tt.code; got != want {
+				t.Fatalf("%s: code=%v, want %v", tt.path, got, want)
+			} else if tt.code != http.StatusOK {
+				continue
+			} else if got, want := w.Body.String(), tt.body; got != want {
+				t.Fatalf("%s: body=%q, want %q", tt.path, got, want)
+			} else if got, want := w.Header().Get("Content-Type"), tt.ctype; got != want {
+				t.Fatalf("%s: Content-Type=%q, want %q", tt.path, got, want)
+			} else if got, want := w.Header().Get("Cache-Control"), hashfs.DefaultCacheControl; got != want {
+				t.Fatalf("%s: Cache-Control=%q, want %q", tt.path, got, want)
+			} else if got, want := w.Header().Get("ETag"), `"`+hashHex([]byte(tt.body))+`"`; got != want {
+				t.Fatalf("%s: ETag=%q, want %q", tt.path, got, want)
+			}
+		}
+	})
+
+	t.Run("WithDenyPatterns", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{
+			".git/config":       {Data: []byte(`[core]`)},
+			"views/page.tmpl":   {Data: []byte(`{{.}}`)},
+			"secret/key.pem":    {Data: []byte(`key`)},
+			"main.js":           {Data: []byte(`foo`)},
+			"secretary/note.js": {Data: []byte(`bar`)},
+		}, hashfs.WithHashLength(8))
+		h := hashfs.FileServer(fsys, hashfs.WithDenyPatterns(".git/**", "*.tmpl", "secret/**"), hashfs.WithManifestEndpoint(""), hashfs.WithDirListing(true))
+
+		for _, tt := range []struct {
+			path string
+			code int
+		}{
+			{"/.git/config", http.StatusNotFound},
+			{"/.git/", http.StatusNotFound},
+			{"/views/page.tmpl", http.StatusNotFound},
+			{"/" + fsys.HashName("views/page.tmpl"), http.StatusNotFound},
+			{"/secret/key.pem", http.StatusNotFound},
+			{"/secret", http.StatusNotFound},
+			{"/main.js", http.StatusOK},
+			{"/main-2c26b46b.js", http.StatusOK},
+			{"/secretary/note.js", http.StatusOK},
+		} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if got, want := w.Code, tt.code; got != want {
+				t.Fatalf("%s: code=%v, want %v", tt.path, got, want)
+			}
+		}
+
+		// Denied files are omitted from the manifest & directory listings.
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", hashfs.DefaultManifestPath, nil))
+		if body := w.Body.String(); strings.Contains(body, "tmpl") || strings.Contains(body, "key.pem") || !strings.Contains(body, "main.js") {
+			t.Fatalf("unexpected manifest: %s", body)
+		}
+
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if body := w.Body.String(); strings.Contains(body, ".git") || strings.Contains(body, `"secret/"`) || !strings.Contains(body, "secretary/") {
+			t.Fatalf("unexpected listing: %s", body)
+		}
+	})
+
+	t.Run("WithMaxHashedFileSize", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{
+			"video/large.mp4": {Data: []byte(`0123456789`)},
+		}, hashfs.WithMaxHashedFileSize(4))
+		h := hashfs.FileServer(fsys, hashfs.WithCacheControl(hashfs.DefaultCacheControl, "no-cache"))
+
+		// Large files are served by their original names with normal caching.
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/video/large.mp4", nil))
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("code=%d, want %d", got, want)
+		} else if got, want := w.Body.String(), "0123456789"; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		} else if got, want := w.Header().Get("Cache-Control"), "no-cache"; got != want {
+			t.Fatalf("Cache-Control=%q, want %q", got, want)
+		} else if got, want := fsys.Stats().BytesHashed, int64(0); got != want {
+			t.Fatalf("BytesHashed=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("SendFile", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte(`foo`), 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		// The *os.File must reach the writer's ReadFrom so that the
+		// net/http server can use sendfile.
+		r, _ := http.NewRequest("GET", "/a-2c26b46b.txt", nil)
+		w := &readFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+		hashfs.FileServer(hashfs.NewFS(os.DirFS(dir), hashfs.WithHashLength(8))).ServeHTTP(w, r)
+		if got, want := w.Code, 200; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Body.String(), `foo`; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+
+		src := w.src
+		if lr, ok := src.(*io.LimitedReader); ok {
+			src = lr.R
+		}
+		if _, ok := src.(*os.File); !ok {
+			t.Fatalf("ReadFrom() source=%T, want *os.File", w.src)
+		}
+	})
+
+	t.Run("RequestDeadline", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		bfs := &blockingFS{FS: fstest.MapFS{"a.txt": {Data: []byte(`foo`)}}, release: release}
+		h := hashfs.FileServer(hashfs.NewFS(bfs, hashfs.WithHashLength(8)))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		r := httptest.NewRequest("GET", "/a-2c26b46b.txt", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusServiceUnavailable; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+	})
+}
+
+// loadFS returns a file system with n files for load tests along with the
+// request paths to use: hashed, unhashed, missing & stale hash names.
+func loadFS(tb testing.TB, n int, opts ...hashfs.Option) (*hashfs.FS, []string) {
+	tb.Helper()
+	mfs := make(fstest.MapFS)
+	for i := 0; i < n; i++ {
+		mfs[fmt.Sprintf("assets/%d.css", i)] = &fstest.MapFile{Data: []byte(strings.Repeat(fmt.Sprintf("a%d{}", i), 64))}
+	}
+	f := hashfs.NewFS(mfs, append([]hashfs.Option{hashfs.WithHashLength(8)}, opts...)...)
+
+	var paths []string
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("assets/%d.css", i)
+		paths = append(paths,
+			"/"+f.HashName(name),
+			"/"+name,
+			fmt.Sprintf("/assets/missing%d.css", i),
+			fmt.Sprintf("/assets/%d-00000000.css", i),
+		)
+	}
+	return f, paths
+}
+
+// loadStatus returns the expected status code of a path returned by loadFS.
+func loadStatus(p string) int {
+	if strings.Contains(p, "missing") || strings.Contains(p, "-00000000") {
+		return http.StatusNotFound
+	}
+	return http.StatusOK
+}
+
+func TestFileServer_Concurrent(t *testing.T) {
+	const n, concurrency, requests = 20, 500, 4000
+
+	f, paths := loadFS(t, n)
+	srv := httptest.NewUnstartedServer(hashfs.FileServer(f, hashfs.WithCompression(gzip.DefaultCompression)))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	client := srv.Client()
+
+	// Requests mix all kinds of paths, with & without compression, and are
+	// issued concurrently while hashes are invalidated.
+	var wg sync.WaitGroup
+	var codes sync.Map
+	reqs := make(chan int)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range reqs {
+				p := paths[i%len(paths)]
+				req, _ := http.NewRequest("GET", srv.URL+p, nil)
+				if i%3 == 0 {
+					req.Header.Set("Accept-Encoding", "gzip")
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Error(err)
+					continue
+				}
+				var body []byte
+				if resp.Header.Get("Content-Encoding") == "gzip" {
+					var zr *gzip.Reader
+					if zr, err = gzip.NewReader(resp.Body); err == nil {
+						body, err = io.ReadAll(zr)
+					}
+				} else {
+					body, err = io.ReadAll(resp.Body)
+				}
+				resp.Body.Close()
+				if err != nil {
+					t.Error(err)
+					continue
+				} else if got, want := resp.ProtoMajor, 2; got != want {
+					t.Errorf("proto=%v, want %v", got, want)
+					continue
+				} else if got, want := resp.StatusCode, loadStatus(p); got != want {
+					t.Errorf("GET %s: code=%v, want %v", p, got, want)
+					continue
+				} else if want == http.StatusOK && !strings.HasPrefix(string(body), "a") {
+					t.Errorf("GET %s: unexpected body: %.20q", p, body)
+					continue
+				}
+
+				v, _ := codes.LoadOrStore(resp.StatusCode, new(int64))
+				atomic.AddInt64(v.(*int64), 1)
+			}
+		}()
+	}
+
+	for i := 0; i < requests; i++ {
+		if i%500 == 0 {
+			f.Invalidate(fmt.Sprintf("assets/%d.css", (i/500)%n))
+		}
+		reqs <- i
+	}
+	close(reqs)
+	wg.Wait()
+
+	// Every response must be reported in the file system's statistics.
+	var total int64
+	stats := f.Stats()
+	codes.Range(func(k, v interface{}) bool {
+		if got, want := stats.Requests[k.(int)], atomic.LoadInt64(v.(*int64)); got != want {
+			t.Errorf("Requests[%d]=%d, want %d", k, got, want)
+		}
+		total += stats.Requests[k.(int)]
+		return true
+	})
+	if got, want := total, int64(requests); got != want {
+		t.Fatalf("requests=%d, want %d", got, want)
+	}
+}
+
+func BenchmarkFileServer(b *testing.B) {
+	const n = 100
+
+	// Each benchmark serves a different subset of the paths returned by
+	// loadFS. Run with -cpu to measure lock contention.
+	for _, tt := range []struct {
+		name  string
+		match func(i int) bool
+	}{
+		{"Hashed", func(i int) bool { return i%4 == 0 }},
+		{"Unhashed", func(i int) bool { return i%4 == 1 }},
+		{"Missing", func(i int) bool { return i%4 == 2 }},
+		{"Mixed", func(i int) bool { return true }},
+	} {
+		b.Run(tt.name, func(b *testing.B) {
+			f, all := loadFS(b, n)
+			var paths []string
+			for i, p := range all {
+				if tt.match(i) {
+					paths = append(paths, p)
+				}
+			}
+			h := hashfs.FileServer(f)
+
+			b.ReportAllocs()
+			b.SetParallelism(64)
+			b.ResetTimer()
+			var next uint64
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(atomic.AddUint64(&next, 1))
+				for pb.Next() {
+					r := httptest.NewRequest("GET", paths[i%len(paths)], nil)
+					h.ServeHTTP(httptest.NewRecorder(), r)
+					i++
+				}
+			})
+		})
+	}
+
+	// Requests are served by a TLS server over HTTP/2 to include the cost
+	// of multiplexing many concurrent streams on a connection.
+	b.Run("HTTP2", func(b *testing.B) {
+		f, paths := loadFS(b, n)
+		srv := httptest.NewUnstartedServer(hashfs.FileServer(f))
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+		defer srv.Close()
+		client := srv.Client()
+
+		b.ReportAllocs()
+		b.SetParallelism(64)
+		b.ResetTimer()
+		var next uint64
+		b.RunParallel(func(pb *testing.PB) {
+			i := int(atomic.AddUint64(&next, 1))
+			for pb.Next() {
+				resp, err := client.Get(srv.URL + paths[i%len(paths)])
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				i++
+			}
+		})
+	})
+}
+
+func mustHashOf(tb testing.TB, fsys *hashfs.FS, name string) []byte {
+	tb.Helper()
+	buf, err := fsys.HashOf(name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return buf
+}
+
+// nonSeekableFS wraps a file system so its files do not implement io.Seeker.
+type nonSeekableFS struct {
+	fs.FS
+}
+
+func (fsys *nonSeekableFS) Open(name string) (fs.File, error) {
+	f, err := fsys.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &nonSeekableFile{f}, nil
+}
+
+type nonSeekableFile struct {
+	fs.File
+}
+
+// countingFS wraps a file system and counts the number of calls to Open.
+type countingFS struct {
+	fs.FS
+	n int
+}
+
+func (fsys *countingFS) Open(name string) (fs.File, error) {
+	fsys.n++
+	return fsys.FS.Open(name)
+}
+
+// readFromRecorder is a response recorder that records the source passed to
+// ReadFrom, as used by the net/http server for sendfile.
+type readFromRecorder struct {
+	*httptest.ResponseRecorder
+	src io.Reader
+}
+
+func (w *readFromRecorder) ReadFrom(r io.Reader) (int64, error) {
+	w.src = r
+	return io.Copy(w.ResponseRecorder, r)
+}
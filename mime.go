@@ -0,0 +1,104 @@
+package hashfs
+
+import (
+	"mime"
+	"strings"
+)
+
+// WithCharset returns an option that sets the charset parameter of text
+// content types, such as "text/css" & "text/javascript". A blank charset
+// removes the parameter, which may be required by some legacy clients. By
+// default, text types use "utf-8". Types returned by the function passed to
+// WithContentType are not modified.
+func WithCharset(charset string) Option {
+	return func(fsys *FS) {
+		fsys.charset, fsys.charsetSet = charset, true
+	}
+}
+
+// mimeTypes is a table of content types for common web assets. It takes
+// precedence over the system's MIME registrations, which may be missing or
+// incorrect (e.g. ".css" registered as "text/plain"), so that browsers
+// enforcing strict MIME type checks accept the files.
+var mimeTypes = map[string]string{
+	".avif":        "image/avif",
+	".css":         "text/css; charset=utf-8",
+	".csv":         "text/csv; charset=utf-8",
+	".gif":         "image/gif",
+	".htm":         "text/html; charset=utf-8",
+	".html":        "text/html; charset=utf-8",
+	".ico":         "image/vnd.microsoft.icon",
+	".jpeg":        "image/jpeg",
+	".jpg":         "image/jpeg",
+	".js":          "text/javascript; charset=utf-8",
+	".json":        "application/json",
+	".map":         "application/json",
+	".md":          "text/markdown; charset=utf-8",
+	".mjs":         "text/javascript; charset=utf-8",
+	".mp3":         "audio/mpeg",
+	".mp4":         "video/mp4",
+	".otf":         "font/otf",
+	".pdf":         "application/pdf",
+	".png":         "image/png",
+	".svg":         "image/svg+xml",
+	".ttf":         "font/ttf",
+	".txt":         "text/plain; charset=utf-8",
+	".wasm":        "application/wasm",
+	".webm":        "video/webm",
+	".webmanifest": "application/manifest+json",
+	".webp":        "image/webp",
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+	".xml":         "text/xml; charset=utf-8",
+}
+
+// typeByExtension returns the content type for a file extension. The
+// built-in table is consulted before the system's MIME registrations.
+// Returns a blank string if the type is unknown.
+func typeByExtension(ext string) string {
+	if ctype, ok := mimeTypes[strings.ToLower(ext)]; ok {
+		return ctype
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// withCharset returns ctype with its charset parameter replaced by charset.
+// The parameter is removed if charset is blank. Non-text types are returned
+// unchanged.
+func withCharset(ctype, charset string) string {
+	mediatype, params, err := mime.ParseMediaType(ctype)
+	if err != nil || !isTextType(mediatype) {
+		return ctype
+	}
+
+	delete(params, "charset")
+	if charset != "" {
+		params["charset"] = charset
+	}
+	return mime.FormatMediaType(mediatype, params)
+}
+
+// IsCompressible returns true if content of the given type, such as
+// "text/css; charset=utf-8", benefits from compression. Parameters are
+// ignored. Already compressed formats, such as images & fonts, are not.
+func IsCompressible(ctype string) bool {
+	mediatype, _, _ := mime.ParseMediaType(ctype)
+	switch mediatype {
+	case "application/javascript", "application/json", "application/manifest+json",
+		"application/wasm", "application/xml", "image/svg+xml":
+		return true
+	default:
+		return strings.HasPrefix(mediatype, "text/")
+	}
+}
+
+// isTextType returns true if mediatype is textual & can have a charset.
+func isTextType(mediatype string) bool {
+	switch mediatype {
+	case "application/javascript", "application/json", "application/manifest+json",
+		"application/xml", "image/svg+xml":
+		return true
+	default:
+		return strings.HasPrefix(mediatype, "text/")
+	}
+}
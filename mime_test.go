@@ -0,0 +1,48 @@
+package hashfs_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestFS_WithCharset(t *testing.T) {
+	mfs := fstest.MapFS{}
+	for _, tt := range []struct {
+		name string
+		opts []hashfs.Option
+		want string
+	}{
+		{"app.js", nil, "text/javascript; charset=utf-8"},
+		{"app.js", []hashfs.Option{hashfs.WithCharset("")}, "text/javascript"},
+		{"app.css", []hashfs.Option{hashfs.WithCharset("iso-8859-1")}, "text/css; charset=iso-8859-1"},
+		{"data.json", []hashfs.Option{hashfs.WithCharset("utf-8")}, "application/json; charset=utf-8"},
+		{"image.png", []hashfs.Option{hashfs.WithCharset("utf-8")}, "image/png"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f := hashfs.NewFS(mfs, tt.opts...)
+			if got := f.ContentType(tt.name); got != tt.want {
+				t.Fatalf("ContentType()=%q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsCompressible(t *testing.T) {
+	for _, tt := range []struct {
+		ctype string
+		want  bool
+	}{
+		{"text/css; charset=utf-8", true},
+		{"application/json", true},
+		{"image/svg+xml", true},
+		{"image/png", false},
+		{"font/woff2", false},
+		{"", false},
+	} {
+		if got := hashfs.IsCompressible(tt.ctype); got != tt.want {
+			t.Fatalf("IsCompressible(%q)=%v, want %v", tt.ctype, got, tt.want)
+		}
+	}
+}
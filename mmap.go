@@ -0,0 +1,140 @@
+package hashfs
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+)
+
+// WithMmap returns an option that memory maps files of at least minSize bytes
+// when they are first opened from an *os.File, such as with os.DirFS. Later
+// opens are served directly from the mapping which avoids a read system call
+// & a copy into user space for every request. Mappings are held until the
+// file is invalidated & are released once all files opened from them are
+// closed. This option has no effect on platforms without mmap.
+//
+// Truncating or rewriting a mapped file in place causes the process to crash
+// with SIGBUS when the mapping is read. Only read-only files, those without
+// any write permission bits, are mapped & mapping is disabled in development
+// mode. Deployments must replace files by renaming new files over them.
+func WithMmap(minSize int64) Option {
+	return func(fsys *FS) {
+		if minSize < 1 {
+			minSize = 1
+		}
+		fsys.mmapSize = minSize
+	}
+}
+
+// mapping is a memory mapped file shared by all files opened from it.
+type mapping struct {
+	data    []byte
+	info    fs.FileInfo
+	refs    int  // number of open files, guarded by cache.mapsMu
+	removed bool // true once no longer in cache.maps
+}
+
+// mappedFile is a file served from a memory mapping.
+type mappedFile struct {
+	*bytes.Reader
+	fsys *FS
+	m    *mapping
+}
+
+func (f *mappedFile) Stat() (fs.FileInfo, error) { return f.m.info, nil }
+
+// Close releases the file's reference to the mapping. The mapping is unmapped
+// if it has been removed & this was the last file open from it.
+func (f *mappedFile) Close() error {
+	if f.m == nil {
+		return fs.ErrClosed
+	}
+	f.Reader.Reset(nil)
+
+	c := f.fsys.cache
+	c.mapsMu.Lock()
+	defer c.mapsMu.Unlock()
+	f.m.refs--
+	if f.m.refs == 0 && f.m.removed {
+		munmap(f.m.data)
+	}
+	f.m = nil
+	return nil
+}
+
+// mmapEnabled returns true if files should be memory mapped.
+func (fsys *FS) mmapEnabled() bool {
+	return fsys.mmapSize > 0 && !fsys.dev
+}
+
+// openMapped returns a file for name if its contents are already mapped.
+// Otherwise returns nil.
+func (fsys *FS) openMapped(name string) fs.File {
+	c := fsys.cache
+	c.mapsMu.Lock()
+	defer c.mapsMu.Unlock()
+
+	m := c.maps[name]
+	if m == nil {
+		return nil
+	}
+	m.refs++
+	return &mappedFile{Reader: bytes.NewReader(m.data), fsys: fsys, m: m}
+}
+
+// mapFile maps the contents of f, which was opened from name, if it is a
+// regular, read-only *os.File of at least the minimum size. On success, f is closed and
+// a file served from the mapping is returned. Otherwise f is returned as is.
+func (fsys *FS) mapFile(name string, f fs.File) fs.File {
+	osf, ok := f.(*os.File)
+	if !ok {
+		return f
+	}
+	fi, err := osf.Stat()
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() < fsys.mmapSize || int64(int(fi.Size())) != fi.Size() {
+		return f
+	} else if fi.Mode().Perm()&0222 != 0 {
+		return f // writable files may be truncated underneath the mapping
+	}
+
+	c := fsys.cache
+	c.mapsMu.Lock()
+	defer c.mapsMu.Unlock()
+
+	// Another open may have mapped the file while this one was opening it.
+	m := c.maps[name]
+	if m == nil {
+		data, err := mmap(osf, int(fi.Size()))
+		if err != nil {
+			return f
+		}
+		m = &mapping{data: data, info: fi}
+		if c.maps == nil {
+			c.maps = make(map[string]*mapping)
+		}
+		c.maps[name] = m
+	}
+	osf.Close()
+
+	m.refs++
+	return &mappedFile{Reader: bytes.NewReader(m.data), fsys: fsys, m: m}
+}
+
+// unmap removes the mappings of all paths for which match returns true.
+// Mappings still in use are unmapped once their last file is closed.
+func (fsys *FS) unmap(match func(name string) bool) {
+	c := fsys.cache
+	c.mapsMu.Lock()
+	defer c.mapsMu.Unlock()
+
+	for name, m := range c.maps {
+		if !match(name) {
+			continue
+		}
+		delete(c.maps, name)
+		m.removed = true
+		if m.refs == 0 {
+			munmap(m.data)
+		}
+	}
+}
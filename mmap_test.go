@@ -0,0 +1,165 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package hashfs_test
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestFS_WithMmap(t *testing.T) {
+	// replaceFile atomically replaces the named file with a read-only file so
+	// that existing mappings continue to refer to the old contents.
+	replaceFile := func(tb testing.TB, dir, name, data string) {
+		tb.Helper()
+		tmp := filepath.Join(dir, name+".tmp")
+		if err := os.WriteFile(tmp, []byte(data), 0444); err != nil {
+			tb.Fatal(err)
+		} else if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	readFile := func(tb testing.TB, fsys fs.FS, name string) string {
+		tb.Helper()
+		f, err := fsys.Open(name)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		defer f.Close()
+
+		buf, err := io.ReadAll(f)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		return string(buf)
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		dir := t.TempDir()
+		replaceFile(t, dir, "a.txt", `foo`)
+		f := hashfs.NewFS(os.DirFS(dir), hashfs.WithHashLength(8), hashfs.WithMmap(1))
+		if got, want := readFile(t, f, "a-2c26b46b.txt"), `foo`; got != want {
+			t.Fatalf("Read()=%q, want %q", got, want)
+		}
+
+		// Hold a file open across invalidation to ensure it remains readable.
+		held, err := f.Open("a.txt")
+		if err != nil {
+			t.Fatal(err)
+		} else if fi, err := held.Stat(); err != nil {
+			t.Fatal(err)
+		} else if got, want := fi.Size(), int64(3); got != want {
+			t.Fatalf("Size()=%d, want %d", got, want)
+		}
+
+		// Mapped contents are served until the file is invalidated.
+		replaceFile(t, dir, "a.txt", `baz`)
+		if got, want := readFile(t, f, "a.txt"), `foo`; got != want {
+			t.Fatalf("Read()=%q, want %q", got, want)
+		}
+
+		f.Invalidate("a.txt")
+		if got, want := readFile(t, f, "a-baa5a096.txt"), `baz`; got != want {
+			t.Fatalf("Read()=%q, want %q", got, want)
+		} else if buf, err := io.ReadAll(held); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `foo`; got != want {
+			t.Fatalf("Read()=%q, want %q", got, want)
+		}
+
+		if err := held.Close(); err != nil {
+			t.Fatal(err)
+		} else if err := held.Close(); err == nil {
+			t.Fatal("expected error on second close")
+		}
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		dir := t.TempDir()
+		replaceFile(t, dir, "a.txt", `foo`)
+		f := hashfs.NewFS(os.DirFS(dir), hashfs.WithMmap(1))
+		if got, want := readFile(t, f, "a.txt"), `foo`; got != want {
+			t.Fatalf("Read()=%q, want %q", got, want)
+		}
+
+		replaceFile(t, dir, "a.txt", `baz`)
+		f.Reset()
+		if got, want := readFile(t, f, "a.txt"), `baz`; got != want {
+			t.Fatalf("Read()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("MinSize", func(t *testing.T) {
+		dir := t.TempDir()
+		replaceFile(t, dir, "a.txt", `foo`)
+		f := hashfs.NewFS(os.DirFS(dir), hashfs.WithMmap(4))
+		if got, want := readFile(t, f, "a.txt"), `foo`; got != want {
+			t.Fatalf("Read()=%q, want %q", got, want)
+		}
+
+		// Small files are read from disk on every open.
+		replaceFile(t, dir, "a.txt", `baz`)
+		if got, want := readFile(t, f, "a.txt"), `baz`; got != want {
+			t.Fatalf("Read()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Writable", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte(`foo`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f := hashfs.NewFS(os.DirFS(dir), hashfs.WithMmap(1))
+		if got, want := readFile(t, f, "a.txt"), `foo`; got != want {
+			t.Fatalf("Read()=%q, want %q", got, want)
+		}
+
+		// Writable files may be truncated in place so they are never mapped.
+		if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte(`ba`), 0644); err != nil {
+			t.Fatal(err)
+		} else if got, want := readFile(t, f, "a.txt"), `ba`; got != want {
+			t.Fatalf("Read()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Dev", func(t *testing.T) {
+		dir := t.TempDir()
+		replaceFile(t, dir, "a.txt", `foo`)
+		f := hashfs.NewFS(os.DirFS(dir), hashfs.WithDev(true), hashfs.WithMmap(1))
+		if got, want := readFile(t, f, "a.txt"), `foo`; got != want {
+			t.Fatalf("Read()=%q, want %q", got, want)
+		}
+
+		replaceFile(t, dir, "a.txt", `baz`)
+		if got, want := readFile(t, f, "a.txt"), `baz`; got != want {
+			t.Fatalf("Read()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("FileServer", func(t *testing.T) {
+		dir := t.TempDir()
+		replaceFile(t, dir, "a.txt", `foobar`)
+		h := hashfs.FileServer(hashfs.NewFS(os.DirFS(dir), hashfs.WithMmap(1)))
+
+		for i := 0; i < 2; i++ {
+			r, _ := http.NewRequest("GET", "/a.txt", nil)
+			r.Header.Set("Range", "bytes=2-4")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got, want := w.Code, http.StatusPartialContent; got != want {
+				t.Fatalf("code=%v, want %v", got, want)
+			} else if got, want := w.Body.String(), `oba`; got != want {
+				t.Fatalf("body=%q, want %q", got, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,20 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package hashfs
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmap maps the first size bytes of f as read-only memory. Accessing the
+// mapping after f is truncated raises SIGBUS so callers must only map files
+// that are not modified in place.
+func mmap(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,289 @@
+package hashfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Mount attaches sub to the file system under prefix so that files from
+// multiple file systems, such as separate embed.FS values for vendor & app
+// assets, can be hashed & served by a single FS and FileServer. Names under
+// prefix are resolved within sub and mounts take precedence over files in the
+// wrapped file system. Mount must be called before the file system is used.
+func (fsys *FS) Mount(prefix string, sub fs.FS) error {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" || prefix == "." || !fs.ValidPath(prefix) {
+		return fmt.Errorf("invalid mount prefix: %q", prefix)
+	}
+	prefix = fsys.path(prefix)
+
+	m, ok := fsys.fsys.(*mountFS)
+	if !ok {
+		m = &mountFS{root: fsys.fsys, mounts: make(map[string]fs.FS)}
+		fsys.fsys = m
+	}
+	m.mounts[prefix] = sub
+
+	// Remove any hashes computed for files now shadowed by the mount. All
+	// directory hashes & the case-folded index are removed since the mount
+	// may add files.
+	fsys.cache.mu.Lock()
+	defer fsys.cache.mu.Unlock()
+	fsys.cache.dirs = make(map[string]string)
+	fsys.cache.fold = nil
+	fsys.unmap(func(name string) bool { return name == prefix || strings.HasPrefix(name, prefix+"/") })
+	for name := range fsys.cache.m {
+		if name == prefix || strings.HasPrefix(name, prefix+"/") {
+			fsys.invalidateLocked(name)
+		}
+	}
+	return nil
+}
+
+// mountFS is a file system composed of a root file system & file systems
+// mounted under path prefixes.
+type mountFS struct {
+	root   fs.FS            // may be nil
+	mounts map[string]fs.FS // by path prefix
+}
+
+// lookup returns the mounted file system containing name & the name relative
+// to it. The longest matching prefix is used. Returns nil if name is not
+// within a mount.
+func (m *mountFS) lookup(name string) (fs.FS, string) {
+	var sub fs.FS
+	var prefix string
+	for p, fsys := range m.mounts {
+		if (name == p || strings.HasPrefix(name, p+"/")) && len(p) > len(prefix) {
+			sub, prefix = fsys, p
+		}
+	}
+	if sub == nil {
+		return nil, ""
+	} else if name == prefix {
+		return sub, "."
+	}
+	return sub, strings.TrimPrefix(name, prefix+"/")
+}
+
+// children returns the names of the mount points & intermediate directories
+// directly beneath the directory name.
+func (m *mountFS) children(name string) []string {
+	set := make(map[string]struct{})
+	for p := range m.mounts {
+		rel := p
+		if name != "." {
+			if !strings.HasPrefix(p, name+"/") {
+				continue
+			}
+			rel = strings.TrimPrefix(p, name+"/")
+		}
+		if i := strings.Index(rel, "/"); i != -1 {
+			rel = rel[:i]
+		}
+		set[rel] = struct{}{}
+	}
+
+	a := make([]string, 0, len(set))
+	for s := range set {
+		a = append(a, s)
+	}
+	sort.Strings(a)
+	return a
+}
+
+func (m *mountFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if sub, rel := m.lookup(name); sub != nil {
+		f, err := sub.Open(rel)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: unwrapPathError(err)}
+		} else if rel == "." {
+			return &mountRoot{File: f, name: path.Base(name)}, nil
+		}
+		return f, nil
+	}
+
+	// Merge mount points into directories of the root file system. Parent
+	// directories of mount points exist even if the root does not have them.
+	children := m.children(name)
+	var f fs.File
+	if m.root != nil {
+		var err error
+		if f, err = m.root.Open(name); err != nil && (len(children) == 0 || !errors.Is(err, fs.ErrNotExist)) {
+			return nil, err
+		}
+	}
+	if len(children) == 0 {
+		if f == nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		return f, nil
+	}
+	return &mountDir{fsys: m, file: f, name: name}, nil
+}
+
+func (m *mountFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if sub, rel := m.lookup(name); sub != nil {
+		return fs.ReadDir(sub, rel)
+	}
+
+	children := m.children(name)
+	var entries []fs.DirEntry
+	if m.root != nil {
+		var err error
+		if entries, err = fs.ReadDir(m.root, name); err != nil && (len(children) == 0 || !errors.Is(err, fs.ErrNotExist)) {
+			return nil, err
+		}
+	} else if len(children) == 0 {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	// Mount points replace entries of the same name in the root.
+	a := make([]fs.DirEntry, 0, len(entries)+len(children))
+	for _, e := range entries {
+		if i := sort.SearchStrings(children, e.Name()); i < len(children) && children[i] == e.Name() {
+			continue
+		}
+		a = append(a, e)
+	}
+	for _, child := range children {
+		a = append(a, &mountDirInfo{name: child})
+	}
+	sort.Slice(a, func(i, j int) bool { return a[i].Name() < a[j].Name() })
+	return a, nil
+}
+
+// digest returns the digest of name from the file system containing it, if
+// that file system reports digests.
+func (m *mountFS) digest(name string) ([]byte, int64, bool) {
+	fsys, rel := m.lookup(name)
+	if fsys == nil {
+		fsys, rel = m.root, name
+	}
+	if d, ok := fsys.(digestFS); ok {
+		return d.digest(rel)
+	}
+	return nil, 0, false
+}
+
+// forget removes cached metadata from the root & mounted file systems for the
+// paths for which match returns true.
+func (m *mountFS) forget(match func(name string) bool) {
+	if f, ok := m.root.(forgetFS); ok {
+		f.forget(match)
+	}
+	for prefix, fsys := range m.mounts {
+		if f, ok := fsys.(forgetFS); ok {
+			prefix := prefix
+			f.forget(func(name string) bool { return match(prefix + "/" + name) })
+		}
+	}
+}
+
+// unwrapPathError returns the underlying error of a *fs.PathError so that it
+// can be reported with the full path.
+func unwrapPathError(err error) error {
+	var e *fs.PathError
+	if errors.As(err, &e) {
+		return e.Err
+	}
+	return err
+}
+
+// mountRoot is the root directory of a mounted file system. It is reported
+// under the name of its mount point instead of ".".
+type mountRoot struct {
+	fs.File
+	name string
+}
+
+func (f *mountRoot) Stat() (fs.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &hashFileInfo{FileInfo: fi, name: f.name}, nil
+}
+
+func (f *mountRoot) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d, ok := f.File.(fs.ReadDirFile); ok {
+		return d.ReadDir(n)
+	}
+	return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not implemented")}
+}
+
+// mountDir is a directory containing mount points.
+type mountDir struct {
+	fsys    *mountFS
+	file    fs.File // directory within the root, if it exists
+	name    string
+	entries []fs.DirEntry
+	read    bool
+	offset  int
+}
+
+func (d *mountDir) Stat() (fs.FileInfo, error) {
+	if d.file != nil {
+		return d.file.Stat()
+	}
+	return &mountDirInfo{name: path.Base(d.name)}, nil
+}
+
+func (d *mountDir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: ErrIsDirectory}
+}
+
+func (d *mountDir) Close() error {
+	if d.file != nil {
+		return d.file.Close()
+	}
+	return nil
+}
+
+func (d *mountDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.read = entries, true
+	}
+
+	entries := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return entries, nil
+	} else if len(entries) == 0 {
+		return nil, io.EOF
+	} else if n > len(entries) {
+		n = len(entries)
+	}
+	d.offset += n
+	return entries[:n], nil
+}
+
+// mountDirInfo is the file info & directory entry of a directory that only
+// exists because it contains a mount point.
+type mountDirInfo struct {
+	name string
+}
+
+func (fi *mountDirInfo) Name() string       { return fi.name }
+func (fi *mountDirInfo) Size() int64        { return 0 }
+func (fi *mountDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (fi *mountDirInfo) ModTime() time.Time { return time.Time{} }
+func (fi *mountDirInfo) IsDir() bool        { return true }
+func (fi *mountDirInfo) Sys() interface{}   { return nil }
+
+func (fi *mountDirInfo) Type() fs.FileMode          { return fs.ModeDir }
+func (fi *mountDirInfo) Info() (fs.FileInfo, error) { return fi, nil }
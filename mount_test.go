@@ -0,0 +1,63 @@
+package hashfs_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestFS_Mount(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"index.html":      {Data: []byte(`<html></html>`)},
+		"vendor/old.js":   {Data: []byte(`shadowed`)},
+		"assets/logo.png": {Data: []byte(`PNG`)},
+	}, hashfs.WithHashLength(8))
+	if err := f.Mount("vendor", fstest.MapFS{"lib.js": {Data: []byte(`foo`)}}); err != nil {
+		t.Fatal(err)
+	} else if err := f.Mount("/assets/app/", fstest.MapFS{"app.js": {Data: []byte(`bar`)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("FS", func(t *testing.T) {
+		if err := fstest.TestFS(f, "index.html", "vendor/lib.js", "assets/logo.png", "assets/app/app.js"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("HashName", func(t *testing.T) {
+		if got, want := f.HashName("vendor/lib.js"), "vendor/lib-2c26b46b.js"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		} else if got, want := f.HashName("assets/app/app.js"), "assets/app/app-fcde2b2e.js"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Shadowed", func(t *testing.T) {
+		if _, err := f.Open("vendor/old.js"); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("FileServer", func(t *testing.T) {
+		r, _ := http.NewRequest("GET", f.HashName("vendor/lib.js"), nil)
+		w := httptest.NewRecorder()
+		hashfs.FileServer(f).ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Body.String(), `foo`; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("ErrInvalidPrefix", func(t *testing.T) {
+		if err := f.Mount("", fstest.MapFS{}); err == nil || err.Error() != `invalid mount prefix: ""` {
+			t.Fatalf("unexpected error: %v", err)
+		} else if err := f.Mount("../x", fstest.MapFS{}); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package hashfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+)
+
+// Overlay returns a file system that resolves names across multiple file
+// systems in order. The first file system containing a name is used, so
+// earlier file systems override later ones (e.g. an on-disk theme directory
+// overriding embedded defaults). Directories present in multiple file systems
+// are merged. Wrap the result with NewFS to use a single hash namespace.
+func Overlay(fss ...fs.FS) fs.FS {
+	return overlayFS(fss)
+}
+
+// overlayFS implements a read-only union of multiple file systems.
+type overlayFS []fs.FS
+
+// Open opens the named file from the first file system that contains it.
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	for i, fsys := range o {
+		f, err := fsys.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		// Merge directory entries with the remaining file systems.
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		} else if fi.IsDir() {
+			return &overlayDir{File: f, fsys: o[i:], name: name}, nil
+		}
+		return f, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// Stat returns file info for the named file from the first file system that
+// contains it.
+func (o overlayFS) Stat(name string) (fs.FileInfo, error) {
+	for _, fsys := range o {
+		fi, err := fs.Stat(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return fi, err
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir returns the merged entries of the named directory, sorted by name.
+// Entries from earlier file systems take precedence.
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	var found bool
+	seen := make(map[string]struct{})
+	var entries []fs.DirEntry
+	for _, fsys := range o {
+		a, err := fs.ReadDir(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		found = true
+		for _, e := range a {
+			if _, ok := seen[e.Name()]; ok {
+				continue
+			}
+			seen[e.Name()] = struct{}{}
+			entries = append(entries, e)
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// overlayDir is a directory whose entries are merged across file systems.
+type overlayDir struct {
+	fs.File
+	fsys    overlayFS
+	name    string
+	entries []fs.DirEntry // merged entries, read on first call to ReadDir
+	read    bool
+	offset  int
+}
+
+func (d *overlayDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.read = entries, true
+	}
+
+	entries := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return entries, nil
+	} else if len(entries) == 0 {
+		return nil, io.EOF
+	} else if n > len(entries) {
+		n = len(entries)
+	}
+	d.offset += n
+	return entries[:n], nil
+}
@@ -0,0 +1,63 @@
+package hashfs_test
+
+import (
+	"io/fs"
+	"os"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestOverlay(t *testing.T) {
+	base := fstest.MapFS{
+		"css/main.css":  {Data: []byte(`foo`)},
+		"css/reset.css": {Data: []byte(`bar`)},
+		"js/app.js":     {Data: []byte(`baz`)},
+	}
+	theme := fstest.MapFS{
+		"css/main.css":  {Data: []byte(`bar`)},
+		"css/theme.css": {Data: []byte(`baz`)},
+	}
+	overlay := hashfs.Overlay(theme, base)
+
+	t.Run("FS", func(t *testing.T) {
+		if err := fstest.TestFS(overlay, "css/main.css", "css/reset.css", "css/theme.css", "js/app.js"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		f := hashfs.NewFS(overlay, hashfs.WithHashLength(8))
+		if buf, err := f.ReadFile("css/main.css"); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `bar`; got != want {
+			t.Fatalf("ReadFile()=%q, want %q", got, want)
+		} else if got, want := f.HashName("css/main.css"), "css/main-fcde2b2e.css"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		} else if got, want := f.HashName("js/app.js"), "js/app-baa5a096.js"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("ReadDir", func(t *testing.T) {
+		entries, err := fs.ReadDir(overlay, "css")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		if got, want := names, []string{"main.css", "reset.css", "theme.css"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("ReadDir()=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("ErrNotExist", func(t *testing.T) {
+		if _, err := overlay.Open("missing.txt"); !os.IsNotExist(err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
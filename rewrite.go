@@ -0,0 +1,186 @@
+package hashfs
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// WithRewriteCSS returns an option that rewrites relative url() & @import
+// references within CSS files to their hash names. Rewritten content is cached
+// and the hash of the CSS file is computed from the rewritten content so that
+// it changes whenever a referenced asset changes.
+func WithRewriteCSS(enabled bool) Option {
+	return func(fsys *FS) {
+		fsys.rewriteCSS = enabled
+	}
+}
+
+// WithSourceMaps returns an option that rewrites the sourceMappingURL comment
+// within JavaScript & CSS files to the hash name of the referenced source map.
+// The source map itself is served under its own hash name so that browser
+// developer tools continue to work after files are fingerprinted.
+func WithSourceMaps(enabled bool) Option {
+	return func(fsys *FS) {
+		fsys.sourceMaps = enabled
+	}
+}
+
+// TransformFunc rewrites the contents of the named file. The name is relative
+// to the root of the wrapped file system.
+type TransformFunc func(name string, data []byte) ([]byte, error)
+
+// WithTransform returns an option that applies fn to the contents of files
+// before they are hashed & served. This can be used for minification or
+// variable substitution. Multiple transforms are applied in the order given
+// and before any built-in rewriting.
+//
+// If patterns are given then only files matching at least one of them, as
+// with WithExclude, are transformed (e.g. "*.js", "*.css"). Otherwise every
+// file is transformed. Transformed contents are held in memory & are not
+// served from precompressed variants so patterns should be given unless every
+// file is small.
+func WithTransform(fn TransformFunc, patterns ...string) Option {
+	return func(fsys *FS) {
+		fsys.transforms = append(fsys.transforms, transform{fn: fn, patterns: patterns})
+	}
+}
+
+// transform is a TransformFunc registered with WithTransform.
+type transform struct {
+	fn       TransformFunc
+	patterns []string // files the transform applies to; all files if empty
+}
+
+// matches returns true if the transform applies to the named path.
+func (t *transform) matches(name string) bool {
+	if len(t.patterns) == 0 {
+		return true
+	}
+	for _, pattern := range t.patterns {
+		if matchFilter(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// transformed returns true if the contents of the named path are rewritten
+// before being hashed & served.
+func (fsys *FS) transformed(name string) bool {
+	if fsys.excluded(name) {
+		return false
+	}
+	for i := range fsys.transforms {
+		if fsys.transforms[i].matches(name) {
+			return true
+		}
+	}
+
+	switch path.Ext(name) {
+	case ".css":
+		return fsys.rewriteCSS || fsys.sourceMaps
+	case ".js", ".mjs":
+		return fsys.sourceMaps
+	}
+	return false
+}
+
+// rewriter holds the state of a single content transformation pass.
+type rewriter struct {
+	fsys     *FS
+	visiting map[string]bool // paths currently being transformed
+	deps     []string        // paths of referenced files
+}
+
+// transform applies all enabled transformations to the contents of name.
+func (rw *rewriter) transform(name string, data []byte) (_ []byte, err error) {
+	for i := range rw.fsys.transforms {
+		if t := &rw.fsys.transforms[i]; !t.matches(name) {
+			continue
+		} else if data, err = t.fn(name, data); err != nil {
+			return nil, fmt.Errorf("transform %q: %w", name, err)
+		}
+	}
+
+	ext := path.Ext(name)
+	if rw.fsys.rewriteCSS && ext == ".css" {
+		data = rw.rewriteCSS(name, data)
+	}
+	if rw.fsys.sourceMaps && (ext == ".js" || ext == ".mjs" || ext == ".css") {
+		data = rw.rewriteSourceMap(name, data)
+	}
+	return data, nil
+}
+
+// sourceMapRegex matches a sourceMappingURL comment in JavaScript or CSS.
+var sourceMapRegex = regexp.MustCompile(`(?m)^(\s*(?://|/\*)[#@]\s*sourceMappingURL=)([^\s*]+)`)
+
+// rewriteSourceMap replaces a relative sourceMappingURL with its hash name.
+func (rw *rewriter) rewriteSourceMap(name string, data []byte) []byte {
+	return sourceMapRegex.ReplaceAllFunc(data, func(m []byte) []byte {
+		sub := sourceMapRegex.FindSubmatch(m)
+		return []byte(string(sub[1]) + rw.ref(name, string(sub[2])))
+	})
+}
+
+// cssRefRegex matches url() references & string @import references in CSS.
+var cssRefRegex = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^'")\s]*))\s*\)|@import\s+(?:"([^"]*)"|'([^']*)')`)
+
+// rewriteCSS replaces relative references within a CSS file with hash names.
+func (rw *rewriter) rewriteCSS(name string, data []byte) []byte {
+	return cssRefRegex.ReplaceAllFunc(data, func(m []byte) []byte {
+		sub := cssRefRegex.FindSubmatchIndex(m)
+		for i := 2; i < len(sub); i += 2 {
+			if sub[i] < 0 || sub[i] == sub[i+1] {
+				continue
+			}
+			ref := string(m[sub[i]:sub[i+1]])
+			if s := rw.ref(name, ref); s != ref {
+				return []byte(string(m[:sub[i]]) + s + string(m[sub[i+1]:]))
+			}
+			break
+		}
+		return m
+	})
+}
+
+// ref returns the hashed form of a reference relative to the file at name.
+// Absolute URLs, data URIs, fragments & references to missing files are
+// returned unchanged.
+func (rw *rewriter) ref(name, ref string) string {
+	if ref == "" || strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, "#") || strings.Contains(ref, ":") {
+		return ref
+	}
+
+	// Separate query string & fragment from the path.
+	p, suffix := ref, ""
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p, suffix = p[:i], p[i:]
+	}
+	if p == "" || strings.HasSuffix(p, "/") {
+		return ref
+	}
+
+	// Resolve relative to the referencing file and ignore paths outside the root.
+	target := path.Join(path.Dir(name), p)
+	if target == ".." || strings.HasPrefix(target, "../") {
+		return ref
+	}
+
+	e, err := rw.fsys.hashVisiting(context.Background(), target, rw.visiting)
+	if err != nil {
+		return ref
+	}
+	rw.deps = append(rw.deps, target)
+
+	// Replace only the base name so the reference keeps its original form.
+	// Merge query strings if the hash is stored in the query string.
+	base := path.Base(e.hashName)
+	if strings.HasPrefix(suffix, "?") && strings.Contains(base, "?") {
+		suffix = "&" + suffix[1:]
+	}
+	return p[:len(p)-len(path.Base(p))] + base + suffix
+}
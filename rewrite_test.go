@@ -0,0 +1,219 @@
+package hashfs_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestFS_WithRewriteCSS(t *testing.T) {
+	newFS := func() (fstest.MapFS, *hashfs.FS) {
+		mfs := fstest.MapFS{
+			"css/app.css": {Data: []byte(`@import 'other.css';
+body { background: url(../img/bg.png); }
+@font-face { src: url("fonts/a.woff2?v=1#x"); }
+a { b: url(data:image/png;base64,AA==); c: url(/abs.png); d: url( missing.png ); }
+`)},
+			"css/other.css":      {Data: []byte(`x { background: url('app.css'); }`)},
+			"css/fonts/a.woff2":  {Data: []byte(`bar`)},
+			"img/bg.png":         {Data: []byte(`foo`)},
+			"outside/escape.css": {Data: []byte(`x { y: url(../../img/bg.png); }`)},
+		}
+		return mfs, hashfs.NewFS(mfs, hashfs.WithHashLength(8), hashfs.WithRewriteCSS(true))
+	}
+
+	t.Run("ReadFile", func(t *testing.T) {
+		_, f := newFS()
+		buf, err := f.ReadFile("css/app.css")
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `@import 'other-86a22255.css';
+body { background: url(../img/bg-2c26b46b.png); }
+@font-face { src: url("fonts/a-fcde2b2e.woff2?v=1#x"); }
+a { b: url(data:image/png;base64,AA==); c: url(/abs.png); d: url( missing.png ); }
+`; got != want {
+			t.Fatalf("ReadFile()=%s, want %s", got, want)
+		}
+
+		// Cyclic references are left unchanged.
+		if buf, err := f.ReadFile("css/other.css"); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `x { background: url('app.css'); }`; got != want {
+			t.Fatalf("ReadFile()=%s, want %s", got, want)
+		}
+
+		// References outside the root are left unchanged.
+		if buf, err := f.ReadFile("outside/escape.css"); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `x { y: url(../../img/bg.png); }`; got != want {
+			t.Fatalf("ReadFile()=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("HashName", func(t *testing.T) {
+		_, f := newFS()
+		hashName := f.HashName("css/app.css")
+		buf, err := f.ReadFile("css/app.css")
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := hashName, hashfs.FormatName("css/app.css", hashHex(buf)[:8]); got != want {
+			t.Fatalf("HashName()=%s, want %s", got, want)
+		}
+
+		fi, err := f.Stat(hashName)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := fi.Size(), int64(len(buf)); got != want {
+			t.Fatalf("Size()=%d, want %d", got, want)
+		}
+
+		file, err := f.Open(hashName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if data, err := io.ReadAll(file); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(data), string(buf); got != want {
+			t.Fatalf("Open()=%s, want %s", got, want)
+		}
+	})
+
+	t.Run("Invalidate", func(t *testing.T) {
+		mfs, f := newFS()
+		prev := f.HashName("css/app.css")
+
+		mfs["img/bg.png"] = &fstest.MapFile{Data: []byte(`baz`)}
+		f.Invalidate("img/bg.png")
+		if got := f.HashName("css/app.css"); got == prev {
+			t.Fatalf("expected hash name to change after referenced file changed: %s", got)
+		}
+		if buf, err := f.ReadFile("css/app.css"); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Contains(buf, []byte(`url(../img/bg-baa5a096.png)`)) {
+			t.Fatalf("unexpected content: %s", buf)
+		}
+	})
+
+	t.Run("HashLocationQuery", func(t *testing.T) {
+		f := hashfs.NewFS(fstest.MapFS{
+			"app.css": {Data: []byte(`a { b: url(a.woff2?x=1#y); c: url(bg.png); }`)},
+			"a.woff2": {Data: []byte(`bar`)},
+			"bg.png":  {Data: []byte(`foo`)},
+		}, hashfs.WithHashLength(8), hashfs.WithHashLocation(hashfs.HashLocationQuery), hashfs.WithRewriteCSS(true))
+		if buf, err := f.ReadFile("app.css"); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `a { b: url(a.woff2?v=fcde2b2e&x=1#y); c: url(bg.png?v=2c26b46b); }`; got != want {
+			t.Fatalf("ReadFile()=%s, want %s", got, want)
+		}
+	})
+}
+
+// hashHex returns the hex-encoded SHA-256 digest of buf.
+func hashHex(buf []byte) string {
+	hash := sha256.Sum256(buf)
+	return hex.EncodeToString(hash[:])
+}
+
+func TestFS_WithSourceMaps(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"js/app.js":       {Data: []byte("console.log(1);\n//# sourceMappingURL=app.js.map\n")},
+		"js/app.js.map":   {Data: []byte(`foo`)},
+		"css/app.css":     {Data: []byte("a{}\n/*# sourceMappingURL=app.css.map */\n")},
+		"css/app.css.map": {Data: []byte(`bar`)},
+		"js/remote.js":    {Data: []byte("//# sourceMappingURL=https://example.com/remote.js.map\n")},
+	}, hashfs.WithHashLength(8), hashfs.WithSourceMaps(true))
+
+	for _, tt := range []struct {
+		name string
+		want string
+	}{
+		{"js/app.js", "console.log(1);\n//# sourceMappingURL=app-2c26b46b.js.map\n"},
+		{"css/app.css", "a{}\n/*# sourceMappingURL=app-fcde2b2e.css.map */\n"},
+		{"js/remote.js", "//# sourceMappingURL=https://example.com/remote.js.map\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if buf, err := f.ReadFile(tt.name); err != nil {
+				t.Fatal(err)
+			} else if got := string(buf); got != tt.want {
+				t.Fatalf("ReadFile()=%q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Source maps are served under their own hash name.
+	if buf, err := f.ReadFile("js/app-2c26b46b.js.map"); err != nil {
+		t.Fatal(err)
+	} else if got, want := string(buf), `foo`; got != want {
+		t.Fatalf("ReadFile()=%q, want %q", got, want)
+	}
+}
+
+func TestFS_WithTransform(t *testing.T) {
+	mfs := fstest.MapFS{
+		"a.txt": {Data: []byte(`foo`)},
+		"b.txt": {Data: []byte(`fail`)},
+	}
+	f := hashfs.NewFS(mfs, hashfs.WithHashLength(8),
+		hashfs.WithTransform(func(name string, data []byte) ([]byte, error) {
+			if string(data) == "fail" {
+				return nil, errors.New("marker")
+			}
+			return bytes.ToUpper(data), nil
+		}),
+		hashfs.WithTransform(func(name string, data []byte) ([]byte, error) {
+			return append(data, '!'), nil
+		}),
+	)
+
+	if buf, err := f.ReadFile("a.txt"); err != nil {
+		t.Fatal(err)
+	} else if got, want := string(buf), `FOO!`; got != want {
+		t.Fatalf("ReadFile()=%q, want %q", got, want)
+	}
+
+	hashName := f.HashName("a.txt")
+	if got, want := hashName, hashfs.FormatName("a.txt", hashHex([]byte(`FOO!`))[:8]); got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	}
+	if fi, err := f.Stat(hashName); err != nil {
+		t.Fatal(err)
+	} else if got, want := fi.Size(), int64(4); got != want {
+		t.Fatalf("Size()=%d, want %d", got, want)
+	}
+
+	if _, err := f.ReadFile("b.txt"); err == nil || err.Error() != `transform "b.txt": marker` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Transforms with patterns only apply to matching files.
+	var names []string
+	f = hashfs.NewFS(fstest.MapFS{
+		"css/app.css": {Data: []byte(`foo`)},
+		"img/app.png": {Data: []byte(`bar`)},
+	}, hashfs.WithHashLength(8), hashfs.WithTransform(func(name string, data []byte) ([]byte, error) {
+		names = append(names, name)
+		return bytes.ToUpper(data), nil
+	}, "*.css"))
+
+	if buf, err := f.ReadFile("css/app.css"); err != nil {
+		t.Fatal(err)
+	} else if got, want := string(buf), `FOO`; got != want {
+		t.Fatalf("ReadFile()=%q, want %q", got, want)
+	} else if buf, err := f.ReadFile("img/app.png"); err != nil {
+		t.Fatal(err)
+	} else if got, want := string(buf), `bar`; got != want {
+		t.Fatalf("ReadFile()=%q, want %q", got, want)
+	} else if got, want := f.HashName("img/app.png"), "img/app-fcde2b2e.png"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	} else if got, want := names, []string{"css/app.css"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("transformed=%v, want %v", got, want)
+	}
+}
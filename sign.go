@@ -0,0 +1,106 @@
+package hashfs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WithSigningKey returns an option that sets the key used to sign names with
+// SignedName & to verify signed requests in FileServer.
+func WithSigningKey(key []byte) Option {
+	return func(fsys *FS) {
+		fsys.signingKey = key
+	}
+}
+
+// SignedName returns the hash name for name with an HMAC signature & an
+// expiration time appended as "sig" & "exp" query parameters (e.g.
+// "main-HASH.js?sig=...&exp=..."). FileServer rejects requests with invalid
+// or expired signatures so that semi-private assets can be linked to for a
+// limited time while their content is still cached by hash. Returns an error
+// if no signing key is set or if the file cannot be read.
+func (fsys *FS) SignedName(name string, expiry time.Time) (string, error) {
+	if len(fsys.signingKey) == 0 {
+		return "", errors.New("signing key required")
+	}
+
+	hashName, err := fsys.HashNameE(name)
+	if err != nil {
+		return "", err
+	}
+
+	sep := "?"
+	if strings.Contains(hashName, "?") {
+		sep = "&"
+	}
+	exp := strconv.FormatInt(expiry.Unix(), 10)
+	return hashName + sep + "sig=" + fsys.signature(hashName, exp) + "&exp=" + exp, nil
+}
+
+// signature returns the encoded HMAC of a name & expiration time.
+func (fsys *FS) signature(name, exp string) string {
+	mac := hmac.New(sha256.New, fsys.signingKey)
+	mac.Write([]byte(name + "\n" + exp))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifySignature returns true if sig is a valid signature of name & exp and
+// the expiration time is after now.
+func (fsys *FS) verifySignature(name, sig, exp string, now time.Time) bool {
+	if len(fsys.signingKey) == 0 {
+		return false
+	} else if t, err := strconv.ParseInt(exp, 10, 64); err != nil || now.Unix() >= t {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(fsys.signature(name, exp)))
+}
+
+// WithSignatureRequired returns an option that only serves files matching the
+// glob patterns when they are requested with a valid, unexpired name from
+// SignedName. Patterns use the same syntax as WithCacheRules and are matched
+// against the original name of the file being served, however it was
+// requested. Requests with a signature are always verified, regardless of the
+// patterns.
+func WithSignatureRequired(patterns ...string) ServerOption {
+	return func(h *fsHandler) {
+		h.signedPatterns = append(h.signedPatterns, patterns...)
+	}
+}
+
+// SignedCacheControl is the Cache-Control header value used for requests with
+// a valid signature. Responses may only be stored by the client & must be
+// revalidated so that they are not served from a shared cache or reused once
+// the signature expires.
+const SignedCacheControl = `private, no-cache`
+
+// verifyRequestSignature returns ok if the request has no signature or has a
+// valid signature for the requested path, before any rewrite. Returns signed
+// if the request has a valid signature.
+func (h *fsHandler) verifyRequestSignature(r *http.Request, requested string) (signed, ok bool) {
+	q := r.URL.Query()
+	sig := q.Get("sig")
+	if sig == "" || (len(h.fsys.signingKey) == 0 && len(h.signedPatterns) == 0) {
+		return false, true
+	}
+	ok = h.fsys.verifySignature(requested, sig, q.Get("exp"), time.Now())
+	return ok, ok
+}
+
+// signatureRequired returns true if the file at name, relative to the file
+// system, may only be served to requests with a valid signature. The name is
+// the original name of the resolved file so that protected files cannot be
+// requested through other paths, such as hashed directories or case variants.
+func (h *fsHandler) signatureRequired(name string) bool {
+	for _, pattern := range h.signedPatterns {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package hashfs_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestFS_SignedName(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"downloads/book.pdf":    {Data: []byte(`foo`)},
+		"downloads/fr/book.pdf": {Data: []byte(`baz`)},
+		"main.js":               {Data: []byte(`bar`)},
+	}, hashfs.WithHashLength(8), hashfs.WithSigningKey([]byte("secret")))
+	h := hashfs.FileServer(f, hashfs.WithSignatureRequired("downloads/**"))
+
+	serve := func(path string) int {
+		t.Helper()
+		r, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	name, err := f.SignedName("downloads/book.pdf", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.HasPrefix(name, "downloads/book-2c26b46b.pdf?sig=") || !strings.Contains(name, "&exp=") {
+		t.Fatalf("unexpected signed name: %q", name)
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		if got, want := serve(name), http.StatusOK; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+
+		// Signed responses must not be stored in shared caches.
+		r, _ := http.NewRequest("GET", name, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Header().Get("Cache-Control"), hashfs.SignedCacheControl; got != want {
+			t.Fatalf("Cache-Control=%q, want %q", got, want)
+		}
+	})
+
+	// Signatures are verified against the requested path, not the rewritten one.
+	t.Run("Rewrite", func(t *testing.T) {
+		h := hashfs.FileServer(f, hashfs.WithSignatureRequired("downloads/**"), hashfs.WithRewrite(func(r *http.Request, path string) string {
+			if r.Header.Get("Accept-Language") == "fr" {
+				return "downloads/fr/book.pdf"
+			}
+			return path
+		}))
+
+		r, _ := http.NewRequest("GET", name, nil)
+		r.Header.Set("Accept-Language", "fr")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusOK; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Body.String(), `baz`; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		}
+
+		// Unsigned requests rewritten to protected files are still rejected.
+		r, _ = http.NewRequest("GET", "main.js", nil)
+		r.Header.Set("Accept-Language", "fr")
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusForbidden; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Unsigned", func(t *testing.T) {
+		if got, want := serve("downloads/book-2c26b46b.pdf"), http.StatusForbidden; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := serve("downloads/book.pdf"), http.StatusForbidden; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+
+		// Files not matching a pattern do not require a signature.
+		if got, want := serve("main.js"), http.StatusOK; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+	})
+
+	// Protected files cannot be requested unsigned through other paths that
+	// resolve to them.
+	t.Run("OtherPaths", func(t *testing.T) {
+		f := hashfs.NewFS(fstest.MapFS{
+			"paid/book.pdf": {Data: []byte(`foo`)},
+		}, hashfs.WithHashLength(8), hashfs.WithSigningKey([]byte("secret")), hashfs.WithCaseInsensitive(true))
+		h := hashfs.FileServer(f, hashfs.WithSignatureRequired("paid/book.pdf"))
+
+		for _, path := range []string{
+			"/paid/book.pdf",
+			"/" + f.HashDirName("paid/") + "book.pdf",
+			"/PAID/book.pdf",
+			"/paid/book%2Epdf",
+		} {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.URL.Path = path
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got, want := w.Code, http.StatusForbidden; got != want {
+				t.Fatalf("%s: code=%v, want %v", path, got, want)
+			}
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		if got, want := serve(strings.Replace(name, "sig=", "sig=x", 1)), http.StatusForbidden; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+
+		// Signatures cannot be reused for other files.
+		other := strings.Replace(name, "downloads/book-2c26b46b.pdf", "main-fcde2b2e.js", 1)
+		if got, want := serve(other), http.StatusForbidden; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		name, err := f.SignedName("downloads/book.pdf", time.Now().Add(-time.Second))
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := serve(name), http.StatusForbidden; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("NoKey", func(t *testing.T) {
+		if _, err := hashfs.NewFS(fstest.MapFS{}).SignedName("main.js", time.Now()); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
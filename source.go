@@ -0,0 +1,418 @@
+package hashfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source represents a backing store of files that is not necessarily a file
+// system, such as an HTTP origin or an object store like S3 or GCS. Sources
+// are wrapped with NewSourceFS so that they can be passed to NewFS.
+//
+// Sources may implement ReaderAtSource & HashSource to avoid reading whole
+// files when serving ranges or computing hashes.
+type Source interface {
+	// Open returns a reader for the contents of the named file. Returns an
+	// error wrapping fs.ErrNotExist if the file does not exist.
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+
+	// Stat returns the file info of the named file.
+	Stat(ctx context.Context, name string) (fs.FileInfo, error)
+}
+
+// ReaderAtSource is a Source that can read part of a file without reading it
+// from the start. Files opened from it can seek so that FileServer can serve
+// range requests without downloading the whole file.
+type ReaderAtSource interface {
+	Source
+	ReadAt(ctx context.Context, name string, p []byte, off int64) (int, error)
+}
+
+// HashSource is a Source that can report the SHA-256 digest of a file without
+// it being read, such as from object metadata. Hash returns nil if the digest
+// is unknown, in which case the file is read & hashed.
+type HashSource interface {
+	Source
+	Hash(ctx context.Context, name string) ([]byte, error)
+}
+
+// NewSourceFS returns a file system that reads files from src. File info &
+// digests are cached in memory until the file is invalidated with
+// FS.Invalidate or FS.Reset, so that repeated requests do not reach the
+// source. Sources cannot list files so Warm, Walk & directory listings are not
+// supported. The underlying source is called with a background context.
+func NewSourceFS(src Source) fs.FS {
+	return &sourceFS{src: src}
+}
+
+// errListNotSupported is returned when reading a directory of a Source.
+var errListNotSupported = errors.New("source does not support listing")
+
+// Ensure file system implements interface.
+var _ fs.StatFS = (*sourceFS)(nil)
+
+// sourceFS adapts a Source to an fs.FS.
+type sourceFS struct {
+	src    Source
+	infos  sync.Map // fs.FileInfo by name
+	hashes sync.Map // digests by name
+}
+
+func (fsys *sourceFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	} else if name == "." {
+		return &sourceDir{}, nil
+	}
+
+	fi, err := fsys.Stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: unwrapPathError(err)}
+	}
+
+	// Read lazily if the source supports ranges. Otherwise stream the file.
+	if ra, ok := fsys.src.(ReaderAtSource); ok {
+		return &sourceSeekFile{r: &sourceReaderAt{src: ra, name: name}, fi: fi}, nil
+	}
+	rc, err := fsys.src.Open(context.Background(), name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: unwrapPathError(err)}
+	}
+	return &sourceFile{ReadCloser: rc, fi: fi}, nil
+}
+
+func (fsys *sourceFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	} else if name == "." {
+		return &mountDirInfo{name: "."}, nil
+	} else if v, ok := fsys.infos.Load(name); ok {
+		return v.(fs.FileInfo), nil
+	}
+
+	fi, err := fsys.src.Stat(context.Background(), name)
+	if err != nil {
+		return nil, err
+	}
+	fsys.infos.Store(name, fi)
+	return fi, nil
+}
+
+func (fsys *sourceFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: name, Err: errListNotSupported}
+}
+
+// digest returns the digest & size of the named file if the source reports
+// them without the file being read.
+func (fsys *sourceFS) digest(name string) (hash []byte, size int64, ok bool) {
+	src, ok := fsys.src.(HashSource)
+	if !ok {
+		return nil, 0, false
+	}
+
+	fi, err := fsys.Stat(name)
+	if err != nil || fi.IsDir() {
+		return nil, 0, false
+	} else if v, ok := fsys.hashes.Load(name); ok {
+		return v.([]byte), fi.Size(), true
+	}
+
+	hash, err = src.Hash(context.Background(), name)
+	if err != nil || len(hash) != sha256.Size {
+		return nil, 0, false
+	}
+	fsys.hashes.Store(name, hash)
+	return hash, fi.Size(), true
+}
+
+// forget removes the cached file info & digests of the paths for which match
+// returns true.
+func (fsys *sourceFS) forget(match func(name string) bool) {
+	for _, m := range []*sync.Map{&fsys.infos, &fsys.hashes} {
+		m.Range(func(k, _ interface{}) bool {
+			if match(k.(string)) {
+				m.Delete(k)
+			}
+			return true
+		})
+	}
+}
+
+// digestFS is implemented by file systems that can report the digest of a
+// file without it being read.
+type digestFS interface {
+	digest(name string) (hash []byte, size int64, ok bool)
+}
+
+// forgetFS is implemented by file systems that cache metadata which must be
+// removed when files are invalidated.
+type forgetFS interface {
+	forget(match func(name string) bool)
+}
+
+// sourceReaderAt reads a file from a ReaderAtSource.
+type sourceReaderAt struct {
+	src  ReaderAtSource
+	name string
+}
+
+func (r *sourceReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return r.src.ReadAt(context.Background(), r.name, p, off)
+}
+
+// sourceFile is a file streamed from a Source.
+type sourceFile struct {
+	io.ReadCloser
+	fi fs.FileInfo
+}
+
+func (f *sourceFile) Stat() (fs.FileInfo, error) { return f.fi, nil }
+
+// sourceReadAhead is the number of bytes requested from a ReaderAtSource for
+// sequential reads so that a file is not requested in many small ranges.
+const sourceReadAhead = 1 << 20
+
+// sourceSeekFile is a file read from a ReaderAtSource. Nothing is requested
+// from the source until the file is read.
+type sourceSeekFile struct {
+	r      io.ReaderAt
+	fi     fs.FileInfo
+	off    int64  // read offset
+	buf    []byte // contents read ahead of off
+	bufOff int64  // offset of buf within the file
+}
+
+func (f *sourceSeekFile) Stat() (fs.FileInfo, error) { return f.fi, nil }
+func (f *sourceSeekFile) Close() error               { return nil }
+
+func (f *sourceSeekFile) Read(p []byte) (int, error) {
+	if f.off >= f.fi.Size() {
+		return 0, io.EOF
+	}
+
+	// Read ahead if the offset is outside of the buffered contents.
+	if f.off < f.bufOff || f.off >= f.bufOff+int64(len(f.buf)) {
+		n := f.fi.Size() - f.off
+		if n > sourceReadAhead {
+			n = sourceReadAhead
+		}
+		if int64(cap(f.buf)) < n {
+			f.buf = make([]byte, n)
+		}
+		m, err := f.r.ReadAt(f.buf[:n], f.off)
+		f.buf, f.bufOff = f.buf[:m], f.off
+		if m == 0 {
+			if err == nil {
+				err = io.ErrNoProgress
+			}
+			return 0, err
+		}
+	}
+
+	n := copy(p, f.buf[f.off-f.bufOff:])
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *sourceSeekFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.r.ReadAt(p, off)
+}
+
+func (f *sourceSeekFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.fi.Size()
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.fi.Name(), Err: fs.ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+// sourceDir is the root directory of a Source.
+type sourceDir struct{}
+
+func (d *sourceDir) Stat() (fs.FileInfo, error) { return &mountDirInfo{name: "."}, nil }
+func (d *sourceDir) Close() error               { return nil }
+
+func (d *sourceDir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: ErrIsDirectory}
+}
+
+func (d *sourceDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: ".", Err: errListNotSupported}
+}
+
+// FSSource returns a Source that reads files from fsys. This allows file
+// systems to be used where a Source is expected, such as in tests.
+func FSSource(fsys fs.FS) Source {
+	return &fsSource{fsys: fsys}
+}
+
+type fsSource struct {
+	fsys fs.FS
+}
+
+func (s *fsSource) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return s.fsys.Open(name)
+}
+
+func (s *fsSource) Stat(ctx context.Context, name string) (fs.FileInfo, error) {
+	return fs.Stat(s.fsys, name)
+}
+
+// HTTPSource returns a Source that fetches files from baseURL with GET & HEAD
+// requests sent through rt. If rt is nil then http.DefaultTransport is used.
+//
+// Object stores such as S3 & GCS can be used by passing the bucket's endpoint
+// and a RoundTripper that signs requests, or none for public buckets. Range
+// requests are used to read parts of files. Digests are read from a sha-256
+// "Repr-Digest" header or from S3's "X-Amz-Checksum-Sha256" header so that
+// files uploaded with a checksum do not need to be downloaded to be hashed.
+func HTTPSource(baseURL string, rt http.RoundTripper) Source {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &httpSource{baseURL: strings.TrimSuffix(baseURL, "/") + "/", client: &http.Client{Transport: rt}}
+}
+
+type httpSource struct {
+	baseURL string
+	client  *http.Client
+}
+
+// do sends a request for the named file & returns the response if it has a
+// successful status code.
+func (s *httpSource) do(ctx context.Context, method, name string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.baseURL+escapePath(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, &fs.PathError{Op: strings.ToLower(method), Path: name, Err: err}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return resp, nil
+	case http.StatusNotFound, http.StatusGone:
+		err = fs.ErrNotExist
+	case http.StatusUnauthorized, http.StatusForbidden:
+		err = fs.ErrPermission
+	default:
+		err = fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	resp.Body.Close()
+	return nil, &fs.PathError{Op: strings.ToLower(method), Path: name, Err: err}
+}
+
+// escapePath returns name with each path segment escaped for use in a URL so
+// that names containing characters such as "#", "?" or "%" are requested as-is.
+func escapePath(name string) string {
+	segments := strings.Split(name, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	return strings.Join(segments, "/")
+}
+
+func (s *httpSource) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, "GET", name, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *httpSource) Stat(ctx context.Context, name string) (fs.FileInfo, error) {
+	resp, err := s.do(ctx, "HEAD", name, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	fi := &sourceFileInfo{name: path.Base(name), size: resp.ContentLength}
+	if fi.size < 0 {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: errors.New("missing content length")}
+	}
+	fi.modTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return fi, nil
+}
+
+func (s *httpSource) ReadAt(ctx context.Context, name string, p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1)}}
+	resp, err := s.do(ctx, "GET", name, header)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Servers that ignore the range return the whole file from the start.
+	if resp.StatusCode == http.StatusOK {
+		if _, err := io.CopyN(io.Discard, resp.Body, off); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := io.ReadFull(resp.Body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (s *httpSource) Hash(ctx context.Context, name string) ([]byte, error) {
+	resp, err := s.do(ctx, "HEAD", name, http.Header{"X-Amz-Checksum-Mode": {"ENABLED"}})
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if v := resp.Header.Get("X-Amz-Checksum-Sha256"); v != "" {
+		return base64.StdEncoding.DecodeString(v)
+	}
+	for _, field := range strings.Split(resp.Header.Get("Repr-Digest"), ",") {
+		if v := strings.TrimSpace(field); strings.HasPrefix(v, "sha-256=:") && strings.HasSuffix(v, ":") {
+			return base64.StdEncoding.DecodeString(v[len("sha-256=:") : len(v)-1])
+		}
+	}
+	return nil, nil
+}
+
+// sourceFileInfo is the file info of a file fetched from an HTTP source.
+type sourceFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi *sourceFileInfo) Name() string       { return fi.name }
+func (fi *sourceFileInfo) Size() int64        { return fi.size }
+func (fi *sourceFileInfo) Mode() fs.FileMode  { return 0444 }
+func (fi *sourceFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *sourceFileInfo) IsDir() bool        { return false }
+func (fi *sourceFileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,192 @@
+package hashfs_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestSourceFS(t *testing.T) {
+	t.Run("FSSource", func(t *testing.T) {
+		src := hashfs.FSSource(fstest.MapFS{"a/b.txt": {Data: []byte(`foo`)}})
+		f := hashfs.NewFS(hashfs.NewSourceFS(src), hashfs.WithHashLength(8))
+		if got, want := f.HashName("a/b.txt"), "a/b-2c26b46b.txt"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		} else if buf, err := fs.ReadFile(f, "a/b-2c26b46b.txt"); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `foo`; got != want {
+			t.Fatalf("ReadFile()=%q, want %q", got, want)
+		} else if _, err := f.Open("a/c.txt"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("HashSource", func(t *testing.T) {
+		src := &hashSource{Source: hashfs.FSSource(fstest.MapFS{"a.txt": {Data: []byte(`foo`)}})}
+		f := hashfs.NewFS(hashfs.NewSourceFS(src), hashfs.WithHashLength(8))
+		for i := 0; i < 2; i++ {
+			if got, want := f.HashName("a.txt"), "a-2c26b46b.txt"; got != want {
+				t.Fatalf("HashName()=%q, want %q", got, want)
+			}
+		}
+
+		// The digest is used without reading the file & metadata is cached.
+		if got, want := atomic.LoadInt64(&src.opens), int64(0); got != want {
+			t.Fatalf("opens=%d, want %d", got, want)
+		} else if got, want := atomic.LoadInt64(&src.stats), int64(1); got != want {
+			t.Fatalf("stats=%d, want %d", got, want)
+		} else if got, want := f.Stats().BytesHashed, int64(0); got != want {
+			t.Fatalf("BytesHashed=%d, want %d", got, want)
+		}
+
+		// Invalidation removes cached metadata.
+		f.Invalidate("a.txt")
+		if got, want := f.HashName("a.txt"), "a-2c26b46b.txt"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		} else if got, want := atomic.LoadInt64(&src.stats), int64(2); got != want {
+			t.Fatalf("stats=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("ErrListNotSupported", func(t *testing.T) {
+		src := hashfs.FSSource(fstest.MapFS{"a.txt": {Data: []byte(`foo`)}})
+		f := hashfs.NewFS(hashfs.NewSourceFS(src))
+		if err := f.Warm(context.Background()); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestHTTPSource(t *testing.T) {
+	data := []byte(`foobar`)
+	sum := sha256.Sum256(data)
+
+	// Serve files with a digest header & count the requests received.
+	var gets, ranges int64
+	origin := http.FileServer(http.FS(fstest.MapFS{"a.txt": {Data: data}, "b.txt": {Data: data}, "dir/100% #1?.txt": {Data: data}}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/secret.txt":
+			w.WriteHeader(http.StatusForbidden)
+			return
+		case "/a.txt":
+			w.Header().Set("Repr-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+		}
+		if r.Method == "GET" {
+			atomic.AddInt64(&gets, 1)
+			if r.Header.Get("Range") != "" {
+				atomic.AddInt64(&ranges, 1)
+			}
+		}
+		origin.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	f := hashfs.NewFS(hashfs.NewSourceFS(hashfs.HTTPSource(srv.URL, nil)), hashfs.WithHashLength(8))
+
+	t.Run("Hash", func(t *testing.T) {
+		if got, want := f.HashName("a.txt"), "a-c3ab8ff1.txt"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		} else if got, want := atomic.LoadInt64(&gets), int64(0); got != want {
+			t.Fatalf("gets=%d, want %d", got, want)
+		}
+
+		// Files without a digest header are downloaded & hashed.
+		if got, want := f.HashName("b.txt"), "b-c3ab8ff1.txt"; got != want {
+			t.Fatalf("HashName()=%q, want %q", got, want)
+		} else if got, want := f.Stats().BytesHashed, int64(len(data)); got != want {
+			t.Fatalf("BytesHashed=%d, want %d", got, want)
+		}
+	})
+
+	// Names are escaped so that special characters are not read as part of
+	// the URL's syntax.
+	t.Run("Escape", func(t *testing.T) {
+		if buf, err := fs.ReadFile(f, "dir/100% #1?.txt"); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), string(data); got != want {
+			t.Fatalf("ReadFile()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Range", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/a-c3ab8ff1.txt", nil)
+		r.Header.Set("Range", "bytes=3-")
+		w := httptest.NewRecorder()
+		hashfs.FileServer(f).ServeHTTP(w, r)
+		if got, want := w.Code, http.StatusPartialContent; got != want {
+			t.Fatalf("code=%v, want %v", got, want)
+		} else if got, want := w.Body.String(), `bar`; got != want {
+			t.Fatalf("body=%q, want %q", got, want)
+		} else if got, want := atomic.LoadInt64(&ranges), atomic.LoadInt64(&gets); got != want {
+			t.Fatalf("ranges=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("ReadAhead", func(t *testing.T) {
+		atomic.StoreInt64(&gets, 0)
+		file, err := f.Open("b.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		// Small reads are served from a single range request.
+		p := make([]byte, 2)
+		var buf []byte
+		for {
+			n, err := file.Read(p)
+			buf = append(buf, p[:n]...)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got, want := string(buf), `foobar`; got != want {
+			t.Fatalf("Read()=%q, want %q", got, want)
+		} else if got, want := atomic.LoadInt64(&gets), int64(1); got != want {
+			t.Fatalf("gets=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if _, err := f.Open("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("unexpected error: %v", err)
+		} else if _, err := f.Open("secret.txt"); !errors.Is(err, fs.ErrPermission) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// hashSource wraps a source to report digests & count calls to Open & Stat.
+type hashSource struct {
+	hashfs.Source
+	opens int64 // accessed atomically
+	stats int64 // accessed atomically
+}
+
+func (s *hashSource) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	atomic.AddInt64(&s.opens, 1)
+	return s.Source.Open(ctx, name)
+}
+
+func (s *hashSource) Stat(ctx context.Context, name string) (fs.FileInfo, error) {
+	atomic.AddInt64(&s.stats, 1)
+	return s.Source.Stat(ctx, name)
+}
+
+func (s *hashSource) Hash(ctx context.Context, name string) ([]byte, error) {
+	sum := sha256.Sum256([]byte(`foo`))
+	return sum[:], nil
+}
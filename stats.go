@@ -0,0 +1,109 @@
+package hashfs
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+// Stats represents statistics about the hash cache of a file system and the
+// file servers that serve it.
+type Stats struct {
+	Entries      int   // number of cached hashes
+	ContentBytes int64 // bytes of file contents held in memory
+	Evictions    int64 // number of hashes evicted due to WithMaxCachedNames
+	Hits         int64 // number of hash lookups served from the cache
+	Misses       int64 // number of hashes computed
+	BytesHashed  int64 // number of bytes read & hashed
+
+	// Number of responses written by FileServer, by status code.
+	Requests map[int]int64
+}
+
+// Stats returns statistics about the hash cache. Because the cache is shared
+// with sub file systems created by Sub, the statistics include their files.
+func (fsys *FS) Stats() Stats {
+	fsys.cache.mu.RLock()
+	stats := Stats{
+		Entries:      len(fsys.cache.m),
+		ContentBytes: fsys.cache.dataSize,
+		Evictions:    atomic.LoadInt64(&fsys.cache.evictions),
+		Hits:         atomic.LoadInt64(&fsys.cache.hits),
+		Misses:       atomic.LoadInt64(&fsys.cache.misses),
+		BytesHashed:  atomic.LoadInt64(&fsys.cache.bytesHashed),
+	}
+	fsys.cache.mu.RUnlock()
+
+	stats.Requests = make(map[int]int64)
+	for code := range fsys.cache.requests {
+		if n := atomic.LoadInt64(&fsys.cache.requests[code]); n > 0 {
+			stats.Requests[code] = n
+		}
+	}
+
+	return stats
+}
+
+// addRequest increments the count of FileServer responses with status code.
+// Counters are updated atomically since this is called on every response.
+// Codes outside of the range accepted by net/http are ignored.
+func (fsys *FS) addRequest(code int) {
+	if code >= 0 && code < len(fsys.cache.requests) {
+		atomic.AddInt64(&fsys.cache.requests[code], 1)
+	}
+}
+
+// Collector exposes the statistics of a file system for monitoring systems.
+// It implements expvar.Var so it can be registered with expvar.Publish, and
+// Collect can be adapted to metrics libraries such as Prometheus.
+type Collector struct {
+	fsys *FS
+}
+
+// NewCollector returns a new Collector for fsys.
+func NewCollector(fsys *FS) *Collector {
+	return &Collector{fsys: fsys}
+}
+
+// String returns the statistics as a JSON object.
+func (c *Collector) String() string {
+	stats := c.fsys.Stats()
+
+	requests := make(map[string]int64, len(stats.Requests))
+	for code, n := range stats.Requests {
+		requests[strconv.Itoa(code)] = n
+	}
+
+	buf, _ := json.Marshal(struct {
+		Entries      int              `json:"entries"`
+		ContentBytes int64            `json:"contentBytes"`
+		Evictions    int64            `json:"evictions"`
+		Hits         int64            `json:"hits"`
+		Misses       int64            `json:"misses"`
+		BytesHashed  int64            `json:"bytesHashed"`
+		Requests     map[string]int64 `json:"requests"`
+	}{stats.Entries, stats.ContentBytes, stats.Evictions, stats.Hits, stats.Misses, stats.BytesHashed, requests})
+	return string(buf)
+}
+
+// Collect calls fn for each metric using Prometheus naming conventions. The
+// labels are nil except for request counts, which are labeled by "code".
+func (c *Collector) Collect(fn func(name string, labels map[string]string, value float64)) {
+	stats := c.fsys.Stats()
+	fn("hashfs_cache_entries", nil, float64(stats.Entries))
+	fn("hashfs_cache_content_bytes", nil, float64(stats.ContentBytes))
+	fn("hashfs_cache_evictions_total", nil, float64(stats.Evictions))
+	fn("hashfs_cache_hits_total", nil, float64(stats.Hits))
+	fn("hashfs_cache_misses_total", nil, float64(stats.Misses))
+	fn("hashfs_hashed_bytes_total", nil, float64(stats.BytesHashed))
+
+	codes := make([]int, 0, len(stats.Requests))
+	for code := range stats.Requests {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fn("hashfs_http_requests_total", map[string]string{"code": strconv.Itoa(code)}, float64(stats.Requests[code]))
+	}
+}
@@ -0,0 +1,80 @@
+package hashfs_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestFS_Stats(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{
+		"a.txt": {Data: []byte(`foo`)},
+		"b.txt": {Data: []byte(`barbaz`)},
+	})
+	f.HashName("a.txt")
+	f.HashName("a.txt")
+	f.HashName("b.txt")
+
+	h := hashfs.FileServer(f)
+	for _, path := range []string{"a.txt", "b.txt", "missing.txt"} {
+		r, _ := http.NewRequest("GET", path, nil)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	stats := f.Stats()
+	if got, want := stats.Entries, 2; got != want {
+		t.Fatalf("Entries=%d, want %d", got, want)
+	} else if got, want := stats.Misses, int64(2); got != want {
+		t.Fatalf("Misses=%d, want %d", got, want)
+	} else if got, want := stats.BytesHashed, int64(9); got != want {
+		t.Fatalf("BytesHashed=%d, want %d", got, want)
+	} else if stats.Hits < 1 {
+		t.Fatalf("Hits=%d, expected at least one", stats.Hits)
+	} else if got, want := stats.Requests, map[int]int64{200: 2, 404: 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Requests=%v, want %v", got, want)
+	}
+}
+
+func TestCollector(t *testing.T) {
+	f := hashfs.NewFS(fstest.MapFS{"a.txt": {Data: []byte(`foo`)}})
+	r, _ := http.NewRequest("GET", "a.txt", nil)
+	hashfs.FileServer(f).ServeHTTP(httptest.NewRecorder(), r)
+
+	c := hashfs.NewCollector(f)
+	var _ expvar.Var = c
+
+	t.Run("String", func(t *testing.T) {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(c.String()), &m); err != nil {
+			t.Fatal(err)
+		} else if got, want := m["entries"], float64(1); got != want {
+			t.Fatalf("entries=%v, want %v", got, want)
+		} else if got, want := m["requests"], map[string]interface{}{"200": float64(1)}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("requests=%v, want %v", got, want)
+		}
+	})
+
+	t.Run("Collect", func(t *testing.T) {
+		m := make(map[string]float64)
+		c.Collect(func(name string, labels map[string]string, value float64) {
+			if code, ok := labels["code"]; ok {
+				name = fmt.Sprintf("%s{code=%q}", name, code)
+			}
+			m[name] = value
+		})
+		if got, want := m["hashfs_cache_entries"], float64(1); got != want {
+			t.Fatalf("hashfs_cache_entries=%v, want %v", got, want)
+		} else if got, want := m["hashfs_hashed_bytes_total"], float64(3); got != want {
+			t.Fatalf("hashfs_hashed_bytes_total=%v, want %v", got, want)
+		} else if got, want := m[`hashfs_http_requests_total{code="200"}`], float64(1); got != want {
+			t.Fatalf("hashfs_http_requests_total=%v, want %v", got, want)
+		}
+	})
+}
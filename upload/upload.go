@@ -0,0 +1,173 @@
+// Package upload copies hashed assets from a hashfs.FS to an object store or
+// CDN origin. Objects are stored under their hash names along with the
+// metadata required to serve them, so the same file system can be used for
+// both local serving & CDN deploys.
+package upload
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+// Object represents the metadata of an uploaded file.
+type Object struct {
+	Key             string // hash name, including the uploader's prefix
+	ContentType     string
+	ContentEncoding string
+	CacheControl    string
+	Size            int64 // size of the stored content, in bytes
+}
+
+// Store represents an object store, such as S3 or GCS, that assets are
+// uploaded to. Implementations should set the object metadata so that it is
+// returned as HTTP headers when the object is served.
+type Store interface {
+	// Exists returns true if an object exists for key. Since keys contain
+	// content hashes, existing objects are not uploaded again.
+	Exists(ctx context.Context, key string) (bool, error)
+
+	// Put stores the content read from r under obj.Key.
+	Put(ctx context.Context, obj *Object, r io.Reader) error
+}
+
+// Uploader uploads every file in a hashfs.FS to a Store.
+type Uploader struct {
+	fsys  *hashfs.FS
+	store Store
+
+	// Prefix is prepended to the hash name of each file to build its key.
+	Prefix string
+
+	// CacheControl is set on every object.
+	// Defaults to hashfs.DefaultCacheControl.
+	CacheControl string
+
+	// If true, compressible files are gzipped before upload and stored with
+	// a Content-Encoding of "gzip".
+	Gzip bool
+}
+
+// NewUploader returns a new instance of Uploader.
+func NewUploader(fsys *hashfs.FS, store Store) *Uploader {
+	return &Uploader{
+		fsys:         fsys,
+		store:        store,
+		CacheControl: hashfs.DefaultCacheControl,
+	}
+}
+
+// Upload hashes every file in the file system and uploads any files that do
+// not already exist in the store. Returns the uploaded objects.
+func (u *Uploader) Upload(ctx context.Context) ([]*Object, error) {
+	if err := u.fsys.Warm(ctx); err != nil {
+		return nil, err
+	}
+
+	var objs []*Object
+	for name, e := range u.fsys.ManifestEntries() {
+		if err := ctx.Err(); err != nil {
+			return objs, err
+		}
+
+		obj, err := u.upload(ctx, name, e)
+		if err != nil {
+			return objs, fmt.Errorf("upload %q: %w", name, err)
+		} else if obj != nil {
+			objs = append(objs, obj)
+		}
+	}
+	return objs, nil
+}
+
+// upload uploads a single file. Returns nil if the object already exists.
+func (u *Uploader) upload(ctx context.Context, name string, e hashfs.ManifestEntry) (*Object, error) {
+	key := u.Prefix + e.HashName
+	if exists, err := u.store.Exists(ctx, key); err != nil {
+		return nil, err
+	} else if exists {
+		return nil, nil
+	}
+
+	buf, err := u.fsys.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &Object{
+		Key:          key,
+		ContentType:  e.ContentType,
+		CacheControl: u.CacheControl,
+	}
+	if obj.ContentType == "" {
+		obj.ContentType = "application/octet-stream"
+	}
+
+	if u.Gzip && hashfs.IsCompressible(obj.ContentType) {
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		if _, err := zw.Write(buf); err != nil {
+			return nil, err
+		} else if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		buf, obj.ContentEncoding = b.Bytes(), "gzip"
+	}
+	obj.Size = int64(len(buf))
+
+	if err := u.store.Put(ctx, obj, bytes.NewReader(buf)); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// DirStore is a Store that writes objects to a local directory, such as a
+// directory synced to a CDN origin. Object metadata is not stored.
+type DirStore struct {
+	Dir string
+}
+
+// Exists returns true if a file exists for key within the directory.
+func (s *DirStore) Exists(ctx context.Context, key string) (bool, error) {
+	if _, err := os.Stat(s.path(key)); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Put writes the content of r to the file for obj.Key. The file is written
+// to a temporary path first so partially written files are never visible.
+func (s *DirStore) Put(ctx context.Context, obj *Object, r io.Reader) error {
+	filename := s.path(obj.Key)
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(filename), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// path returns the local path for key.
+func (s *DirStore) path(key string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(path.Clean("/"+key)))
+}
@@ -0,0 +1,150 @@
+package upload_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benbjohnson/hashfs"
+	"github.com/benbjohnson/hashfs/upload"
+)
+
+func TestUploader_Upload(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{
+			"css/main.css": {Data: []byte(`foo`)},
+			"img/logo.png": {Data: []byte(`bar`)},
+		}, hashfs.WithHashLength(8))
+
+		store := newMemStore()
+		u := upload.NewUploader(fsys, store)
+		u.Prefix = "assets/"
+		if objs, err := u.Upload(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(objs), 2; got != want {
+			t.Fatalf("len(objs)=%d, want %d", got, want)
+		}
+
+		obj := store.objs["assets/css/main-2c26b46b.css"]
+		if obj == nil {
+			t.Fatal("expected css object")
+		} else if got, want := obj.ContentType, "text/css; charset=utf-8"; got != want {
+			t.Fatalf("ContentType=%q, want %q", got, want)
+		} else if got, want := obj.CacheControl, hashfs.DefaultCacheControl; got != want {
+			t.Fatalf("CacheControl=%q, want %q", got, want)
+		} else if got, want := obj.ContentEncoding, ""; got != want {
+			t.Fatalf("ContentEncoding=%q, want %q", got, want)
+		} else if got, want := string(store.data["assets/css/main-2c26b46b.css"]), `foo`; got != want {
+			t.Fatalf("data=%q, want %q", got, want)
+		}
+
+		if obj := store.objs["assets/img/logo-fcde2b2e.png"]; obj == nil {
+			t.Fatal("expected png object")
+		} else if got, want := obj.ContentType, "image/png"; got != want {
+			t.Fatalf("ContentType=%q, want %q", got, want)
+		}
+
+		// Existing objects are skipped on subsequent uploads.
+		if objs, err := u.Upload(context.Background()); err != nil {
+			t.Fatal(err)
+		} else if got, want := len(objs), 0; got != want {
+			t.Fatalf("len(objs)=%d, want %d", got, want)
+		} else if got, want := store.puts, 2; got != want {
+			t.Fatalf("puts=%d, want %d", got, want)
+		}
+	})
+
+	t.Run("Gzip", func(t *testing.T) {
+		fsys := hashfs.NewFS(fstest.MapFS{
+			"main.css": {Data: []byte(`foo`)},
+			"logo.png": {Data: []byte(`bar`)},
+		}, hashfs.WithHashLength(8))
+
+		store := newMemStore()
+		u := upload.NewUploader(fsys, store)
+		u.Gzip = true
+		if _, err := u.Upload(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if obj := store.objs["main-2c26b46b.css"]; obj == nil {
+			t.Fatal("expected css object")
+		} else if got, want := obj.ContentEncoding, "gzip"; got != want {
+			t.Fatalf("ContentEncoding=%q, want %q", got, want)
+		} else if got, want := obj.Size, int64(len(store.data["main-2c26b46b.css"])); got != want {
+			t.Fatalf("Size=%d, want %d", got, want)
+		}
+
+		zr, err := gzip.NewReader(bytes.NewReader(store.data["main-2c26b46b.css"]))
+		if err != nil {
+			t.Fatal(err)
+		} else if buf, err := io.ReadAll(zr); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `foo`; got != want {
+			t.Fatalf("data=%q, want %q", got, want)
+		}
+
+		// Images are already compressed.
+		if got, want := store.objs["logo-fcde2b2e.png"].ContentEncoding, ""; got != want {
+			t.Fatalf("ContentEncoding=%q, want %q", got, want)
+		}
+	})
+}
+
+func TestDirStore(t *testing.T) {
+	dir := t.TempDir()
+	fsys := hashfs.NewFS(fstest.MapFS{
+		"css/main.css": {Data: []byte(`foo`)},
+	}, hashfs.WithHashLength(8))
+
+	if _, err := upload.NewUploader(fsys, &upload.DirStore{Dir: dir}).Upload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf, err := os.ReadFile(filepath.Join(dir, "css", "main-2c26b46b.css")); err != nil {
+		t.Fatal(err)
+	} else if got, want := string(buf), `foo`; got != want {
+		t.Fatalf("data=%q, want %q", got, want)
+	}
+}
+
+// memStore is an in-memory implementation of upload.Store.
+type memStore struct {
+	mu   sync.Mutex
+	objs map[string]*upload.Object
+	data map[string][]byte
+	puts int
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		objs: make(map[string]*upload.Object),
+		data: make(map[string][]byte),
+	}
+}
+
+func (s *memStore) Exists(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.objs[key]
+	return ok, nil
+}
+
+func (s *memStore) Put(ctx context.Context, obj *upload.Object, r io.Reader) error {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objs[obj.Key], s.data[obj.Key] = obj, buf
+	s.puts++
+	return nil
+}
@@ -0,0 +1,110 @@
+package hashfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+)
+
+// ErrIntegrity is returned when the content read for a hash name does not
+// match its hash.
+var ErrIntegrity = errors.New("integrity check failed")
+
+// WithVerifyOnRead returns an option that verifies the content of files
+// opened by hash name as they are read. Reads return an error wrapping
+// ErrIntegrity once the content is found to not match its hash. This catches
+// silent corruption of files backed by disk or network storage. FileServer
+// aborts responses that fail verification so that clients & caches do not
+// store the corrupt content.
+func WithVerifyOnRead(enabled bool) Option {
+	return func(fsys *FS) {
+		fsys.verify = enabled
+	}
+}
+
+// verifyFile wraps a file opened by hash name & verifies its content as it is
+// read from the start. Verification is skipped for reads after a seek to any
+// position other than the start of the file since the full content is not read.
+type verifyFile struct {
+	fs.File
+	name string
+	want []byte // expected digest
+	size int64
+	h    hash.Hash // nil if verification is disabled
+	n    int64     // bytes hashed
+}
+
+// newVerifyFile returns f wrapped so that its content is verified against the
+// hex-encoded digest. Files held in memory were verified when they were
+// hashed and are returned as-is.
+func newVerifyFile(f fs.File, name, digest string) (fs.File, error) {
+	if _, ok := f.(*memFile); ok {
+		return f, nil
+	}
+
+	want, err := hex.DecodeString(digest)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	} else if fi.IsDir() {
+		return f, nil
+	}
+
+	vf := &verifyFile{File: f, name: name, want: want, size: fi.Size(), h: sha256.New()}
+	if _, ok := f.(io.Seeker); ok {
+		return &verifySeekFile{vf}, nil
+	}
+	return vf, nil
+}
+
+func (f *verifyFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	if f.h == nil {
+		return n, err
+	}
+
+	f.h.Write(p[:n])
+	f.n += int64(n)
+
+	// Readers such as io.CopyN may stop at the file size without reading EOF
+	// so the content is checked as soon as all of it has been read. The final
+	// chunk is withheld on failure so the content is never read in full.
+	if f.n >= f.size || err == io.EOF {
+		ok := f.n == f.size && bytes.Equal(f.h.Sum(nil), f.want)
+		f.h = nil
+		if !ok {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: ErrIntegrity}
+		}
+	}
+	return n, err
+}
+
+// verifySeekFile is a verifyFile whose underlying file implements io.Seeker.
+type verifySeekFile struct {
+	*verifyFile
+}
+
+func (f *verifySeekFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.File.(io.Seeker).Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+
+	// Restart verification when reading from the start of the file.
+	if pos == 0 {
+		f.h, f.n = sha256.New(), 0
+	} else {
+		f.h = nil
+	}
+	return pos, nil
+}
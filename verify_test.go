@@ -0,0 +1,77 @@
+package hashfs_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/benbjohnson/hashfs"
+)
+
+func TestFS_WithVerifyOnRead(t *testing.T) {
+	newFS := func() (fstest.MapFS, *hashfs.FS, string) {
+		mfs := fstest.MapFS{"a.txt": {Data: []byte(`foo`)}}
+		f := hashfs.NewFS(mfs, hashfs.WithVerifyOnRead(true))
+		return mfs, f, f.HashName("a.txt")
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		_, f, name := newFS()
+		if buf, err := f.ReadFile(name); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `foo`; got != want {
+			t.Fatalf("ReadFile()=%q, want %q", got, want)
+		}
+
+		file, err := f.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if buf, err := io.ReadAll(file); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `foo`; got != want {
+			t.Fatalf("Read()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("Corrupt", func(t *testing.T) {
+		mfs, f, name := newFS()
+		mfs["a.txt"].Data = []byte(`bar`)
+
+		if _, err := f.ReadFile(name); !errors.Is(err, hashfs.ErrIntegrity) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		file, err := f.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if _, err := io.ReadAll(file); !errors.Is(err, hashfs.ErrIntegrity) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Unhashed names are not verified.
+		if buf, err := f.ReadFile("a.txt"); err != nil {
+			t.Fatal(err)
+		} else if got, want := string(buf), `bar`; got != want {
+			t.Fatalf("ReadFile()=%q, want %q", got, want)
+		}
+	})
+
+	t.Run("FileServer", func(t *testing.T) {
+		mfs, f, name := newFS()
+		mfs["a.txt"].Data = []byte(`bar`)
+
+		r, _ := http.NewRequest("GET", name, nil)
+		w := httptest.NewRecorder()
+		hashfs.FileServer(f).ServeHTTP(w, r)
+		if got := w.Body.String(); got == `bar` {
+			t.Fatalf("unexpected body: %q", got)
+		}
+	})
+}
@@ -0,0 +1,15 @@
+module github.com/benbjohnson/hashfs/watch
+
+go 1.23
+
+require (
+	github.com/benbjohnson/hashfs v0.0.0-00010101000000-000000000000
+	github.com/fsnotify/fsnotify v1.6.0
+)
+
+require (
+	golang.org/x/sys v0.0.0-20220908164124-27713097b956 // indirect
+	golang.org/x/text v0.16.0 // indirect
+)
+
+replace github.com/benbjohnson/hashfs => ../
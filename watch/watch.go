@@ -0,0 +1,105 @@
+// Package watch invalidates hashfs.FS cache entries when files change on
+// disk. It is intended for development servers that serve assets from an
+// os.DirFS so that changed files receive new hash names without a restart.
+package watch
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/benbjohnson/hashfs"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch monitors the directory tree at root and invalidates the cached hash
+// of any file in fsys that is created, written, removed, or renamed. The fsys
+// must be backed by root, e.g. hashfs.NewFS(os.DirFS(root)).
+//
+// Watcher errors are logged rather than returned so that invalidation never
+// silently stops. If events are dropped because the event queue overflowed
+// then every cached hash is removed with Reset.
+//
+// Watch blocks until ctx is canceled or the watch cannot be started.
+func Watch(ctx context.Context, fsys *hashfs.FS, root string) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	// Watches are not recursive so each directory must be added.
+	if err := addAll(w, root); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			handleError(fsys, err)
+		case event, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+
+			name, err := filepath.Rel(root, event.Name)
+			if err != nil {
+				continue
+			}
+			name = filepath.ToSlash(name)
+
+			// Begin watching new directories.
+			if event.Op&fsnotify.Create != 0 {
+				if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() {
+					if err := addAll(w, event.Name); err != nil {
+						log.Printf("hashfs/watch: cannot watch %s: %s", event.Name, err)
+					}
+				}
+			}
+
+			fsys.Invalidate(name)
+
+			// Removing or renaming a directory does not emit events for the
+			// files within it so invalidate them explicitly.
+			if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				for other := range fsys.Manifest() {
+					if strings.HasPrefix(other, name+"/") {
+						fsys.Invalidate(other)
+					}
+				}
+			}
+		}
+	}
+}
+
+// handleError logs a watcher error. Dropped events may include changes to any
+// file so all cached hashes are removed if the event queue overflowed.
+func handleError(fsys *hashfs.FS, err error) {
+	if errors.Is(err, fsnotify.ErrEventOverflow) {
+		log.Printf("hashfs/watch: %s, resetting cache", err)
+		fsys.Reset()
+		return
+	}
+	log.Printf("hashfs/watch: %s", err)
+}
+
+// addAll adds a watch for dir and every directory beneath it.
+func addAll(w *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		} else if !d.IsDir() {
+			return nil
+		}
+		return w.Add(path)
+	})
+}
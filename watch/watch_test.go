@@ -0,0 +1,51 @@
+package watch_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/hashfs"
+	"github.com/benbjohnson/hashfs/watch"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "css"), 0o755); err != nil {
+		t.Fatal(err)
+	} else if err := os.WriteFile(filepath.Join(dir, "css", "main.css"), []byte(`foo`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := hashfs.NewFS(os.DirFS(dir), hashfs.WithHashLength(8))
+	if got, want := fsys.HashName("css/main.css"), "css/main-2c26b46b.css"; got != want {
+		t.Fatalf("HashName()=%q, want %q", got, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- watch.Watch(ctx, fsys, dir) }()
+
+	// Wait for the watcher to start up.
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(filepath.Join(dir, "css", "main.css"), []byte(`baz`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Poll until the cache has been invalidated.
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if fsys.HashName("css/main.css") == "css/main-baa5a096.css" {
+			break
+		} else if time.Since(start) > 5*time.Second {
+			t.Fatal("timeout waiting for invalidation")
+		}
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}